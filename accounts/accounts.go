@@ -0,0 +1,275 @@
+/*
+The accounts package tracks the Revolt accounts the user has logged in to, each with its own
+profile: a token in the credential store (see TokenKey) and a directory under the config directory
+holding its drafts, outbox, and server list.
+Each account belongs to a single Revolt instance; see the instance package.
+The list of accounts, and which was used last, is kept in accounts.json in the config directory.
+*/
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"revolt_tui/broker"
+	"revolt_tui/cfgdir"
+	"revolt_tui/credstore"
+	"revolt_tui/drafts"
+	"revolt_tui/instance"
+	"revolt_tui/log"
+	"revolt_tui/outbox"
+	"revolt_tui/serverlist"
+	"slices"
+	"sync"
+
+	"github.com/sentinelb51/revoltgo"
+)
+
+const (
+	fileName       string = "accounts.json" // in config directory
+	filePermission        = 0600
+	// ID of the account adopted from the single token of earlier versions
+	legacyID string = credstore.DefaultKey
+)
+
+type Account struct {
+	ID       string `json:"id"`                 // names the account's token and profile directory
+	UserID   string `json:"user_id,omitempty"`  // Revolt user ID, once known
+	Email    string `json:"email,omitempty"`    // as entered on login, if logged in this way
+	Username string `json:"username,omitempty"` // as of the last time the account was used
+	Instance string `json:"instance,omitempty"` // API base URL; empty for the official instance
+	// ID of the session the stored token belongs to, if known (ie: logged in by this client)
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// Returns the API base URL of the account's instance.
+func (a Account) API() string {
+	if a.Instance == "" {
+		return instance.Official
+	}
+	return a.Instance
+}
+
+// Returns the key the account's token is stored under.
+// Tokens are stored per instance, so keys of accounts on self-hosted instances name the instance.
+func (a Account) TokenKey() string {
+	if a.API() == instance.Official {
+		return a.ID
+	}
+	return a.ID + "@" + instance.Host(a.API())
+}
+
+// Returns the best available name to display for the account, noting its instance if self-hosted.
+func (a Account) Name() string {
+	name := a.ID
+	switch {
+	case a.Username != "":
+		name = a.Username
+	case a.Email != "":
+		name = a.Email
+	}
+	if a.API() != instance.Official {
+		name += " (" + instance.Host(a.API()) + ")"
+	}
+	return name
+}
+
+// format of the accounts file
+type file struct {
+	Last     string    `json:"last"` // ID of the account used last
+	Accounts []Account `json:"accounts"`
+}
+
+var (
+	known   file
+	current string // ID of the account in use
+	mtx     sync.Mutex
+)
+
+// Loads the accounts listed in the config directory.
+// A missing file is not an error.
+func Load() error {
+	raw, err := os.ReadFile(path.Join(cfgdir.Get(), fileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var f file
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return err
+	}
+	mtx.Lock()
+	known = f
+	mtx.Unlock()
+	return nil
+}
+
+// Adopts the single account of earlier versions, if no accounts are known but the store holds a
+// token under the default key: its per-account files are moved out of the config directory and
+// into its profile.
+func Adopt(store credstore.Store) error {
+	mtx.Lock()
+	defer mtx.Unlock()
+	if len(known.Accounts) > 0 {
+		return nil
+	}
+	if _, err := store.Get(legacyID); err != nil {
+		if errors.Is(err, credstore.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	dir, err := cfgdir.ProfileDir(legacyID)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{drafts.FileName, outbox.FileName, serverlist.FileName} {
+		err := os.Rename(path.Join(cfgdir.Get(), name), path.Join(dir, name))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	known.Accounts = append(known.Accounts, Account{ID: legacyID})
+	known.Last = legacyID
+	log.Writer.Info("adopted existing account")
+	return save()
+}
+
+// Returns the known accounts, in the order they were added.
+func List() []Account {
+	mtx.Lock()
+	defer mtx.Unlock()
+	return slices.Clone(known.Accounts)
+}
+
+// Returns the account used last, if any.
+func Last() (Account, bool) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	return find(known.Last)
+}
+
+// Returns the account in use, if any.
+func Current() (Account, bool) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	return find(current)
+}
+
+// Puts the given account to use, adding it (or updating what is known of it) as needed.
+// The drafts of the previous account are saved and the per-account state of this one is loaded from
+// its profile.
+// An account logged in anew that matches a known account's user ID takes on that account's ID, so
+// the profile is kept. Returns the account as recorded.
+func Use(a Account) (Account, error) {
+	if err := drafts.Save(); err != nil {
+		log.Writer.Warn("failed to save drafts", "error", err)
+	}
+
+	mtx.Lock()
+	a = merge(a)
+	current, known.Last = a.ID, a.ID
+	err := save()
+	mtx.Unlock()
+	if err != nil {
+		log.Writer.Warn("failed to save accounts", "error", err)
+	}
+
+	if err := cfgdir.UseProfile(a.ID); err != nil {
+		return a, err
+	}
+	if err := drafts.Load(); err != nil {
+		log.Writer.Warn("failed to load drafts", "error", err)
+	}
+	if err := outbox.Load(); err != nil {
+		log.Writer.Warn("failed to load outbox", "error", err)
+	}
+	if err := serverlist.Load(); err != nil {
+		log.Writer.Warn("failed to load server list arrangement", "error", err)
+	}
+	return a, nil
+}
+
+// Switches to the given account from within the running program: the account is put to use, its
+// token is stored, and the session replaces the current one.
+// The session is switched even if the account's profile could not be used, in which case the error
+// is returned.
+func Activate(store credstore.Store, a Account, session *revoltgo.Session) (Account, error) {
+	a, err := Use(a)
+	if err := store.Set(a.TokenKey(), session.Token); err != nil {
+		log.Writer.Warn("failed to store token", "store", store.Name(), "account", a.ID, "error", err)
+	}
+	broker.SwitchSession(session)
+	broker.ReloadConfig() // the account may have settings of its own
+	log.Writer.Info("switched account", "account", a.ID)
+	return a, err
+}
+
+// Forgets the given account's token (ex: on logging out), leaving its profile in place.
+func SignOut(store credstore.Store, a Account) error {
+	mtx.Lock()
+	if i := slices.IndexFunc(known.Accounts, func(k Account) bool { return k.ID == a.ID }); i >= 0 {
+		known.Accounts[i].SessionID = ""
+		if err := save(); err != nil {
+			log.Writer.Warn("failed to save accounts", "error", err)
+		}
+	}
+	mtx.Unlock()
+
+	return store.Delete(a.TokenKey())
+}
+
+//#region helpers
+
+// Returns the account with the given ID. Expects the caller to hold the lock.
+func find(id string) (Account, bool) {
+	for _, a := range known.Accounts {
+		if a.ID == id {
+			return a, true
+		}
+	}
+	return Account{}, false
+}
+
+// Records the given account, filling in details from (and updating) the known account it matches by
+// ID or by user ID on the same instance. Expects the caller to hold the lock.
+func merge(a Account) Account {
+	if a.API() == instance.Official {
+		a.Instance = ""
+	}
+	i := slices.IndexFunc(known.Accounts, func(k Account) bool {
+		return k.API() == a.API() && (k.ID == a.ID || (a.UserID != "" && k.UserID == a.UserID))
+	})
+	if i < 0 {
+		known.Accounts = append(known.Accounts, a)
+		return a
+	}
+	k := &known.Accounts[i]
+	if a.UserID != "" {
+		k.UserID = a.UserID
+	}
+	if a.Email != "" {
+		k.Email = a.Email
+	}
+	if a.Username != "" {
+		k.Username = a.Username
+	}
+	if a.SessionID != "" {
+		k.SessionID = a.SessionID
+	}
+	return *k
+}
+
+// writes the accounts to the config directory. Expects the caller to hold the lock.
+func save() error {
+	raw, err := json.Marshal(known)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(cfgdir.Get(), fileName), raw, filePermission)
+}
+
+//#endregion helpers
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/sentinelb51/revoltgo"
+)
+
+// Error types Revolt returns for invalid account details, by the field at fault
+var (
+	EmailErrors    = []string{"InvalidEmail", "EmailInUse", "Blacklisted", "UnknownUser"}
+	PasswordErrors = []string{"ShortPassword", "CompromisedPassword", "InvalidPassword"}
+	InviteErrors   = []string{"MissingInvite", "InvalidInvite"}
+	TokenErrors    = []string{"InvalidToken"}
+)
+
+// Creates an account, which may need verifying (by following an emailed link) before logging in.
+// invite is required by invite-only instances and is otherwise ignored if empty.
+// s need not be authenticated.
+func CreateAccount(s *revoltgo.Session, email, password, invite string) error {
+	body := map[string]string{"email": email, "password": password}
+	if invite != "" {
+		body["invite"] = invite
+	}
+	return Do(s, http.MethodPost, revoltgo.EndpointAuthAccount("create"), nil, body, nil)
+}
+
+// Resends the verification email of an unverified account.
+// s need not be authenticated.
+func ResendVerification(s *revoltgo.Session, email string) error {
+	return Do(s, http.MethodPost, revoltgo.EndpointAuthAccount("reverify"), nil,
+		map[string]string{"email": email}, nil)
+}
+
+// Emails a token for resetting the account's password (see ResetPassword).
+// s need not be authenticated.
+func RequestPasswordReset(s *revoltgo.Session, email string) error {
+	return Do(s, http.MethodPost, revoltgo.EndpointAuthAccount("reset_password"), nil,
+		map[string]string{"email": email}, nil)
+}
+
+// Sets a new password using the token emailed by RequestPasswordReset, optionally logging out every
+// session of the account.
+// s need not be authenticated.
+func ResetPassword(s *revoltgo.Session, token, password string, removeSessions bool) error {
+	return Do(s, http.MethodPatch, revoltgo.EndpointAuthAccount("reset_password"), nil, map[string]any{
+		"token": token, "password": password, "remove_sessions": removeSessions,
+	}, nil)
+}
@@ -0,0 +1,88 @@
+/*
+The api package covers the parts of the Revolt REST API that revoltgo does not expose (or does not
+expose fully), such as request headers and response details.
+Requests are made with the given session's HTTP client and credentials, so they behave as though
+revoltgo had made them.
+*/
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sentinelb51/revoltgo"
+)
+
+// Error is returned for any response outside of the 2xx range.
+type Error struct {
+	Status int    // HTTP status code
+	Type   string // Revolt's error type, if the body contained one (ex: "InvalidCredentials")
+	Body   string // raw response body
+}
+
+func (e *Error) Error() string {
+	if e.Type != "" {
+		return fmt.Sprintf("%d: %s", e.Status, e.Type)
+	}
+	return fmt.Sprintf("%d: %s", e.Status, e.Body)
+}
+
+// Performs a request against the Revolt API as the given session.
+// If body is non-nil, it is encoded as JSON. If result is non-nil, the response is decoded into it.
+// header may be nil.
+func Do(s *revoltgo.Session, method, url string, header http.Header, body, result any) error {
+	var rdr io.Reader = http.NoBody
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rdr = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, url, rdr)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", s.UserAgent)
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		if s.Selfbot() {
+			req.Header.Set("X-Session-Token", s.Token)
+		} else {
+			req.Header.Set("X-Bot-Token", s.Token)
+		}
+	}
+
+	resp, err := s.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		e := &Error{Status: resp.StatusCode, Body: string(raw)}
+		var typed struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(raw, &typed) == nil {
+			e.Type = typed.Type
+		}
+		return e
+	}
+
+	if result != nil && len(raw) > 0 {
+		return json.Unmarshal(raw, result)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"revolt_tui/instance"
+	"strings"
+
+	"github.com/sentinelb51/revoltgo"
+)
+
+// Joins the server the given invite leads to.
+// revoltgo's equivalent decodes the response as an invite preview, losing the server.
+func JoinInvite(s *revoltgo.Session, code string) (*revoltgo.InviteJoin, error) {
+	var joined revoltgo.InviteJoin
+	err := Do(s, http.MethodPost, revoltgo.EndpointInvite(code), nil, nil, &joined)
+	return &joined, err
+}
+
+// Returns every invite to the given server.
+// Revolt describes these in the same shape as a newly created invite.
+func ServerInvites(s *revoltgo.Session, serverID string) ([]*revoltgo.InviteCreate, error) {
+	var invites []*revoltgo.InviteCreate
+	err := Do(s, http.MethodGet, revoltgo.EndpointServers(serverID)+"/invites", nil, nil, &invites)
+	return invites, err
+}
+
+// Extracts the invite code from a code or invite link (ex: https://rvlt.gg/CODE or
+// https://app.revolt.chat/invite/CODE).
+func InviteCode(v string) string {
+	v = strings.TrimSpace(v)
+	v, _, _ = strings.Cut(v, "?")
+	v = strings.TrimRight(v, "/")
+	if i := strings.LastIndex(v, "/"); i >= 0 {
+		v = v[i+1:]
+	}
+	return v
+}
+
+// Returns the shareable link of the given invite code.
+// Invites to self-hosted instances link to the instance's web client, if it is known.
+func InviteLink(code string) string {
+	if cur := instance.Current(); cur.API != instance.Official {
+		if cur.App == "" {
+			return code
+		}
+		return cur.App + "/invite/" + code
+	}
+	return "https://rvlt.gg/" + code
+}
@@ -0,0 +1,17 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/sentinelb51/revoltgo"
+)
+
+// Sends a message to the given channel.
+// The nonce is passed as the request's idempotency key, so Revolt will not create a duplicate if a
+// send is retried after the original was delivered. The resulting message carries the nonce.
+func SendMessage(s *revoltgo.Session, channelID, nonce string, data revoltgo.MessageSend) (*revoltgo.Message, error) {
+	var msg *revoltgo.Message
+	err := Do(s, http.MethodPost, revoltgo.EndpointChannelsMessages(channelID),
+		http.Header{"Idempotency-Key": {nonce}}, data, &msg)
+	return msg, err
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sentinelb51/revoltgo"
+)
+
+// Revolt only bulk-deletes messages younger than this, at most bulkDeleteLimit at a time
+const (
+	BulkDeleteMaxAge = 7 * 24 * time.Hour
+	bulkDeleteLimit  = 100
+)
+
+// Bans the given user from the given server.
+// revoltgo's equivalent cannot provide a reason.
+func Ban(s *revoltgo.Session, serverID, userID, reason string) error {
+	var body struct {
+		Reason string `json:"reason,omitempty"`
+	}
+	body.Reason = reason
+	return Do(s, http.MethodPut, revoltgo.EndpointServersBan(serverID, userID), nil, body, nil)
+}
+
+// Returns the bans of the given server, alongside the banned users.
+// revoltgo's equivalent expects an array, where Revolt returns an object.
+func Bans(s *revoltgo.Session, serverID string) (*revoltgo.ServerBans, error) {
+	var bans revoltgo.ServerBans
+	err := Do(s, http.MethodGet, revoltgo.EndpointServersBans(serverID), nil, nil, &bans)
+	return &bans, err
+}
+
+// Times out the given member until the given time; a zero time lifts their timeout.
+// revoltgo's equivalent always sends every member field.
+func Timeout(s *revoltgo.Session, serverID, userID string, until time.Time) error {
+	var body any = map[string]any{"timeout": until.UTC()}
+	if until.IsZero() {
+		body = map[string][]string{"remove": {"Timeout"}}
+	}
+	return Do(s, http.MethodPatch, revoltgo.EndpointServersMember(serverID, userID), nil, body, nil)
+}
+
+// Deletes the given messages of the given channel, batching as Revolt requires.
+// Returns the number deleted before any error.
+func BulkDelete(s *revoltgo.Session, channelID string, messageIDs []string) (int, error) {
+	var deleted int
+	for len(messageIDs) > 0 {
+		n := min(len(messageIDs), bulkDeleteLimit)
+		err := s.ChannelMessageDeleteBulk(channelID, revoltgo.ChannelMessageBulkDeleteData{IDs: messageIDs[:n]})
+		if err != nil {
+			return deleted, err
+		}
+		deleted += n
+		messageIDs = messageIDs[n:]
+	}
+	return deleted, nil
+}
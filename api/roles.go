@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/sentinelb51/revoltgo"
+)
+
+// Fields of a role to change; nil fields are left as they are.
+// revoltgo's equivalent always sends every field.
+type RoleEdit struct {
+	Name   *string  `json:"name,omitempty"`
+	Colour *string  `json:"colour,omitempty"`
+	Hoist  *bool    `json:"hoist,omitempty"`
+	Rank   *int     `json:"rank,omitempty"`
+	Remove []string `json:"remove,omitempty"` // ex: "Colour"
+}
+
+// permission overrides, as Revolt expects them to be set
+// (revoltgo sends the stored {"a", "d"} form, which Revolt rejects)
+type overrideBody struct {
+	Permissions struct {
+		Allow uint `json:"allow"`
+		Deny  uint `json:"deny"`
+	} `json:"permissions"`
+}
+
+func newOverrideBody(p revoltgo.PermissionAD) overrideBody {
+	var b overrideBody
+	b.Permissions.Allow, b.Permissions.Deny = p.Allow, p.Deny
+	return b
+}
+
+// Creates a role with the given name in the given server, returning the new role's ID.
+// The role itself arrives via a ServerRoleUpdate event.
+func CreateRole(s *revoltgo.Session, serverID, name string) (string, error) {
+	var resp struct {
+		ID string `json:"id"`
+	}
+	err := Do(s, http.MethodPost, revoltgo.EndpointServersRoles(serverID), nil,
+		map[string]string{"name": name}, &resp)
+	return resp.ID, err
+}
+
+// Edits the given role.
+func EditRole(s *revoltgo.Session, serverID, roleID string, edit RoleEdit) error {
+	return Do(s, http.MethodPatch, revoltgo.EndpointServersRole(serverID, roleID), nil, edit, nil)
+}
+
+// Deletes the given role.
+func DeleteRole(s *revoltgo.Session, serverID, roleID string) error {
+	return Do(s, http.MethodDelete, revoltgo.EndpointServersRole(serverID, roleID), nil, nil, nil)
+}
+
+// Sets the server-wide permissions of the given role.
+func SetRolePermissions(s *revoltgo.Session, serverID, roleID string, p revoltgo.PermissionAD) error {
+	return Do(s, http.MethodPut, revoltgo.EndpointPermissions(serverID, roleID), nil, newOverrideBody(p), nil)
+}
+
+// Sets the given channel's override for the given role.
+// A roleID of "default" sets the override applied to everyone.
+func SetChannelPermissions(s *revoltgo.Session, channelID, roleID string, p revoltgo.PermissionAD) error {
+	return Do(s, http.MethodPut, revoltgo.EndpointChannelsPermissions(channelID, roleID), nil, newOverrideBody(p), nil)
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/sentinelb51/revoltgo"
+)
+
+// Returns every active session of the account s is logged in to.
+func Sessions(s *revoltgo.Session) ([]*revoltgo.Sessions, error) {
+	var sessions []*revoltgo.Sessions
+	err := Do(s, http.MethodGet, revoltgo.EndpointAuthSession("all"), nil, nil, &sessions)
+	return sessions, err
+}
+
+// Revokes the session with the given ID, invalidating its token.
+func RevokeSession(s *revoltgo.Session, id string) error {
+	return Do(s, http.MethodDelete, revoltgo.EndpointAuthSession(id), nil, nil, nil)
+}
+
+// Revokes every session of the account except s.
+func RevokeOtherSessions(s *revoltgo.Session) error {
+	return Do(s, http.MethodDelete, revoltgo.EndpointAuthSession("all")+"?revoke_self=false", nil, nil, nil)
+}
+
+// Ends s server-side, invalidating its token.
+func Logout(s *revoltgo.Session) error {
+	return Do(s, http.MethodPost, revoltgo.EndpointAuthSession("logout"), nil, nil, nil)
+}
@@ -0,0 +1,97 @@
+package broker
+
+import (
+	"revolt_tui/api"
+	"revolt_tui/instance"
+	"revolt_tui/log"
+	"sync"
+
+	"github.com/sentinelb51/revoltgo"
+)
+
+/**
+ * This file watches for the session's token being revoked or expiring mid-session.
+ * Revolt reports an invalid token when the socket authenticates and announces deleted sessions as
+ * Auth events. As the ID of a session restored from a stored token is unknown, deletions are
+ * confirmed by checking whether the token is still accepted.
+ * Once invalidated, the session's connection is no longer maintained and the program is sent a
+ * SessionInvalidatedMsg so the user may log in again.
+ */
+
+// Sent to the program when the current session's token is no longer accepted.
+type SessionInvalidatedMsg struct{}
+
+var (
+	invalidated    *revoltgo.Session // the last session to be invalidated
+	loggedOut      bool              // the invalidated session was ended by the user
+	invalidatedMTX sync.Mutex
+)
+
+// Has the given session's token been rejected?
+func Invalidated(session *revoltgo.Session) bool {
+	invalidatedMTX.Lock()
+	defer invalidatedMTX.Unlock()
+	return invalidated == session
+}
+
+// Was the given session ended by the user logging out?
+func LoggedOut(session *revoltgo.Session) bool {
+	invalidatedMTX.Lock()
+	defer invalidatedMTX.Unlock()
+	return invalidated == session && loggedOut
+}
+
+// Ends the current session ahead of logging out, so its revocation is expected rather than reported.
+// Its connection is closed and no longer maintained.
+// Sends to the program, so must not be called from its event loop.
+func EndSession() {
+	invalidatedMTX.Lock()
+	session := Session()
+	invalidated, loggedOut = session, true
+	invalidatedMTX.Unlock()
+
+	socketMTX.Lock()
+	closeSocket(session)
+	socketMTX.Unlock()
+	setConnection(Offline)
+}
+
+// Marks the session as invalid and notifies the program, once per session.
+func invalidate(session *revoltgo.Session) {
+	invalidatedMTX.Lock()
+	if invalidated == session || Session() != session {
+		invalidatedMTX.Unlock()
+		return
+	}
+	invalidated, loggedOut = session, false
+	invalidatedMTX.Unlock()
+
+	log.Writer.Warn("session token was rejected; a new login is required")
+	socketMTX.Lock()
+	closeSocket(session)
+	socketMTX.Unlock()
+	setConnection(Offline)
+	Send(SessionInvalidatedMsg{})
+}
+
+func registerAuthHandlers(session *revoltgo.Session) {
+	session.AddHandler(func(s *revoltgo.Session, e *revoltgo.EventError) {
+		if e.Error == revoltgo.EventErrorTypeInvalidSession {
+			invalidate(s)
+		}
+	})
+	session.AddHandler(func(s *revoltgo.Session, e *revoltgo.EventAuth) {
+		if e.EventType != revoltgo.EventTypeAuthDeleteSession &&
+			e.EventType != revoltgo.EventTypeAuthDeleteAllSessions {
+			return
+		}
+		// handlers run on the socket's read loop, so do not block it on the request
+		go func() {
+			if _, err := api.ValidateToken(instance.Current().API, s.Token); api.Unauthorized(err) {
+				invalidate(s)
+			} else if err != nil {
+				log.Writer.Warn("failed to check token after session deletion", "error", err)
+			}
+		}()
+	})
+}
@@ -6,11 +6,9 @@
 package broker
 
 import (
+	"github.com/sentinelb51/revoltgo"
 	"revolt_tui/log"
 	"sync"
-
-	tea "github.com/charmbracelet/bubbletea"
-	"github.com/sentinelb51/revoltgo"
 )
 
 //#region tty dimensions
@@ -33,32 +31,60 @@ func Width() int {
 	return width
 }
 
-// Returns the current terminal height
+// Returns the terminal height available to modes (excluding the status bar)
 func Height() int {
 	dimensionLock.Lock()
 	defer dimensionLock.Unlock()
-	return height
+	return max(height-StatusBarHeight, 0)
 }
 
 //#endregion tty dimensions
 
 //#region session
 
-var Session *revoltgo.Session
+var (
+	curSession  *revoltgo.Session
+	sessionLock sync.Mutex
+)
+
+// Returns the current session, or nil if none has been initialized.
+// The session may be replaced at any time (ex: on switching accounts), so a request should take it
+// once, when the request is made, and use that throughout.
+func Session() *revoltgo.Session {
+	sessionLock.Lock()
+	defer sessionLock.Unlock()
+	return curSession
+}
 
-// captures the pointer to this session, sets up event handlers, and then open the session for use
+// captures the pointer to this session, sets up event handlers, and then open the session for use.
+// The connection is opened and maintained in the background; see ConnectionStateMsg.
 func InitializeSession(session *revoltgo.Session) {
-	Session = session
+	sessionLock.Lock()
+	curSession = session
+	sessionLock.Unlock()
 	// attach message handler
 	session.AddHandler(func(session *revoltgo.Session, r *revoltgo.EventMessage) {
 		log.Writer.Info("A message has arrived", "msg", r)
-		// TODO display as a top-level notification if not in a current viewing window
+		notify(r)
+		countUnread(r)
 	})
+	session.AddHandler(OnEventReadyFunc)
+	session.AddHandler(onPong)
+	registerStoreHandlers(session)
+	registerAuthHandlers(session)
 
-	// open a websocket connection
-	if err := session.Open(); err != nil {
-		log.Writer.Error("failed to open websocket connection", "error", err)
-	}
+	go manageConnection(session)
+}
+
+// Replaces the current session with the given one (ex: on switching accounts), closing the old
+// session and discarding everything cached from it.
+func SwitchSession(session *revoltgo.Session) {
+	CloseSession()
+	resetStore()
+	resetUnread()
+	SetCurrentServer(nil)
+	SetCurrentChannel(nil)
+	InitializeSession(session)
 }
 
 //#endregion session
@@ -84,41 +110,3 @@ func GetCurrentServer() *revoltgo.Server {
 }
 
 //#endregion current server
-
-//#region cache
-
-var cache *revoltgo.EventReady
-var ready bool // cache has been populated at least once
-var cacheMTX sync.RWMutex
-
-// updates the cache on Ready event; registered during the AddHandler
-func OnEventReadyFunc(_ *revoltgo.Session, r *revoltgo.EventReady) {
-	cacheMTX.Lock()
-
-	isCacheNil := cache == nil
-
-	go log.Writer.Debug("Session is ready", "nil cache?", isCacheNil, "EventReady", r)
-	cache = r
-	ready = true
-	cacheMTX.Unlock()
-}
-
-func CacheReady() bool {
-	return ready
-}
-
-func Servers() []*revoltgo.Server {
-	if cache == nil {
-		return nil
-	}
-	cacheMTX.RLock()
-	defer cacheMTX.RUnlock()
-	// TODO may need to duplicate cache.Servers to prevent data destruction by callers
-	return cache.Servers
-}
-
-type CacheUpdatedMsg struct {
-	tea.Msg
-}
-
-//#endregion cache
@@ -0,0 +1,244 @@
+package broker
+
+import (
+	"fmt"
+	"revolt_tui/instance"
+	"revolt_tui/log"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sentinelb51/revoltgo"
+)
+
+/**
+ * This file manages the websocket connection: it pings the server, reconnects with exponential
+ * backoff when pongs stop arriving, and publishes the connection state to the TUI.
+ * revoltgo updates its session's connection fields (Connected, LastHeartbeatAck, ...) from its own
+ * goroutines without locking, so they are neither read nor written here; liveness is tracked from
+ * the broker's own pings instead, and every use of the session's socket is serialized by socketMTX.
+ */
+
+type ConnState uint8
+
+const (
+	Offline      ConnState = iota // not connected and not currently able to reconnect
+	Connecting                    // socket opened, awaiting Ready
+	Connected                     // Ready received, events are flowing
+	Reconnecting                  // connection was lost; attempting to re-establish it
+)
+
+func (cs ConnState) String() string {
+	switch cs {
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	case Reconnecting:
+		return "reconnecting"
+	}
+	return "offline"
+}
+
+// Sent to the program whenever the connection state changes.
+type ConnectionStateMsg struct {
+	State ConnState
+}
+
+const (
+	healthCheckInterval   = 5 * time.Second
+	stalePongFactor       = 3 // health checks without a pong before the connection is considered dead
+	initialReconnectDelay = time.Second
+	maxReconnectDelay     = time.Minute
+	offlineAfterAttempts  = 5 // failed reconnects before the state is reported as offline (retries continue)
+)
+
+var (
+	connState ConnState = Offline
+	openedAt  time.Time // time the current socket was opened
+	lastPong  time.Time // time the last pong was received on the current socket
+	pingCount int64
+	connMTX   sync.Mutex
+
+	// serializes the broker's use of the current session's socket, which revoltgo replaces on open
+	socketMTX sync.Mutex
+)
+
+// Returns the current state of the websocket connection.
+func Connection() ConnState {
+	connMTX.Lock()
+	defer connMTX.Unlock()
+	return connState
+}
+
+// updates the connection state, notifying the program on change
+func setConnection(cs ConnState) {
+	connMTX.Lock()
+	changed := connState != cs
+	connState = cs
+	connMTX.Unlock()
+	if changed {
+		log.Writer.Info("connection state changed", "state", cs)
+		Send(ConnectionStateMsg{State: cs})
+	}
+}
+
+// Opens the session's websocket, closing any previous one.
+// revoltgo panics if the socket cannot be dialed, so the panic is recovered and returned as an error.
+func open(session *revoltgo.Session) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	socketMTX.Lock()
+	defer socketMTX.Unlock()
+	// drop any remnant of a previous connection; revoltgo refuses to open while it considers the
+	// session connected
+	closeSocket(session)
+
+	log.Writer.Info("opening websocket", "URL", instance.Current().WS)
+	if err := session.Open(); err != nil {
+		return err
+	}
+	connMTX.Lock()
+	openedAt, lastPong = time.Now(), time.Time{}
+	connMTX.Unlock()
+	return nil
+}
+
+// Closes the session's socket, if it has one. The caller must hold socketMTX.
+func closeSocket(session *revoltgo.Session) {
+	if session == nil || session.Socket == nil {
+		return
+	}
+	session.Close()
+	session.Socket.NetConn().Close()
+}
+
+// Closes the current session's connection, if it has one (ex: on exit).
+func CloseSession() {
+	socketMTX.Lock()
+	closeSocket(Session())
+	socketMTX.Unlock()
+}
+
+// Pings the server over the session's socket; the answering Pong is recorded by onPong.
+func ping(session *revoltgo.Session) error {
+	connMTX.Lock()
+	pingCount++
+	n := pingCount
+	connMTX.Unlock()
+
+	socketMTX.Lock()
+	defer socketMTX.Unlock()
+	if session.Socket == nil {
+		return fmt.Errorf("no socket")
+	}
+	return session.WriteSocket(revoltgo.WebsocketMessagePing{Type: revoltgo.WebsocketMessageTypeHeartbeat, Data: n})
+}
+
+// records pongs answering the broker's pings
+func onPong(s *revoltgo.Session, _ *revoltgo.EventPong) {
+	if Session() != s {
+		return
+	}
+	connMTX.Lock()
+	lastPong = time.Now()
+	connMTX.Unlock()
+}
+
+// Is the session's connection alive?
+// A connection is dead if pings cannot be sent or have gone unanswered for too long.
+func healthy(session *revoltgo.Session) bool {
+	if err := ping(session); err != nil {
+		log.Writer.Warn("failed to ping", "error", err)
+		return false
+	}
+	connMTX.Lock()
+	last := lastPong
+	if last.IsZero() { // no pongs yet; measure from when the socket was opened
+		last = openedAt
+	}
+	connMTX.Unlock()
+	return time.Since(last) < stalePongFactor*healthCheckInterval
+}
+
+// Opens the session and watches it for the lifetime of the program, reconnecting as needed.
+// Re-authentication is implicit, as the token is presented whenever the socket is opened; the
+// subsequent Ready event refreshes the cache.
+func manageConnection(session *revoltgo.Session) {
+	// the connection manager owns reconnection; revoltgo's own attempts panic on failure
+	session.ShouldReconnect = false
+
+	setConnection(Connecting)
+	if err := open(session); err != nil {
+		log.Writer.Error("failed to open websocket connection", "error", err)
+		reconnect(session)
+	}
+
+	for {
+		time.Sleep(healthCheckInterval)
+		if Session() != session || Invalidated(session) { // this session has been replaced or revoked
+			return
+		}
+		if !healthy(session) {
+			connMTX.Lock()
+			last := lastPong
+			connMTX.Unlock()
+			log.Writer.Warn("websocket connection lost", "last pong", last)
+			reconnect(session)
+		}
+	}
+}
+
+// Attempts to reopen the session with exponential backoff, returning once successful or once the
+// session has been replaced or revoked.
+func reconnect(session *revoltgo.Session) {
+	setConnection(Reconnecting)
+	delay := initialReconnectDelay
+	for attempt := 1; ; attempt++ {
+		if Session() != session || Invalidated(session) {
+			return
+		}
+		if err := open(session); err == nil {
+			setConnection(Connecting)
+			return
+		} else {
+			log.Writer.Warn("failed to reconnect", "attempt", attempt, "retrying in", delay, "error", err)
+		}
+		if attempt == offlineAfterAttempts {
+			setConnection(Offline)
+		}
+		time.Sleep(delay)
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+//#region program messaging
+
+var program *tea.Program
+var programMTX sync.Mutex
+
+// Registers the program that broker events (such as connection changes) are sent to.
+func AttachProgram(p *tea.Program) {
+	programMTX.Lock()
+	program = p
+	programMTX.Unlock()
+}
+
+// Sends a message to the attached program, if there is one.
+// Blocks until the program receives it, so ordering is preserved; call from outside the program's
+// event loop.
+func Send(msg tea.Msg) {
+	programMTX.Lock()
+	p := program
+	programMTX.Unlock()
+	if p != nil {
+		p.Send(msg)
+	}
+}
+
+//#endregion program messaging
@@ -0,0 +1,295 @@
+package broker
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/sentinelb51/revoltgo"
+)
+
+/**
+ * This file calculates the permissions the user holds.
+ * NOTE: revoltgo's permission constants are offset by a bit (2<<n rather than 1<<n), so the values
+ * used by Revolt are redeclared here.
+ */
+
+// A bitfield of Revolt permissions
+type Permission = uint
+
+const (
+	PermManageChannel       Permission = 1 << 0
+	PermManageServer        Permission = 1 << 1
+	PermManagePermissions   Permission = 1 << 2
+	PermManageRole          Permission = 1 << 3
+	PermManageCustomisation Permission = 1 << 4
+	PermKickMembers         Permission = 1 << 6
+	PermBanMembers          Permission = 1 << 7
+	PermTimeoutMembers      Permission = 1 << 8
+	PermAssignRoles         Permission = 1 << 9
+	PermChangeNickname      Permission = 1 << 10
+	PermManageNicknames     Permission = 1 << 11
+	PermChangeAvatar        Permission = 1 << 12
+	PermRemoveAvatars       Permission = 1 << 13
+	PermViewChannel         Permission = 1 << 20
+	PermReadMessageHistory  Permission = 1 << 21
+	PermSendMessage         Permission = 1 << 22
+	PermManageMessages      Permission = 1 << 23
+	PermManageWebhooks      Permission = 1 << 24
+	PermInviteOthers        Permission = 1 << 25
+	PermSendEmbeds          Permission = 1 << 26
+	PermUploadFiles         Permission = 1 << 27
+	PermMasquerade          Permission = 1 << 28
+	PermReact               Permission = 1 << 29
+	PermConnect             Permission = 1 << 30
+	PermSpeak               Permission = 1 << 31
+	PermVideo               Permission = 1 << 32
+	PermMuteMembers         Permission = 1 << 33
+	PermDeafenMembers       Permission = 1 << 34
+	PermMoveMembers         Permission = 1 << 35
+
+	PermAll Permission = 0x000F_FFFF_FFFF_FFFF
+	// permissions retained by a member who has been timed out
+	PermTimedOut Permission = PermViewChannel | PermReadMessageHistory
+)
+
+// A user-facing name for each permission, in display order
+var PermissionNames = []struct {
+	Bit  Permission
+	Name string
+}{
+	{PermManageChannel, "Manage Channels"},
+	{PermManageServer, "Manage Server"},
+	{PermManagePermissions, "Manage Permissions"},
+	{PermManageRole, "Manage Roles"},
+	{PermManageCustomisation, "Manage Customisation"},
+	{PermKickMembers, "Kick Members"},
+	{PermBanMembers, "Ban Members"},
+	{PermTimeoutMembers, "Timeout Members"},
+	{PermAssignRoles, "Assign Roles"},
+	{PermChangeNickname, "Change Nickname"},
+	{PermManageNicknames, "Manage Nicknames"},
+	{PermChangeAvatar, "Change Avatar"},
+	{PermRemoveAvatars, "Remove Avatars"},
+	{PermViewChannel, "View Channel"},
+	{PermReadMessageHistory, "Read Message History"},
+	{PermSendMessage, "Send Messages"},
+	{PermManageMessages, "Manage Messages"},
+	{PermManageWebhooks, "Manage Webhooks"},
+	{PermInviteOthers, "Invite Others"},
+	{PermSendEmbeds, "Send Embeds"},
+	{PermUploadFiles, "Upload Files"},
+	{PermMasquerade, "Masquerade"},
+	{PermReact, "React"},
+	{PermConnect, "Connect"},
+	{PermSpeak, "Speak"},
+	{PermVideo, "Video"},
+	{PermMuteMembers, "Mute Members"},
+	{PermDeafenMembers, "Deafen Members"},
+	{PermMoveMembers, "Move Members"},
+}
+
+// Returns the server-wide permissions the logged in user holds in the given server.
+// Returns 0 if the server or the user's membership is not cached.
+func ServerPermissions(serverID string) Permission {
+	store.RLock()
+	defer store.RUnlock()
+	return serverPermissions(store.servers[serverID], store.selfID)
+}
+
+// Does the logged in user hold every one of the given permissions in the given server?
+func HasServerPermission(serverID string, perm Permission) bool {
+	return ServerPermissions(serverID)&perm == perm
+}
+
+// Returns the permissions the logged in user holds in the given channel.
+// Returns 0 if the channel is not cached; saved messages, DMs and groups are treated as Revolt does.
+func ChannelPermissions(channelID string) Permission {
+	store.RLock()
+	defer store.RUnlock()
+	return channelPermissions(store.channels[channelID], store.selfID)
+}
+
+// Does the logged in user hold every one of the given permissions in the given channel?
+func HasChannelPermission(channelID string, perm Permission) bool {
+	return ChannelPermissions(channelID)&perm == perm
+}
+
+// Can the logged in user's permissions in the given channel be calculated?
+// They cannot if the channel, or (for server channels) the server or the user's membership of it, is
+// not cached; callers should then let the request through and leave Revolt to refuse it.
+func ChannelPermissionsKnown(channelID string) bool {
+	store.RLock()
+	defer store.RUnlock()
+	ch := store.channels[channelID]
+	if ch == nil {
+		return false
+	}
+	if ch.Server == "" {
+		return true
+	}
+	s := store.servers[ch.Server]
+	return s != nil && (s.Owner == store.selfID || store.members[memberKey{s.ID, store.selfID}] != nil)
+}
+
+// As HasChannelPermission, but presumes unknown permissions (see ChannelPermissionsKnown) are held.
+func MayHaveChannelPermission(channelID string, perm Permission) bool {
+	return !ChannelPermissionsKnown(channelID) || HasChannelPermission(channelID, perm)
+}
+
+// Calculates the permissions of the given user in the given server: the server's defaults, then
+// each of the member's roles from lowest to highest ranked.
+// Caller must hold the read lock.
+func serverPermissions(s *revoltgo.Server, userID string) Permission {
+	perms, m := basePermissions(s, userID)
+	return applyTimeout(perms, m)
+}
+
+// Calculates the permissions of the given user in the given channel: their server permissions, then
+// the channel's default override, then the channel's overrides for each of their roles from lowest to
+// highest ranked.
+// Without View Channel, no other permission is held.
+// Caller must hold the read lock.
+func channelPermissions(ch *revoltgo.Channel, userID string) Permission {
+	if ch == nil {
+		return 0
+	}
+	switch ch.ChannelType {
+	case revoltgo.ChannelTypeSavedMessages:
+		return PermAll
+	case revoltgo.ChannelTypeDM, revoltgo.ChannelTypeGroup:
+		if ch.Owner == userID {
+			return PermAll
+		}
+		if ch.Permissions != nil {
+			return *ch.Permissions | PermViewChannel
+		}
+		return PermViewChannel | PermReadMessageHistory | PermSendMessage | PermInviteOthers |
+			PermSendEmbeds | PermUploadFiles | PermReact | PermConnect | PermSpeak | PermVideo
+	}
+
+	s := store.servers[ch.Server]
+	if s != nil && s.Owner == userID {
+		return PermAll
+	}
+	perms, m := basePermissions(s, userID)
+	if m == nil {
+		return 0
+	}
+	if ch.DefaultPermissions != nil {
+		perms |= ch.DefaultPermissions.Allow
+		perms &^= ch.DefaultPermissions.Deny
+	}
+	for _, r := range memberRoleIDs(s, m) {
+		if o := ch.RolePermissions[r]; o != nil {
+			perms |= o.Allow
+			perms &^= o.Deny
+		}
+	}
+	if perms&PermViewChannel == 0 {
+		return 0
+	}
+	return applyTimeout(perms, m)
+}
+
+// Returns the server permissions of the given user, prior to any timeout, and their membership.
+// Caller must hold the read lock.
+func basePermissions(s *revoltgo.Server, userID string) (Permission, *revoltgo.ServerMember) {
+	if s == nil {
+		return 0, nil
+	}
+	m := store.members[memberKey{s.ID, userID}]
+	if s.Owner == userID {
+		return PermAll, m
+	}
+	if m == nil {
+		return 0, nil
+	}
+
+	var perms Permission
+	if s.DefaultPermissions != nil {
+		perms = *s.DefaultPermissions
+	}
+	for _, r := range memberRoles(s, m) {
+		if r.Permissions != nil {
+			perms |= r.Permissions.Allow
+			perms &^= r.Permissions.Deny
+		}
+	}
+	return perms, m
+}
+
+// restricts the given permissions if the member is timed out
+func applyTimeout(perms Permission, m *revoltgo.ServerMember) Permission {
+	if m != nil && m.Timeout != nil && time.Now().Before(*m.Timeout) {
+		perms &= PermTimedOut
+	}
+	return perms
+}
+
+// Returns the member's roles from lowest to highest ranked (highest to lowest rank value), such that
+// higher ranked roles are applied last.
+// Caller must hold the read lock.
+func memberRoles(s *revoltgo.Server, m *revoltgo.ServerMember) []*revoltgo.ServerRole {
+	ids := memberRoleIDs(s, m)
+	roles := make([]*revoltgo.ServerRole, len(ids))
+	for i, id := range ids {
+		roles[i] = s.Roles[id]
+	}
+	return roles
+}
+
+// As memberRoles, but returns the role IDs.
+// Caller must hold the read lock.
+func memberRoleIDs(s *revoltgo.Server, m *revoltgo.ServerMember) []string {
+	var ids []string
+	for _, id := range m.Roles {
+		if s.Roles[id] != nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.SliceStable(ids, func(i, j int) bool { return s.Roles[ids[i]].Rank > s.Roles[ids[j]].Rank })
+	return ids
+}
+
+// Returns the rank of the user's highest ranked role (lowest rank value) in the given server:
+// math.MaxInt if they have no roles, math.MinInt if they own the server.
+// Owners may manage every role; everyone else may only manage roles ranked below their own.
+func TopRank(serverID string) int {
+	store.RLock()
+	defer store.RUnlock()
+	return rankOf(store.servers[serverID], store.selfID)
+}
+
+// Can the user apply the given moderation permission (ex: PermKickMembers) to the given member?
+// Members can only be moderated by those ranked above them; the owner cannot be moderated at all.
+func CanModerate(serverID, userID string, perm Permission) bool {
+	if !HasServerPermission(serverID, perm) {
+		return false
+	}
+	store.RLock()
+	defer store.RUnlock()
+	s := store.servers[serverID]
+	if s == nil || userID == store.selfID || userID == s.Owner {
+		return false
+	}
+	return rankOf(s, store.selfID) < rankOf(s, userID)
+}
+
+// As TopRank, for any user.
+// Caller must hold the read lock.
+func rankOf(s *revoltgo.Server, userID string) int {
+	if s == nil {
+		return math.MaxInt
+	}
+	if s.Owner == userID {
+		return math.MinInt
+	}
+	top := math.MaxInt
+	if m := store.members[memberKey{s.ID, userID}]; m != nil {
+		for _, r := range memberRoles(s, m) {
+			top = min(top, r.Rank)
+		}
+	}
+	return top
+}
@@ -0,0 +1,59 @@
+package broker
+
+import (
+	"revolt_tui/config"
+	"sync"
+)
+
+/**
+ * This file holds the user's settings (see the config package), as loaded by main, for modes to read.
+ * The settings are reloaded as the config files change, and on switching accounts (as each may have
+ * settings of its own); see ConfigChangedMsg.
+ */
+
+// Sent to the program when the config files change, carrying the reloaded settings.
+// If the files are invalid, Err is set and the current settings should remain in effect.
+type ConfigChangedMsg struct {
+	Settings config.Settings
+	Err      error
+}
+
+var (
+	settings    = config.Defaults()
+	settingsMTX sync.Mutex
+)
+
+// Returns the current settings.
+func Settings() config.Settings {
+	settingsMTX.Lock()
+	defer settingsMTX.Unlock()
+	return settings
+}
+
+// Replaces the current settings.
+func SetSettings(s config.Settings) {
+	settingsMTX.Lock()
+	settings = s
+	settingsMTX.Unlock()
+}
+
+// reloads the config files, sending a ConfigChangedMsg; set by main
+var reloader func()
+
+// Sets the function ReloadConfig calls.
+func SetConfigReloader(f func()) {
+	settingsMTX.Lock()
+	reloader = f
+	settingsMTX.Unlock()
+}
+
+// Reloads the settings in the background (ex: after switching to an account with settings of its own).
+// The result arrives as a ConfigChangedMsg.
+func ReloadConfig() {
+	settingsMTX.Lock()
+	f := reloader
+	settingsMTX.Unlock()
+	if f != nil {
+		go f()
+	}
+}
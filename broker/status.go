@@ -0,0 +1,267 @@
+package broker
+
+import (
+	"revolt_tui/config"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sentinelb51/revoltgo"
+)
+
+/**
+ * This file holds the data displayed by the controller's status bar: segments published by modes,
+ * transient errors, the current channel, and unread counts.
+ * Messages arriving elsewhere are also announced, per the user's notification rules.
+ */
+
+// lines reserved by the controller for the status bar; excluded from Height()
+const StatusBarHeight int = 1
+
+// how long an error or notice posted to the status bar remains visible
+const postDisplayDuration = 6 * time.Second
+
+// Sent to the program when status bar data changes outside of the normal update cycle.
+type StatusChangedMsg struct{}
+
+//#region segments
+
+type segment struct {
+	key, text string
+}
+
+var (
+	segments  []segment // in order of first publication
+	statusErr error
+	notice    string
+	expiry    time.Time // of the posted error or notice
+	statusMTX sync.Mutex
+)
+
+// Publishes (or replaces) a segment of the status bar, identified by key.
+func SetStatusSegment(key, text string) {
+	statusMTX.Lock()
+	defer statusMTX.Unlock()
+	for i := range segments {
+		if segments[i].key == key {
+			segments[i].text = text
+			return
+		}
+	}
+	segments = append(segments, segment{key, text})
+}
+
+// Removes the segment identified by key from the status bar.
+func ClearStatusSegment(key string) {
+	statusMTX.Lock()
+	defer statusMTX.Unlock()
+	for i := range segments {
+		if segments[i].key == key {
+			segments = append(segments[:i], segments[i+1:]...)
+			return
+		}
+	}
+}
+
+// Returns the text of every published segment, in order of first publication.
+func StatusSegments() []string {
+	statusMTX.Lock()
+	defer statusMTX.Unlock()
+	texts := make([]string, 0, len(segments))
+	for _, s := range segments {
+		if s.text != "" {
+			texts = append(texts, s.text)
+		}
+	}
+	return texts
+}
+
+// Displays the given error in the status bar for a short time, replacing any notice.
+// Safe to call from within the program's update cycle.
+func PostError(err error) {
+	post(err, "")
+}
+
+// Displays the given text in the status bar for a short time, replacing any error.
+// Used to report the outcome of an action.
+// Safe to call from within the program's update cycle.
+func PostNotice(text string) {
+	post(nil, text)
+}
+
+func post(err error, text string) {
+	statusMTX.Lock()
+	statusErr, notice = err, text
+	expiry = time.Now().Add(postDisplayDuration)
+	statusMTX.Unlock()
+	// trigger a redraw once the post expires
+	time.AfterFunc(postDisplayDuration, func() { Send(StatusChangedMsg{}) })
+}
+
+// Returns the error to be displayed in the status bar, or nil if there is none (or it expired).
+func StatusError() error {
+	statusMTX.Lock()
+	defer statusMTX.Unlock()
+	if time.Now().After(expiry) {
+		return nil
+	}
+	return statusErr
+}
+
+// Returns the notice to be displayed in the status bar, or "" if there is none (or it expired).
+func StatusNotice() string {
+	statusMTX.Lock()
+	defer statusMTX.Unlock()
+	if time.Now().After(expiry) {
+		return ""
+	}
+	return notice
+}
+
+//#endregion segments
+
+//#region current channel
+
+var curChannel *revoltgo.Channel
+var channelLock sync.Mutex
+
+// Updates the channel the user is currently viewing, clearing its unread count.
+// May be nil if the user is not viewing a channel.
+func SetCurrentChannel(ch *revoltgo.Channel) {
+	channelLock.Lock()
+	curChannel = ch
+	channelLock.Unlock()
+	if ch != nil {
+		unreadMTX.Lock()
+		delete(unread, ch.ID)
+		delete(mentions, ch.ID)
+		unreadMTX.Unlock()
+	}
+}
+
+// Returns the channel the user is currently viewing, if any.
+func GetCurrentChannel() *revoltgo.Channel {
+	channelLock.Lock()
+	defer channelLock.Unlock()
+	return curChannel
+}
+
+//#endregion current channel
+
+//#region unreads
+
+var (
+	unread    map[string]int = make(map[string]int) // channel ID -> messages received since last viewed
+	mentions  map[string]int = make(map[string]int) // channel ID -> unread messages mentioning the user
+	unreadMTX sync.Mutex
+)
+
+// records a message for unread tracking, unless it is authored by the user or in the channel being viewed
+func countUnread(msg *revoltgo.EventMessage) {
+	self := Self()
+	if self != nil && msg.Author == self.ID {
+		return
+	}
+	if ch := GetCurrentChannel(); ch != nil && ch.ID == msg.Channel {
+		return
+	}
+	unreadMTX.Lock()
+	unread[msg.Channel] += 1
+	if self != nil && slices.Contains(msg.Mentions, self.ID) {
+		mentions[msg.Channel] += 1
+	}
+	unreadMTX.Unlock()
+	Send(StatusChangedMsg{})
+}
+
+// Announces the given message in the status bar, if the notification rules call for it.
+// Messages in the current channel and the user's own messages are never announced.
+func notify(msg *revoltgo.EventMessage) {
+	self := Self()
+	if self != nil && msg.Author == self.ID {
+		return
+	}
+	if ch := GetCurrentChannel(); ch != nil && ch.ID == msg.Channel {
+		return
+	}
+	rules := Settings().Notifications
+	switch rules.Level {
+	case config.NotifyNone:
+		return
+	case config.NotifyMentions:
+		if self == nil || !slices.Contains(msg.Mentions, self.ID) {
+			return
+		}
+	}
+	where := "a direct message"
+	ch := Channel(msg.Channel)
+	if ch != nil {
+		if slices.Contains(rules.MutedChannels, ch.ID) || slices.Contains(rules.MutedServers, ch.Server) {
+			return
+		}
+		if ch.Name != "" {
+			where = "#" + ch.Name
+		}
+	}
+	author := msg.Author
+	if u := User(msg.Author); u != nil {
+		author = u.Username
+	}
+	PostNotice(author + " in " + where + ": " + strings.Join(strings.Fields(msg.Content), " "))
+}
+
+// forgets all unread counts
+func resetUnread() {
+	unreadMTX.Lock()
+	unread = make(map[string]int)
+	mentions = make(map[string]int)
+	unreadMTX.Unlock()
+}
+
+// Returns the number of unread messages in the given channel.
+func Unread(channelID string) int {
+	unreadMTX.Lock()
+	defer unreadMTX.Unlock()
+	return unread[channelID]
+}
+
+// Returns the number of unread messages mentioning the user in the given channel.
+func Mentions(channelID string) int {
+	unreadMTX.Lock()
+	defer unreadMTX.Unlock()
+	return mentions[channelID]
+}
+
+// Returns the number of unread messages, and unread mentions, across the channels of the given server.
+func ServerUnread(serverID string) (unreadCount, mentionCount int) {
+	var ids []string
+	store.RLock()
+	for id, c := range store.channels {
+		if c.Server == serverID {
+			ids = append(ids, id)
+		}
+	}
+	store.RUnlock()
+
+	unreadMTX.Lock()
+	defer unreadMTX.Unlock()
+	for _, id := range ids {
+		unreadCount += unread[id]
+		mentionCount += mentions[id]
+	}
+	return
+}
+
+// Returns the number of unread messages across all channels.
+func UnreadTotal() int {
+	unreadMTX.Lock()
+	defer unreadMTX.Unlock()
+	var total int
+	for _, n := range unread {
+		total += n
+	}
+	return total
+}
+
+//#endregion unreads
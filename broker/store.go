@@ -0,0 +1,696 @@
+package broker
+
+/**
+ * The store is the broker's normalized cache of Revolt state.
+ * It is populated wholesale by each Ready event and then kept current by applying the websocket
+ * deltas (create/update/delete) as they arrive.
+ * Every getter returns a copy; callers are free to modify the returned value, but nested pointers
+ * (attachments, statuses, etc) are shared and must be treated as read-only.
+ * Each change to the store is announced to the program via a StoreChangedMsg, save a channel's last
+ * message advancing.
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"revolt_tui/log"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sentinelb51/revoltgo"
+)
+
+// The kind of object a StoreChangedMsg refers to
+type StoreKind string
+
+const (
+	KindServer  StoreKind = "server"
+	KindChannel StoreKind = "channel"
+	KindUser    StoreKind = "user"
+	KindMember  StoreKind = "member"
+	KindRole    StoreKind = "role"
+	KindEmoji   StoreKind = "emoji"
+)
+
+// The operation a StoreChangedMsg describes
+type StoreOp string
+
+const (
+	OpCreate StoreOp = "create"
+	OpUpdate StoreOp = "update"
+	OpDelete StoreOp = "delete"
+)
+
+// Sent to the program whenever a websocket event changes the store.
+// A Ready event replaces the store entirely and sends a CacheUpdatedMsg instead.
+type StoreChangedMsg struct {
+	Kind StoreKind
+	Op   StoreOp
+	ID   string // ID of the changed object; user ID for members, role ID for roles
+	// ID of the server the object belongs to, if applicable (members, roles, channels, emoji)
+	ServerID string
+}
+
+// Sent to the program whenever a Ready event (re)populates the store
+type CacheUpdatedMsg struct {
+	tea.Msg
+}
+
+type memberKey struct {
+	server, user string
+}
+
+var store = struct {
+	sync.RWMutex
+	ready       bool // populated at least once
+	selfID      string
+	serverOrder []string // server IDs in the order they were received
+	servers     map[string]*revoltgo.Server
+	channels    map[string]*revoltgo.Channel
+	users       map[string]*revoltgo.User
+	members     map[memberKey]*revoltgo.ServerMember
+	fullMembers map[string]bool // servers whose every member is cached
+	emoji       map[string]*revoltgo.Emoji
+}{}
+
+//#region population
+
+// (re)populates the store on Ready event (including those following a reconnect); registered by InitializeSession
+func OnEventReadyFunc(_ *revoltgo.Session, r *revoltgo.EventReady) {
+	go log.Writer.Debug("Session is ready", "EventReady", r)
+
+	store.Lock()
+	store.serverOrder = make([]string, 0, len(r.Servers))
+	store.servers = make(map[string]*revoltgo.Server, len(r.Servers))
+	for _, s := range r.Servers {
+		if s != nil {
+			store.serverOrder = append(store.serverOrder, s.ID)
+			store.servers[s.ID] = s
+		}
+	}
+	store.channels = make(map[string]*revoltgo.Channel, len(r.Channels))
+	for _, c := range r.Channels {
+		if c != nil {
+			store.channels[c.ID] = c
+		}
+	}
+	store.users = make(map[string]*revoltgo.User, len(r.Users))
+	store.selfID = ""
+	for _, u := range r.Users {
+		if u != nil {
+			store.users[u.ID] = u
+			store.selfID = u.ID // the last user in the ready event is the current user
+		}
+	}
+	store.members = make(map[memberKey]*revoltgo.ServerMember, len(r.Members))
+	for _, m := range r.Members {
+		if m != nil {
+			store.members[memberKey{m.ID.Server, m.ID.User}] = m
+		}
+	}
+	store.fullMembers = make(map[string]bool)
+	store.emoji = make(map[string]*revoltgo.Emoji, len(r.Emojis))
+	for _, e := range r.Emojis {
+		if e != nil {
+			store.emoji[e.ID] = e
+		}
+	}
+	store.ready = true
+	store.Unlock()
+
+	log.Writer.Info("cache updated")
+	Send(CacheUpdatedMsg{})
+	setConnection(Connected)
+}
+
+// empties the store until the next Ready event (ex: when the session is replaced)
+func resetStore() {
+	store.Lock()
+	store.ready = false
+	store.selfID = ""
+	store.serverOrder = nil
+	store.servers = make(map[string]*revoltgo.Server)
+	store.channels = make(map[string]*revoltgo.Channel)
+	store.users = make(map[string]*revoltgo.User)
+	store.members = make(map[memberKey]*revoltgo.ServerMember)
+	store.fullMembers = make(map[string]bool)
+	store.emoji = make(map[string]*revoltgo.Emoji)
+	store.Unlock()
+}
+
+// attaches a handler for every delta event the store tracks
+func registerStoreHandlers(session *revoltgo.Session) {
+	session.AddHandler(onUpdate)
+	session.AddHandler(func(_ *revoltgo.Session, e *revoltgo.EventServerCreate) {
+		if e.Server == nil {
+			return
+		}
+		store.Lock()
+		if _, known := store.servers[e.Server.ID]; !known {
+			store.serverOrder = append(store.serverOrder, e.Server.ID)
+		}
+		store.servers[e.Server.ID] = e.Server
+		for _, c := range e.Channels {
+			if c != nil {
+				store.channels[c.ID] = c
+			}
+		}
+		for _, em := range e.Emojis {
+			if em != nil {
+				store.emoji[em.ID] = em
+			}
+		}
+		store.Unlock()
+		changed(KindServer, OpCreate, e.Server.ID, e.Server.ID)
+	})
+	session.AddHandler(func(_ *revoltgo.Session, e *revoltgo.EventServerDelete) {
+		store.Lock()
+		deleteServer(e.ID)
+		store.Unlock()
+		changed(KindServer, OpDelete, e.ID, e.ID)
+	})
+	session.AddHandler(func(_ *revoltgo.Session, e *revoltgo.EventChannelCreate) {
+		if e.Channel == nil {
+			return
+		}
+		store.Lock()
+		store.channels[e.Channel.ID] = e.Channel
+		store.Unlock()
+		changed(KindChannel, OpCreate, e.Channel.ID, e.Channel.Server)
+	})
+	session.AddHandler(func(_ *revoltgo.Session, e *revoltgo.EventChannelDelete) {
+		store.Lock()
+		var serverID string
+		if c := store.channels[e.ID]; c != nil {
+			serverID = c.Server
+		}
+		delete(store.channels, e.ID)
+		store.Unlock()
+		changed(KindChannel, OpDelete, e.ID, serverID)
+	})
+	session.AddHandler(func(_ *revoltgo.Session, e *revoltgo.EventChannelGroupJoin) {
+		store.Lock()
+		if c := store.channels[e.ID]; c != nil {
+			c.Recipients = append(c.Recipients, e.User)
+		}
+		store.Unlock()
+		changed(KindChannel, OpUpdate, e.ID, "")
+	})
+	session.AddHandler(func(_ *revoltgo.Session, e *revoltgo.EventChannelGroupLeave) {
+		store.Lock()
+		if c := store.channels[e.ID]; c != nil {
+			c.Recipients = without(c.Recipients, e.User)
+		}
+		store.Unlock()
+		changed(KindChannel, OpUpdate, e.ID, "")
+	})
+	// not announced; arrivals are already announced by the unread counts (see StatusChangedMsg), and
+	// nothing displays the last message ID, so announcing each would only cause needless redraws
+	session.AddHandler(func(_ *revoltgo.Session, e *revoltgo.EventMessage) {
+		store.Lock()
+		if c := store.channels[e.Channel]; c != nil {
+			c.LastMessageID = e.ID
+		}
+		store.Unlock()
+	})
+	session.AddHandler(func(_ *revoltgo.Session, e *revoltgo.EventServerRoleDelete) {
+		store.Lock()
+		if s := store.servers[e.ID]; s != nil {
+			delete(s.Roles, e.RoleID)
+		}
+		store.Unlock()
+		changed(KindRole, OpDelete, e.RoleID, e.ID)
+	})
+	session.AddHandler(func(_ *revoltgo.Session, e *revoltgo.EventServerMemberJoin) {
+		store.Lock()
+		store.members[memberKey{e.ID, e.User}] = &revoltgo.ServerMember{
+			ID: revoltgo.MemberCompositeID{Server: e.ID, User: e.User}}
+		store.Unlock()
+		changed(KindMember, OpCreate, e.User, e.ID)
+	})
+	session.AddHandler(func(_ *revoltgo.Session, e *revoltgo.EventServerMemberLeave) {
+		store.Lock()
+		delete(store.members, memberKey{e.ID, e.User})
+		self := e.User == store.selfID
+		if self { // we left (or were removed from) the server
+			deleteServer(e.ID)
+		}
+		store.Unlock()
+		changed(KindMember, OpDelete, e.User, e.ID)
+		if self {
+			changed(KindServer, OpDelete, e.ID, e.ID)
+		}
+	})
+	session.AddHandler(func(_ *revoltgo.Session, e *revoltgo.EventEmojiCreate) {
+		if e.Emoji == nil {
+			return
+		}
+		store.Lock()
+		store.emoji[e.Emoji.ID] = e.Emoji
+		store.Unlock()
+		changed(KindEmoji, OpCreate, e.Emoji.ID, emojiServer(e.Emoji))
+	})
+	session.AddHandler(func(_ *revoltgo.Session, e *revoltgo.EventEmojiDelete) {
+		store.Lock()
+		var serverID string
+		if em := store.emoji[e.ID]; em != nil {
+			serverID = emojiServer(em)
+		}
+		delete(store.emoji, e.ID)
+		store.Unlock()
+		changed(KindEmoji, OpDelete, e.ID, serverID)
+	})
+	session.AddHandler(func(_ *revoltgo.Session, e *revoltgo.EventUserPlatformWipe) {
+		store.Lock()
+		delete(store.users, e.UserID)
+		store.Unlock()
+		changed(KindUser, OpDelete, e.UserID, "")
+	})
+}
+
+// applies the partial updates of every *Update event
+func onUpdate(_ *revoltgo.Session, e *revoltgo.AbstractEventUpdate) {
+	clears := e.Clear
+	if len(clears) == 0 {
+		clears = e.Remove
+	}
+
+	store.Lock()
+	var (
+		kind     StoreKind
+		id       = e.ID.StringID
+		serverID string
+		ok       bool
+	)
+	switch e.Type {
+	case "ServerUpdate":
+		kind, serverID = KindServer, id
+		if s := store.servers[id]; s != nil {
+			ok = merge(s, e.Data, clears)
+		}
+	case "ChannelUpdate":
+		kind = KindChannel
+		if c := store.channels[id]; c != nil {
+			ok = merge(c, e.Data, clears)
+			serverID = c.Server
+		}
+	case "UserUpdate":
+		kind = KindUser
+		if u := store.users[id]; u != nil {
+			ok = merge(u, e.Data, clears)
+		}
+	case "ServerRoleUpdate":
+		kind, serverID, id = KindRole, id, e.RoleID
+		if s := store.servers[serverID]; s != nil {
+			if s.Roles == nil {
+				s.Roles = make(map[string]*revoltgo.ServerRole)
+			}
+			r := s.Roles[id]
+			if r == nil { // roles are created via their first update
+				r = &revoltgo.ServerRole{}
+				s.Roles[id] = r
+			}
+			ok = merge(r, e.Data, clears)
+		}
+	case "ServerMemberUpdate":
+		kind, id, serverID = KindMember, e.ID.MemberID.User, e.ID.MemberID.Server
+		if m := store.members[memberKey{serverID, id}]; m != nil {
+			ok = merge(m, e.Data, clears)
+		}
+	}
+	store.Unlock()
+
+	if ok {
+		changed(kind, OpUpdate, id, serverID)
+	}
+}
+
+//#endregion population
+
+//#region getters
+
+// Has the store been populated at least once?
+func CacheReady() bool {
+	store.RLock()
+	defer store.RUnlock()
+	return store.ready
+}
+
+// Returns the logged in user, or nil if the cache is not yet ready.
+func Self() *revoltgo.User {
+	store.RLock()
+	defer store.RUnlock()
+	return copyPtr(store.users[store.selfID])
+}
+
+// Returns the servers the user is a member of, in the order they were received.
+func Servers() []*revoltgo.Server {
+	store.RLock()
+	defer store.RUnlock()
+	if !store.ready {
+		return nil
+	}
+	servers := make([]*revoltgo.Server, 0, len(store.serverOrder))
+	for _, id := range store.serverOrder {
+		if s := store.servers[id]; s != nil {
+			servers = append(servers, copyServer(s))
+		}
+	}
+	return servers
+}
+
+// Returns the server with the given ID, or nil if it is not cached.
+func Server(id string) *revoltgo.Server {
+	store.RLock()
+	defer store.RUnlock()
+	return copyServer(store.servers[id])
+}
+
+// Returns the cached channel with the given ID, or nil if it is not cached.
+func Channel(id string) *revoltgo.Channel {
+	store.RLock()
+	defer store.RUnlock()
+	return copyChannel(store.channels[id])
+}
+
+// Returns the cached user with the given ID, or nil if it is not cached.
+func User(id string) *revoltgo.User {
+	store.RLock()
+	defer store.RUnlock()
+	return copyPtr(store.users[id])
+}
+
+// Caches the given channels (ex: those fetched because Ready omitted them), so their permissions can
+// be calculated and later lookups need not hit the API.
+func AddChannels(channels ...*revoltgo.Channel) {
+	store.Lock()
+	defer store.Unlock()
+	if store.channels == nil {
+		store.channels = make(map[string]*revoltgo.Channel)
+	}
+	for _, c := range channels {
+		if c != nil {
+			store.channels[c.ID] = copyChannel(c)
+		}
+	}
+}
+
+// Caches the given users (ex: those returned alongside a member list), so later lookups need not
+// hit the API.
+func AddUsers(users ...*revoltgo.User) {
+	store.Lock()
+	defer store.Unlock()
+	if store.users == nil {
+		store.users = make(map[string]*revoltgo.User)
+	}
+	for _, u := range users {
+		if u != nil {
+			store.users[u.ID] = copyPtr(u)
+		}
+	}
+}
+
+// Returns the given user's membership of the given server, or nil if it is not cached.
+func Member(serverID, userID string) *revoltgo.ServerMember {
+	store.RLock()
+	defer store.RUnlock()
+	return copyMember(store.members[memberKey{serverID, userID}])
+}
+
+// Returns the cached members of the given server.
+// Ready only contains the user's own memberships; use Session().ServerMembers for a full list.
+func Members(serverID string) []*revoltgo.ServerMember {
+	store.RLock()
+	defer store.RUnlock()
+	var members []*revoltgo.ServerMember
+	for k, m := range store.members {
+		if k.server == serverID {
+			members = append(members, copyMember(m))
+		}
+	}
+	return members
+}
+
+// Caches the given members, replacing any existing entries.
+func AddMembers(members ...*revoltgo.ServerMember) {
+	store.Lock()
+	defer store.Unlock()
+	if store.members == nil {
+		store.members = make(map[memberKey]*revoltgo.ServerMember)
+	}
+	for _, m := range members {
+		if m != nil {
+			store.members[memberKey{m.ID.Server, m.ID.User}] = copyMember(m)
+		}
+	}
+}
+
+// Caches the full member list of the given server (as returned by Session().ServerMembers), so that
+// MemberCount can answer without another fetch.
+func AddAllMembers(serverID string, members ...*revoltgo.ServerMember) {
+	AddMembers(members...)
+	store.Lock()
+	defer store.Unlock()
+	if store.fullMembers == nil {
+		store.fullMembers = make(map[string]bool)
+	}
+	store.fullMembers[serverID] = true
+}
+
+// Returns the number of members in the given server and true, if its full member list is cached
+// (see AddAllMembers); joins and leaves keep the count current.
+func MemberCount(serverID string) (int, bool) {
+	store.RLock()
+	defer store.RUnlock()
+	if !store.fullMembers[serverID] {
+		return 0, false
+	}
+	var n int
+	for k := range store.members {
+		if k.server == serverID {
+			n++
+		}
+	}
+	return n, true
+}
+
+// Returns the roles of the given server, keyed by role ID.
+func Roles(serverID string) map[string]*revoltgo.ServerRole {
+	store.RLock()
+	defer store.RUnlock()
+	s := store.servers[serverID]
+	if s == nil {
+		return nil
+	}
+	return copyRoles(s.Roles)
+}
+
+// Returns the custom emoji belonging to the given server, ordered by name.
+func Emoji(serverID string) []*revoltgo.Emoji {
+	store.RLock()
+	defer store.RUnlock()
+	var emoji []*revoltgo.Emoji
+	for _, e := range store.emoji {
+		if emojiServer(e) == serverID {
+			emoji = append(emoji, copyPtr(e))
+		}
+	}
+	sort.Slice(emoji, func(i, j int) bool { return emoji[i].Name < emoji[j].Name })
+	return emoji
+}
+
+//#endregion getters
+
+//#region helper functions
+
+// notifies the program of a change to the store
+func changed(kind StoreKind, op StoreOp, id, serverID string) {
+	log.Writer.Debug("store changed", "kind", kind, "op", op, "id", id, "server", serverID)
+	Send(StoreChangedMsg{Kind: kind, Op: op, ID: id, ServerID: serverID})
+}
+
+// removes the server and everything belonging to it.
+// Caller must hold the write lock.
+func deleteServer(id string) {
+	delete(store.servers, id)
+	store.serverOrder = without(store.serverOrder, id)
+	for cid, c := range store.channels {
+		if c.Server == id {
+			delete(store.channels, cid)
+		}
+	}
+	for k := range store.members {
+		if k.server == id {
+			delete(store.members, k)
+		}
+	}
+	delete(store.fullMembers, id)
+	for eid, e := range store.emoji {
+		if emojiServer(e) == id {
+			delete(store.emoji, eid)
+		}
+	}
+}
+
+// returns the ID of the server the emoji belongs to, if any
+func emojiServer(e *revoltgo.Emoji) string {
+	if e.Parent == nil || e.Parent.Type != "Server" {
+		return ""
+	}
+	return e.Parent.ID
+}
+
+// returns s, minus any instances of v
+func without(s []string, v string) []string {
+	out := s[:0]
+	for _, x := range s {
+		if x != v {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+// nested fields named by the API's clear lists, which do not follow the snake case convention
+var nestedClears = map[string][]string{
+	"StatusText":        {"status", "text"},
+	"StatusPresence":    {"status", "presence"},
+	"ProfileContent":    {"profile", "content"},
+	"ProfileBackground": {"profile", "background"},
+}
+
+// Merges the partial JSON object data into obj, removing the fields named in clears.
+// Returns false (leaving obj untouched) if either cannot be decoded.
+func merge[T any](obj *T, data []byte, clears []string) bool {
+	var (
+		current map[string]any
+		delta   map[string]any
+	)
+	raw, err := json.Marshal(obj)
+	if err == nil {
+		err = json.Unmarshal(raw, &current)
+	}
+	if err == nil && len(data) > 0 {
+		err = json.Unmarshal(data, &delta)
+	}
+	if err != nil {
+		log.Writer.Warn("failed to merge update", "type", fmt.Sprintf("%T", obj), "error", err)
+		return false
+	}
+
+	for k, v := range delta {
+		current[k] = v
+	}
+	for _, field := range clears {
+		if path, ok := nestedClears[field]; ok {
+			if parent, ok := current[path[0]].(map[string]any); ok {
+				delete(parent, path[1])
+			}
+			continue
+		}
+		delete(current, snakeCase(field))
+	}
+
+	if raw, err = json.Marshal(current); err != nil {
+		log.Writer.Warn("failed to merge update", "error", err)
+		return false
+	}
+	var merged T
+	if err := json.Unmarshal(raw, &merged); err != nil {
+		log.Writer.Warn("failed to merge update", "error", err)
+		return false
+	}
+	*obj = merged
+	return true
+}
+
+// converts a PascalCase field name (as used by clear lists) to its snake_case JSON key
+func snakeCase(s string) string {
+	var sb strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				sb.WriteRune('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+//#endregion helper functions
+
+//#region copies
+
+// returns a shallow copy of *p, or nil
+func copyPtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	return &c
+}
+
+func copyServer(s *revoltgo.Server) *revoltgo.Server {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	c.Channels = append([]string(nil), s.Channels...)
+	c.Categories = make([]*revoltgo.ServerCategory, 0, len(s.Categories))
+	for _, cat := range s.Categories {
+		if cat != nil {
+			cc := *cat
+			cc.Channels = append([]string(nil), cat.Channels...)
+			c.Categories = append(c.Categories, &cc)
+		}
+	}
+	c.Roles = copyRoles(s.Roles)
+	return &c
+}
+
+func copyRoles(roles map[string]*revoltgo.ServerRole) map[string]*revoltgo.ServerRole {
+	if roles == nil {
+		return nil
+	}
+	c := make(map[string]*revoltgo.ServerRole, len(roles))
+	for id, r := range roles {
+		rc := copyPtr(r)
+		if rc != nil {
+			rc.Permissions = copyPtr(r.Permissions)
+		}
+		c[id] = rc
+	}
+	return c
+}
+
+func copyChannel(ch *revoltgo.Channel) *revoltgo.Channel {
+	if ch == nil {
+		return nil
+	}
+	c := *ch
+	c.Recipients = append([]string(nil), ch.Recipients...)
+	c.DefaultPermissions = copyPtr(ch.DefaultPermissions)
+	if ch.RolePermissions != nil {
+		c.RolePermissions = make(map[string]*revoltgo.PermissionAD, len(ch.RolePermissions))
+		for id, p := range ch.RolePermissions {
+			c.RolePermissions[id] = copyPtr(p)
+		}
+	}
+	return &c
+}
+
+func copyMember(m *revoltgo.ServerMember) *revoltgo.ServerMember {
+	if m == nil {
+		return nil
+	}
+	c := *m
+	c.Roles = append([]string(nil), m.Roles...)
+	return &c
+}
+
+//#endregion copies
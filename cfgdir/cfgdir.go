@@ -2,22 +2,31 @@
 This package controls all interactions with the config directory and everything therein.
 cfgDirPath is guaranteed to be set (init panics on failure) prior to `main()`.
 Also handles token path.
+Per-account state (ex: drafts) is kept in a profile subdirectory for each account; see UseProfile.
 */
 package cfgdir
 
 import (
 	"os"
 	"path"
+	"sync"
 )
 
 const (
 	SubDirName       string = "revolttui"
 	defaultTokenName string = "token"
+	profilesDirName  string = "profiles"
 )
 
 // path to current config directory
 var cfgDirPath string
 
+// path to the current profile's directory; the config directory until a profile is used
+var (
+	profilePath string
+	profileMTX  sync.Mutex
+)
+
 // on boot, determine a config directory to use.
 // Try the default config directory, but fall back to the local directory on failure.
 func init() {
@@ -61,3 +70,35 @@ func trySpawnDir(base string) (subDirPath string, err error) {
 func Get() string {
 	return cfgDirPath
 }
+
+// Returns the path to the given profile's directory, creating it if it does not exist.
+func ProfileDir(id string) (string, error) {
+	dir := path.Join(cfgDirPath, profilesDirName, id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// Makes the given profile's directory the one per-account state is read from and written to.
+func UseProfile(id string) error {
+	dir, err := ProfileDir(id)
+	if err != nil {
+		return err
+	}
+	profileMTX.Lock()
+	profilePath = dir
+	profileMTX.Unlock()
+	return nil
+}
+
+// Returns the path to the current profile's directory (or the config directory, if no profile is in
+// use). Guaranteed to exist.
+func Profile() string {
+	profileMTX.Lock()
+	defer profileMTX.Unlock()
+	if profilePath == "" {
+		return cfgDirPath
+	}
+	return profilePath
+}
@@ -0,0 +1,373 @@
+/*
+The config package loads the user's settings.
+Settings are layered, each layer overriding the last: built-in defaults; system-wide config files
+(under $XDG_CONFIG_DIRS, most important directory last); the user's config file in the config
+directory (or the file given by --config); the current account's config file in its profile directory
+(see cfgdir.UseProfile); REVOLTTUI_* environment variables; and explicitly-set flags.
+Config files are TOML (config.toml) or YAML (config.yaml or config.yml); unknown settings are
+rejected, as are invalid values, naming the layer each came from. The theme and notification rules
+may only be given by config files.
+Main loads the settings on startup and hands them to the broker, from which modes read them.
+*/
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"revolt_tui/cfgdir"
+	"revolt_tui/credstore"
+	"revolt_tui/instance"
+	"revolt_tui/stylesheet/colors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/charmbracelet/log"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	baseName  string = "config" // of config files, before their extension
+	envPrefix string = "REVOLTTUI_"
+	// flag naming an alternative to the user's config file
+	FileFlag string = "config"
+)
+
+// file extensions accepted, in the order they are looked for
+var extensions = []string{".toml", ".yaml", ".yml"}
+
+// differs from the reference time of layouts in every field, so formatting it alters any layout that
+// has time fields
+var sample = time.Date(1999, time.November, 30, 22, 48, 59, 0, time.UTC)
+
+// Settings, as given by every layer.
+type Settings struct {
+	LogLevel        string `toml:"log_level" yaml:"log_level"`
+	CredentialStore string `toml:"credential_store" yaml:"credential_store"` // see credstore.Backends
+	Instance        string `toml:"instance" yaml:"instance"`                 // API URL; normalized on load
+	SessionName     string `toml:"session_name" yaml:"session_name"`         // empty for the default
+	// layout (see the time package) of message timestamps
+	TimestampFormat string `toml:"timestamp_format" yaml:"timestamp_format"`
+
+	// colors overriding the theme's, by name (see the colors package)
+	Theme         map[string]string `toml:"theme" yaml:"theme"`
+	Notifications Notifications     `toml:"notifications" yaml:"notifications"`
+}
+
+// Levels of notification, naming which messages (outside the current channel) are announced
+const (
+	NotifyAll      string = "all"
+	NotifyMentions string = "mentions" // only messages mentioning the user
+	NotifyNone     string = "none"
+)
+
+// Rules for announcing messages that arrive outside the current channel.
+type Notifications struct {
+	Level         string   `toml:"level" yaml:"level"`
+	MutedServers  []string `toml:"muted_servers" yaml:"muted_servers"`   // IDs of servers never announced
+	MutedChannels []string `toml:"muted_channels" yaml:"muted_channels"` // IDs of channels never announced
+}
+
+// Returns the built-in settings.
+func Defaults() Settings {
+	return Settings{
+		LogLevel:        "debug",
+		CredentialStore: credstore.Auto,
+		TimestampFormat: time.Stamp,
+		Notifications:   Notifications{Level: NotifyMentions},
+	}
+}
+
+// a setting that may be given by environment variable or by flag
+type option struct {
+	key   string // as in config files; also names the environment variable
+	flag  string
+	field func(*Settings) *string
+}
+
+var options = []option{
+	{"log_level", "loglevel", func(s *Settings) *string { return &s.LogLevel }},
+	{"credential_store", "credential-store", func(s *Settings) *string { return &s.CredentialStore }},
+	{"instance", "instance", func(s *Settings) *string { return &s.Instance }},
+	{"session_name", "session-name", func(s *Settings) *string { return &s.SessionName }},
+	{"timestamp_format", "timestamp-format", func(s *Settings) *string { return &s.TimestampFormat }},
+}
+
+// Returns the environment variable that sets the given option.
+func (o option) env() string {
+	return envPrefix + strings.ToUpper(o.key)
+}
+
+// Loads the settings from every layer, reading flags from the given set (which must define
+// FileFlag).
+// Returns the config files read, most important last, for reloading.
+func Load(flags *pflag.FlagSet) (Settings, []string, error) {
+	return load(flags, cfgdir.Get(), cfgdir.Profile())
+}
+
+// Load, reading the user's and the current account's config files from the given directories.
+func load(flags *pflag.FlagSet, userDir, profileDir string) (Settings, []string, error) {
+	var (
+		s       = Defaults()
+		sources = make(map[string]string) // layer that last set each key
+		files   []string
+	)
+
+	// config files
+	paths, err := findFiles(flags, userDir, profileDir)
+	if err != nil {
+		return s, nil, err
+	}
+	for _, p := range paths {
+		before := s
+		before.Theme = maps.Clone(s.Theme) // decoding fills the map in place
+		if err := decodeFile(p, &s); err != nil {
+			return s, files, err
+		}
+		files = append(files, p)
+		attribute(before, s, sources, p)
+	}
+
+	// environment
+	for _, o := range options {
+		if v, ok := os.LookupEnv(o.env()); ok {
+			*o.field(&s) = v
+			sources[o.key] = "$" + o.env()
+		}
+	}
+
+	// flags
+	for _, o := range options {
+		if flags.Lookup(o.flag) == nil || !flags.Changed(o.flag) {
+			continue
+		}
+		v, err := flags.GetString(o.flag)
+		if err != nil {
+			return s, files, err
+		}
+		*o.field(&s) = v
+		sources[o.key] = "--" + o.flag
+	}
+
+	if err := validate(&s, sources); err != nil {
+		return s, files, err
+	}
+	return s, files, nil
+}
+
+//#region helpers
+
+// Returns the config files to read, least important first: the system-wide files of each of
+// $XDG_CONFIG_DIRS, then the user's file, then the current account's.
+// Each directory may hold at most one config file.
+func findFiles(flags *pflag.FlagSet, userDir, profileDir string) ([]string, error) {
+	var files []string
+	for _, dir := range systemDirs() {
+		f, err := findIn(path.Join(dir, cfgdir.SubDirName))
+		if err != nil {
+			return nil, err
+		}
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+
+	if user, _ := flags.GetString(FileFlag); user != "" {
+		if _, err := os.Stat(user); err != nil {
+			return nil, fmt.Errorf("config file given by --%s: %w", FileFlag, err)
+		}
+		files = append(files, user)
+	} else {
+		f, err := findIn(userDir)
+		if err != nil {
+			return nil, err
+		}
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+
+	if profileDir != userDir {
+		f, err := findIn(profileDir)
+		if err != nil {
+			return nil, err
+		}
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// Returns the system-wide config directories, least important first.
+func systemDirs() []string {
+	xdg := filepath.SplitList(os.Getenv("XDG_CONFIG_DIRS"))
+	if len(xdg) == 0 {
+		xdg = []string{"/etc/xdg"}
+	}
+	var dirs []string
+	for i := len(xdg) - 1; i >= 0; i-- {
+		if filepath.IsAbs(xdg[i]) { // others are ignored, per the XDG spec
+			dirs = append(dirs, xdg[i])
+		}
+	}
+	return dirs
+}
+
+// Returns the config file in the given directory, or "" if there is none.
+func findIn(dir string) (string, error) {
+	var found []string
+	for _, ext := range extensions {
+		p := path.Join(dir, baseName+ext)
+		if _, err := os.Stat(p); err == nil {
+			found = append(found, p)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", nil
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("%s holds several config files (%s); remove all but one",
+		dir, strings.Join(found, ", "))
+}
+
+// Decodes the given config file over the given settings, according to its extension.
+// Settings the file does not mention are left as they are.
+func decodeFile(p string, s *Settings) error {
+	raw, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".toml":
+		md, err := toml.Decode(string(raw), s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown setting %q (known settings are: %s)",
+				p, undecoded[0].String(), knownKeys())
+		}
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(raw))
+		dec.KnownFields(true)
+		if err := dec.Decode(s); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w (known settings are: %s)", p, err, knownKeys())
+		}
+	default:
+		return fmt.Errorf("%s: unsupported config format; use one of %s", p, strings.Join(extensions, ", "))
+	}
+	return nil
+}
+
+// Records the given layer as the source of each setting it changed.
+func attribute(before, after Settings, sources map[string]string, layer string) {
+	for _, o := range options {
+		if *o.field(&before) != *o.field(&after) {
+			sources[o.key] = layer
+		}
+	}
+	for name, c := range after.Theme {
+		if before.Theme[name] != c {
+			sources["theme."+name] = layer
+		}
+	}
+	if before.Notifications.Level != after.Notifications.Level {
+		sources["notifications.level"] = layer
+	}
+}
+
+// Checks (and normalizes) every setting, returning every problem found.
+func validate(s *Settings, sources map[string]string) error {
+	var errs []error
+	fail := func(key, format string, a ...any) {
+		msg := fmt.Sprintf(format, a...)
+		if src, ok := sources[key]; ok {
+			errs = append(errs, fmt.Errorf("%s (from %s): %s", key, src, msg))
+		} else {
+			errs = append(errs, fmt.Errorf("%s: %s", key, msg))
+		}
+	}
+
+	s.LogLevel = strings.ToLower(strings.TrimSpace(s.LogLevel))
+	if _, err := log.ParseLevel(s.LogLevel); err != nil {
+		fail("log_level", "unknown level %q; expected one of debug, info, warn, error, fatal", s.LogLevel)
+	}
+
+	s.CredentialStore = strings.ToLower(strings.TrimSpace(s.CredentialStore))
+	if !slices.Contains(credstore.Backends(), s.CredentialStore) {
+		fail("credential_store", "unknown store %q; expected one of %s",
+			s.CredentialStore, strings.Join(credstore.Backends(), ", "))
+	}
+
+	if strings.TrimSpace(s.Instance) != "" {
+		api, err := instance.Normalize(s.Instance)
+		if err != nil {
+			fail("instance", "%v", err)
+		}
+		s.Instance = api
+	}
+
+	s.SessionName = strings.TrimSpace(s.SessionName)
+
+	if strings.TrimSpace(s.TimestampFormat) == "" {
+		fail("timestamp_format", "must not be empty; use a Go time layout (ex: %q)", time.Kitchen)
+	} else if sample.Format(s.TimestampFormat) == s.TimestampFormat {
+		fail("timestamp_format", "%q contains no time fields; use a Go time layout (ex: %q)",
+			s.TimestampFormat, time.Kitchen)
+	}
+
+	names := make([]string, 0, len(s.Theme))
+	for name := range s.Theme {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if c := s.Theme[name]; !colors.Known(name) {
+			fail("theme."+name, "unknown color; expected one of %s", strings.Join(colors.Names(), ", "))
+		} else if !validColor(c) {
+			fail("theme."+name, "%q is not a color; use a hex color (ex: \"#fd6671\") or an ANSI color number (0-255)", c)
+		}
+	}
+
+	s.Notifications.Level = strings.ToLower(strings.TrimSpace(s.Notifications.Level))
+	if levels := []string{NotifyAll, NotifyMentions, NotifyNone}; !slices.Contains(levels, s.Notifications.Level) {
+		fail("notifications.level", "unknown level %q; expected one of %s",
+			s.Notifications.Level, strings.Join(levels, ", "))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Returns whether the given string is a hex color (#rgb or #rrggbb) or an ANSI color number.
+func validColor(c string) bool {
+	if n, err := strconv.Atoi(c); err == nil {
+		return n >= 0 && n <= 255
+	}
+	if !strings.HasPrefix(c, "#") || (len(c) != 4 && len(c) != 7) {
+		return false
+	}
+	_, err := strconv.ParseUint(c[1:], 16, 32)
+	return err == nil
+}
+
+func knownKeys() string {
+	keys := make([]string, 0, len(options)+2)
+	for _, o := range options {
+		keys = append(keys, o.key)
+	}
+	return strings.Join(append(keys, "theme", "notifications"), ", ")
+}
+
+//#endregion helpers
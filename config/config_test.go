@@ -0,0 +1,177 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"revolt_tui/cfgdir"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// the layers of a load; files are given by content and are omitted if empty
+type layers struct {
+	system  []string // one file per directory of $XDG_CONFIG_DIRS, most important first
+	user    string
+	config  string // given by --config
+	profile string
+	env     map[string]string
+	args    []string // flags
+}
+
+// Writes the given layers into temporary directories and loads them.
+// Returns the settings, a replacer naming each file written as {system0}, {user}, {config} or
+// {profile}, and any error.
+func (l layers) load(t *testing.T) (Settings, *strings.Replacer, error) {
+	t.Helper()
+	// isolate from the environment running the tests
+	for _, o := range options {
+		t.Setenv(o.env(), "")
+		os.Unsetenv(o.env())
+	}
+	base := t.TempDir()
+	var placeholders []string
+	write := func(name, dir, content string) {
+		if content == "" {
+			return
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		p := filepath.Join(dir, baseName+".toml")
+		if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		placeholders = append(placeholders, "{"+name+"}", p)
+	}
+
+	var xdg []string
+	for i, content := range l.system {
+		dir := filepath.Join(base, "system", string(rune('a'+i)))
+		xdg = append(xdg, dir)
+		write("system"+string(rune('0'+i)), filepath.Join(dir, cfgdir.SubDirName), content)
+	}
+	if len(xdg) == 0 {
+		xdg = []string{filepath.Join(base, "system")}
+	}
+	t.Setenv("XDG_CONFIG_DIRS", strings.Join(xdg, string(filepath.ListSeparator)))
+
+	userDir, profileDir := filepath.Join(base, "user"), filepath.Join(base, "user", "profile")
+	write("user", userDir, l.user)
+	write("config", filepath.Join(base, "other"), l.config)
+	write("profile", profileDir, l.profile)
+	for k, v := range l.env {
+		t.Setenv(k, v)
+	}
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String(FileFlag, "", "")
+	for _, o := range options {
+		flags.String(o.flag, "", "")
+	}
+	args := l.args
+	if l.config != "" {
+		args = append(args, "--"+FileFlag+"="+filepath.Join(base, "other", baseName+".toml"))
+	}
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	s, _, err := load(flags, userDir, profileDir)
+	return s, strings.NewReplacer(placeholders...), err
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	const env = envPrefix + "TIMESTAMP_FORMAT"
+	file := func(layout string) string { return "timestamp_format = \"" + layout + "\"\n" }
+	tests := []struct {
+		name   string
+		layers layers
+		want   string
+	}{
+		{"defaults", layers{}, time.Stamp},
+		{"system", layers{system: []string{file("15:04 system")}}, "15:04 system"},
+		{"first system directory over later ones",
+			layers{system: []string{file("15:04 first"), file("15:04 second")}}, "15:04 first"},
+		{"user over system",
+			layers{system: []string{file("15:04 system")}, user: file("15:04 user")}, "15:04 user"},
+		{"--config in place of user",
+			layers{user: file("15:04 user"), config: file("15:04 config")}, "15:04 config"},
+		{"profile over user",
+			layers{user: file("15:04 user"), profile: file("15:04 profile")}, "15:04 profile"},
+		{"profile over --config",
+			layers{config: file("15:04 config"), profile: file("15:04 profile")}, "15:04 profile"},
+		{"profile not setting the key",
+			layers{user: file("15:04 user"), profile: "log_level = \"info\"\n"}, "15:04 user"},
+		{"environment over profile",
+			layers{profile: file("15:04 profile"), env: map[string]string{env: "15:04 env"}}, "15:04 env"},
+		{"flag over environment",
+			layers{env: map[string]string{env: "15:04 env"}, args: []string{"--timestamp-format=15:04 flag"}},
+			"15:04 flag"},
+		{"every layer",
+			layers{
+				system: []string{file("15:04 system")}, user: file("15:04 user"), profile: file("15:04 profile"),
+				env: map[string]string{env: "15:04 env"}, args: []string{"--timestamp-format=15:04 flag"},
+			}, "15:04 flag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, err := tt.layers.load(t)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if s.TimestampFormat != tt.want {
+				t.Errorf("timestamp_format = %q; want %q", s.TimestampFormat, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadErrorSources(t *testing.T) {
+	tests := []struct {
+		name   string
+		layers layers
+		want   []string // substrings of the error, with file placeholders; none if no error is expected
+	}{
+		{"user file", layers{user: "log_level = \"loud\"\n"}, []string{"log_level (from {user})"}},
+		{"system file", layers{system: []string{"[theme]\nError = \"red\"\n"}},
+			[]string{"theme.Error (from {system0})"}},
+		{"--config file", layers{config: "[notifications]\nlevel = \"some\"\n"},
+			[]string{"notifications.level (from {config})"}},
+		{"profile file", layers{user: "[theme]\nError = \"#fff\"\n", profile: "[theme]\nbogus = \"#fff\"\n"},
+			[]string{"theme.bogus (from {profile})"}},
+		{"environment", layers{env: map[string]string{envPrefix + "TIMESTAMP_FORMAT": "no fields"}},
+			[]string{"timestamp_format (from $" + envPrefix + "TIMESTAMP_FORMAT)"}},
+		{"flag", layers{user: "instance = \"ftp://example.com\"\n", args: []string{"--instance=gopher://x"}},
+			[]string{"instance (from --instance)"}},
+		{"latest layer named",
+			layers{user: "log_level = \"loud\"\n", profile: "log_level = \"louder\"\n"},
+			[]string{"log_level (from {profile})"}},
+		{"every problem reported",
+			layers{user: "log_level = \"loud\"\n", args: []string{"--credential-store=shoebox"}},
+			[]string{"log_level (from {user})", "credential_store (from --credential-store)"}},
+		{"fixed by a later layer",
+			layers{user: "log_level = \"loud\"\n", env: map[string]string{envPrefix + "LOG_LEVEL": "info"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, names, err := tt.layers.load(t)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("Load: unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Load: expected an error naming %v", tt.want)
+			}
+			for _, w := range tt.want {
+				if w = names.Replace(w); !strings.Contains(err.Error(), w) {
+					t.Errorf("Load: error does not contain %q: %v", w, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"io"
+	"path"
+	"path/filepath"
+	"revolt_tui/cfgdir"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/pflag"
+)
+
+/**
+ * This file watches the config files for changes, so the settings can be reloaded while running.
+ * Directories are watched rather than files, as editors commonly save by replacing the file (and so
+ * files that do not exist yet are noticed once created); events for other files are ignored.
+ * A burst of events (ex: a save made in several writes) triggers a single reload once it settles.
+ * Only the current account's profile is watched, so the watcher must be replaced on switching
+ * accounts.
+ */
+
+// how long the watched files must go unchanged before a change is reported
+const settleDelay = 250 * time.Millisecond
+
+// Watches every config file Load may read, plus the given extra files (ex: the keybindings file),
+// calling onChange (from another goroutine) after each change.
+// Close the returned watcher to stop watching.
+func Watch(flags *pflag.FlagSet, extra []string, onChange func()) (io.Closer, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	watched := make(map[string]bool) // files, by cleaned path
+	for _, f := range append(candidates(flags), extra...) {
+		if abs, err := filepath.Abs(f); err == nil {
+			watched[abs] = true
+		}
+	}
+	dirs := make(map[string]bool)
+	for f := range watched {
+		dir := filepath.Dir(f)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		// directories that do not exist cannot be watched; their files are never read either
+		_ = w.Add(dir)
+	}
+
+	go func() {
+		var settle *time.Timer
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if ev.Op == fsnotify.Chmod || !watched[filepath.Clean(ev.Name)] {
+					continue
+				}
+				if settle == nil {
+					settle = time.AfterFunc(settleDelay, onChange)
+				} else {
+					settle.Reset(settleDelay)
+				}
+			case _, ok := <-w.Errors:
+				// a dropped event only delays a reload until the next one
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+	return w, nil
+}
+
+// Returns every path Load may read a config file from, whether or not it exists.
+func candidates(flags *pflag.FlagSet) []string {
+	var dirs []string
+	for _, dir := range systemDirs() {
+		dirs = append(dirs, path.Join(dir, cfgdir.SubDirName))
+	}
+	var files []string
+	if user, _ := flags.GetString(FileFlag); user != "" {
+		files = append(files, user)
+	} else {
+		dirs = append(dirs, cfgdir.Get())
+	}
+	if profile := cfgdir.Profile(); profile != cfgdir.Get() {
+		dirs = append(dirs, profile)
+	}
+	for _, dir := range dirs {
+		for _, ext := range extensions {
+			files = append(files, path.Join(dir, baseName+ext))
+		}
+	}
+	return files
+}
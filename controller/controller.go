@@ -3,15 +3,22 @@
 package controller
 
 import (
+	"errors"
 	"revolt_tui/broker"
+	"revolt_tui/credentials"
+	"revolt_tui/keys"
 	"revolt_tui/log"
 	"revolt_tui/modes"
+	"revolt_tui/stylesheet/colors"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 )
 
 type controller struct {
 	quitting   bool
+	showHelp   bool
 	mode       modes.Mode
 	curAction  modes.Action
 	initialCmd tea.Cmd
@@ -49,41 +56,109 @@ func (ctl controller) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	if ctl.quitting {
 		return ctl, nil
 	}
-	// always handle kill keys, no matter the mode
+	// always handle kill and help keys, no matter the mode
 	if keyMsg, ok := msg.(tea.KeyMsg); ok {
-		// check for CTRL+C
-		if keyMsg.Type == tea.KeyCtrlC {
+		if keys.Matches(keyMsg, keys.Quit) {
 			// clean up is handled by the program that originally initialized this model
 			ctl.quitting = true
 			return ctl, tea.Quit
 		}
+		if keys.Matches(keyMsg, keys.Help) {
+			ctl.showHelp = !ctl.showHelp
+			return ctl, nil
+		}
+		if keys.Matches(keyMsg, keys.Accounts) && ctl.mode != modes.Login && ctl.mode != modes.AccountSelection {
+			return ctl.changeMode(modes.AccountSelection)
+		}
 	}
 
-	// capture window size
+	// capture window size; modes are only given the space above the status bar
 	if WSMsg, ok := msg.(tea.WindowSizeMsg); ok {
 		broker.SetDimensions(WSMsg.Width, WSMsg.Height)
+		WSMsg.Height = broker.Height()
+		msg = WSMsg
+	}
+
+	// apply reloaded settings before the mode redraws with them
+	if cfgMsg, ok := msg.(broker.ConfigChangedMsg); ok {
+		applyConfig(cfgMsg)
 	}
 
 	var cmd tea.Cmd = ctl.curAction.Update(msg)
 
-	// check for a mode change
-	if chg, newMode := ctl.curAction.ChangeMode(); chg {
-		ctl.mode = newMode
-		// fetch the action associated to the new mode
-		ctl.curAction = modes.Get(ctl.mode)
-		if success, init := ctl.curAction.Enter(); !success {
-			// failure, dying...
-			ctl.quitting = true
-			return ctl, tea.Quit
-		} else {
-			return ctl, init
-		}
+	// check for a mode change; a rejected token forces a new login from any mode
+	chg, newMode := ctl.curAction.ChangeMode()
+	if _, ok := msg.(broker.SessionInvalidatedMsg); ok && ctl.mode != modes.Login {
+		chg, newMode = true, modes.Login
+	}
+	if chg {
+		return ctl.changeMode(newMode)
 	}
 	return ctl, cmd
 }
 
+// Composes the active mode's view (or the help view) above the status bar.
 func (ctl controller) View() string {
-	return ctl.curAction.View()
+	var content string
+	if ctl.showHelp {
+		content = keys.HelpView(ctl.curAction.KeyScopes()...) +
+			"\n\nPress " + keys.Get(keys.Help).Help().Key + " to close help."
+	} else {
+		content = ctl.curAction.View()
+	}
+	// pin the status bar to the bottom of the terminal
+	content = lipgloss.NewStyle().Height(broker.Height()).MaxHeight(broker.Height()).Render(content)
+	return content + "\n" + statusBar(broker.Width())
 }
 
 //#endregion
+
+// Switches to and enters the given mode.
+func (ctl controller) changeMode(newMode modes.Mode) (tea.Model, tea.Cmd) {
+	ctl.mode = newMode
+	// fetch the action associated to the new mode
+	ctl.curAction = modes.Get(ctl.mode)
+	if success, init := ctl.curAction.Enter(); !success {
+		// failure, dying...
+		ctl.quitting = true
+		return ctl, tea.Quit
+	} else {
+		return ctl, init
+	}
+}
+
+// Puts reloaded settings into effect, or reports why they could not be.
+// Settings only read on startup are noted as taking effect on restart.
+func applyConfig(msg broker.ConfigChangedMsg) {
+	if msg.Err != nil {
+		log.Writer.Warn("rejected config change", "error", msg.Err)
+		// the status bar is a single line
+		broker.PostError(errors.New("config not reloaded: " + strings.ReplaceAll(msg.Err.Error(), "\n", "; ")))
+		return
+	}
+	prev, s := broker.Settings(), msg.Settings
+	broker.SetSettings(s)
+	colors.Apply(s.Theme)
+	if err := log.SetLevel(s.LogLevel); err != nil {
+		log.Writer.Warn("failed to change log level", "error", err)
+	}
+	if s.SessionName != "" {
+		credentials.FriendlyName = s.SessionName
+	}
+
+	var restart []string
+	if s.CredentialStore != prev.CredentialStore {
+		restart = append(restart, "credential_store")
+	}
+	if s.Instance != prev.Instance {
+		restart = append(restart, "instance")
+	}
+	switch len(restart) {
+	case 0:
+		broker.PostNotice("reloaded config")
+	case 1:
+		broker.PostNotice("reloaded config; " + restart[0] + " takes effect on restart")
+	default:
+		broker.PostNotice("reloaded config; " + strings.Join(restart, " and ") + " take effect on restart")
+	}
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"fmt"
+	"revolt_tui/broker"
+	"revolt_tui/stylesheet/colors"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+/**
+ * This file draws the status bar displayed beneath every mode.
+ */
+
+var (
+	statusBarStyle, statusErrorStyle, statusNoticeStyle lipgloss.Style
+
+	connectionStyles map[broker.ConnState]lipgloss.Style
+)
+
+func init() {
+	colors.OnChange(func() {
+		statusBarStyle = lipgloss.NewStyle().Background(colors.StatusBarBackground).Foreground(colors.StatusBarForeground)
+		statusErrorStyle = statusBarStyle.Copy().Foreground(colors.Error).Bold(true)
+		statusNoticeStyle = statusBarStyle.Copy().Foreground(colors.Connected)
+
+		connectionStyles = map[broker.ConnState]lipgloss.Style{
+			broker.Offline:      statusBarStyle.Copy().Foreground(colors.Error),
+			broker.Connecting:   statusBarStyle.Copy().Foreground(colors.MessageTimestamp),
+			broker.Connected:    statusBarStyle.Copy().Foreground(colors.Connected),
+			broker.Reconnecting: statusBarStyle.Copy().Foreground(colors.Warning),
+		}
+	})
+}
+
+const statusSeparator string = " │ "
+
+// Draws the status bar across the given width.
+// The left side holds the connection state, user, location, and any segments published by modes;
+// the right side holds unread totals or, if one was recently posted, an error.
+func statusBar(width int) string {
+	state := broker.Connection()
+	left := []string{connectionStyles[state].Render("● " + state.String())}
+
+	if self := broker.Self(); self != nil {
+		left = append(left, statusBarStyle.Render(self.Username))
+	}
+	if svr := broker.GetCurrentServer(); svr != nil {
+		loc := svr.Name
+		if ch := broker.GetCurrentChannel(); ch != nil {
+			loc += " › #" + ch.Name
+		}
+		left = append(left, statusBarStyle.Render(loc))
+	}
+	for _, seg := range broker.StatusSegments() {
+		left = append(left, statusBarStyle.Render(seg))
+	}
+	l := strings.Join(left, statusBarStyle.Render(statusSeparator))
+
+	var r string
+	if err := broker.StatusError(); err != nil {
+		r = statusErrorStyle.Render("✗ " + err.Error())
+	} else if n := broker.StatusNotice(); n != "" {
+		r = statusNoticeStyle.Render("✓ " + n)
+	} else if n := broker.UnreadTotal(); n > 0 {
+		r = statusBarStyle.Render(fmt.Sprintf("%d unread", n))
+	}
+
+	// pad between the two sides, truncating the left if the bar would overflow
+	gap := width - lipgloss.Width(l) - lipgloss.Width(r)
+	if gap < 1 {
+		l = lipgloss.NewStyle().MaxWidth(max(width-lipgloss.Width(r)-1, 0)).Render(l)
+		gap = max(width-lipgloss.Width(l)-lipgloss.Width(r), 0)
+	}
+	return l + statusBarStyle.Render(strings.Repeat(" ", gap)) + r
+}
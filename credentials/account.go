@@ -0,0 +1,353 @@
+package credentials
+
+import (
+	"errors"
+	"revolt_tui/api"
+	"revolt_tui/instance"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sentinelb51/revoltgo"
+)
+
+/**
+ * This file handles the account forms reachable from the login form: creating an account, resending
+ * the verification email, and resetting a forgotten password (requesting a token by email, then
+ * setting a new password with it).
+ * Each form is a list of fields. Errors Revolt attributes to a field are shown beneath it; others are
+ * shown beneath the form. Instances requiring a captcha cannot be served here, so those forms are
+ * disabled on such instances.
+ */
+
+const minPasswordLength int = 8
+
+// field keys, shared by every form
+const (
+	fieldEmail    = "email"
+	fieldPassword = "password"
+	fieldConfirm  = "confirm"
+	fieldInvite   = "invite"
+	fieldToken    = "token"
+)
+
+type field struct {
+	key, label string
+	input      textinput.Model
+	err        string
+}
+
+type accountForm struct {
+	title  string
+	fields []field
+	focus  int
+	submit func(f *accountForm) tea.Cmd // validates the fields, returning the request to make (or nil)
+}
+
+// returned when a form's request completes
+type formResultMsg struct {
+	stage stage
+	email string // of the account the form concerned, if known
+	err   error
+}
+
+//#region forms
+
+// Opens the form of the given stage, prefilling any email field with the given email.
+// Forms that Revolt guards with a captcha are refused on instances that enable it.
+func (m Model) openForm(s stage, email string) (tea.Model, tea.Cmd) {
+	if s != resetStage && instance.Current().Captcha {
+		m.inputErr = "this instance requires a captcha, which RevoltTUI cannot display; please use " +
+			"the web app"
+		if app := instance.Current().App; app != "" {
+			m.inputErr += " (" + app + ")"
+		}
+		m.inputErr += " instead"
+		return m, nil
+	}
+	var f accountForm
+	switch s {
+	case registerStage:
+		f = accountForm{title: "Create an account", submit: submitRegister}
+		f.add(fieldEmail, "Email", email, false)
+		f.add(fieldPassword, "Password", "", true)
+		f.add(fieldConfirm, "Confirm password", "", true)
+		if instance.Current().InviteOnly {
+			f.add(fieldInvite, "Invite code", "", false)
+		}
+	case reverifyStage:
+		f = accountForm{title: "Resend the verification email", submit: submitReverify}
+		f.add(fieldEmail, "Email", email, false)
+	case forgotStage:
+		f = accountForm{title: "Reset your password", submit: submitForgot}
+		f.add(fieldEmail, "Email", email, false)
+	case resetStage:
+		f = accountForm{title: "Choose a new password", submit: submitReset}
+		f.add(fieldToken, "Reset token (from the email)", "", false)
+		f.add(fieldPassword, "New password", "", true)
+		f.add(fieldConfirm, "Confirm password", "", true)
+	}
+	m.stage, m.form = s, f
+	return m, m.form.setFocus(0)
+}
+
+func submitRegister(f *accountForm) tea.Cmd {
+	email, password, invite := f.value(fieldEmail), f.value(fieldPassword), f.value(fieldInvite)
+	if !f.requireEmail() || !f.requireNewPassword() {
+		return nil
+	}
+	if f.has(fieldInvite) && invite == "" {
+		f.setErr(fieldInvite, "this instance requires an invite")
+		return nil
+	}
+	return func() tea.Msg {
+		err := api.CreateAccount(anonymous(), email, password, invite)
+		return formResultMsg{stage: registerStage, email: email, err: err}
+	}
+}
+
+func submitReverify(f *accountForm) tea.Cmd {
+	email := f.value(fieldEmail)
+	if !f.requireEmail() {
+		return nil
+	}
+	return func() tea.Msg {
+		err := api.ResendVerification(anonymous(), email)
+		return formResultMsg{stage: reverifyStage, email: email, err: err}
+	}
+}
+
+func submitForgot(f *accountForm) tea.Cmd {
+	email := f.value(fieldEmail)
+	if !f.requireEmail() {
+		return nil
+	}
+	return func() tea.Msg {
+		err := api.RequestPasswordReset(anonymous(), email)
+		return formResultMsg{stage: forgotStage, email: email, err: err}
+	}
+}
+
+func submitReset(f *accountForm) tea.Cmd {
+	token, password := f.value(fieldToken), f.value(fieldPassword)
+	if token == "" {
+		f.setErr(fieldToken, "the token emailed to you is required")
+		return nil
+	}
+	if !f.requireNewPassword() {
+		return nil
+	}
+	return func() tea.Msg {
+		err := api.ResetPassword(anonymous(), token, password, false)
+		return formResultMsg{stage: resetStage, err: err}
+	}
+}
+
+//#endregion forms
+
+// Handles input on an account form.
+// Tab and the arrow keys move between fields, enter submits, and escape returns to the login form.
+// On the password reset request form, ctrl+t skips to entering a token already received.
+func (m Model) updateForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.stage, m.form = credentialStage, accountForm{}
+		return m, m.focusCredentials()
+	case tea.KeyTab, tea.KeyDown:
+		return m, m.form.setFocus(m.form.focus + 1)
+	case tea.KeyShiftTab, tea.KeyUp:
+		return m, m.form.setFocus(m.form.focus - 1)
+	case tea.KeyCtrlT:
+		if m.stage == forgotStage {
+			return m.openForm(resetStage, "")
+		}
+	case tea.KeyEnter:
+		m.form.clearErrs()
+		cmd := m.form.submit(&m.form)
+		if cmd == nil {
+			m.inputErr = "please correct the fields above"
+			return m, nil
+		}
+		m.busy = true
+		return m, cmd
+	}
+	var cmd tea.Cmd
+	m.form.fields[m.form.focus].input, cmd = m.form.fields[m.form.focus].input.Update(msg)
+	return m, cmd
+}
+
+// Handles the result of a form's request, moving on to the next step or reporting the failure.
+func (m Model) onFormResult(msg formResultMsg) (tea.Model, tea.Cmd) {
+	m.busy = false
+	if msg.err != nil {
+		if !m.form.attribute(msg.err) {
+			m.inputErr = msg.err.Error()
+		}
+		return m, nil
+	}
+
+	switch msg.stage {
+	case registerStage:
+		m.emailTI.SetValue(msg.email)
+		m.passTI.Reset()
+		m.stage = credentialStage
+		if instance.Current().VerifyEmails {
+			m.notice = "account created; follow the link emailed to " + msg.email + ", then log in"
+		} else {
+			m.notice = "account created; you may now log in"
+		}
+		return m, m.focusCredentials()
+	case reverifyStage:
+		m.unverified = false
+		m.stage = credentialStage
+		m.notice = "verification email sent; follow its link, then log in"
+		return m, m.focusCredentials()
+	case forgotStage:
+		mdl, cmd := m.openForm(resetStage, "")
+		m = mdl.(Model)
+		m.notice = "a reset token was emailed to " + msg.email
+		return m, cmd
+	case resetStage:
+		m.stage = credentialStage
+		m.passTI.Reset()
+		m.notice = "password changed; you may now log in"
+		return m, m.focusCredentials()
+	}
+	return m, nil
+}
+
+func (f accountForm) View() string {
+	var sb strings.Builder
+	sb.WriteString(f.title + "\n\n")
+	for _, fld := range f.fields {
+		sb.WriteString(fld.label + fld.input.View() + "\n")
+		if fld.err != "" {
+			sb.WriteString("  " + fld.err + "\n")
+		}
+	}
+	return sb.String()
+}
+
+//#region field helpers
+
+func (f *accountForm) add(key, label, value string, secret bool) {
+	ti := textinput.New()
+	ti.SetValue(value)
+	if secret {
+		ti.EchoMode = textinput.EchoPassword
+	}
+	f.fields = append(f.fields, field{key: key, label: label, input: ti})
+}
+
+// Focuses the field at the given index, wrapping around.
+func (f *accountForm) setFocus(i int) tea.Cmd {
+	if len(f.fields) == 0 {
+		return nil
+	}
+	f.fields[f.focus].input.Blur()
+	f.focus = (i + len(f.fields)) % len(f.fields)
+	return f.fields[f.focus].input.Focus()
+}
+
+func (f *accountForm) index(key string) int {
+	return slices.IndexFunc(f.fields, func(fld field) bool { return fld.key == key })
+}
+
+func (f *accountForm) has(key string) bool {
+	return f.index(key) >= 0
+}
+
+// Returns the trimmed value of the given field (unless it is a password); "" if there is no such
+// field.
+func (f *accountForm) value(key string) string {
+	i := f.index(key)
+	if i < 0 {
+		return ""
+	}
+	if f.fields[i].input.EchoMode == textinput.EchoPassword {
+		return f.fields[i].input.Value()
+	}
+	return strings.TrimSpace(f.fields[i].input.Value())
+}
+
+func (f *accountForm) setErr(key, msg string) {
+	if i := f.index(key); i >= 0 {
+		f.fields[i].err = msg
+	}
+}
+
+func (f *accountForm) clearErrs() {
+	for i := range f.fields {
+		f.fields[i].err = ""
+	}
+}
+
+func (f *accountForm) requireEmail() bool {
+	if email := f.value(fieldEmail); email == "" || !strings.Contains(email, "@") {
+		f.setErr(fieldEmail, "a valid email address is required")
+		return false
+	}
+	return true
+}
+
+func (f *accountForm) requireNewPassword() bool {
+	switch password := f.value(fieldPassword); {
+	case len(password) < minPasswordLength:
+		f.setErr(fieldPassword, "passwords must be at least 8 characters")
+		return false
+	case password != f.value(fieldConfirm):
+		f.setErr(fieldConfirm, "passwords do not match")
+		return false
+	}
+	return true
+}
+
+// Attributes the given error to the field it concerns, if it is one Revolt attributes to a field.
+// Returns whether it was attributed.
+func (f *accountForm) attribute(err error) bool {
+	var apiErr *api.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for key, types := range map[string][]string{
+		fieldEmail:    api.EmailErrors,
+		fieldPassword: api.PasswordErrors,
+		fieldInvite:   api.InviteErrors,
+		fieldToken:    api.TokenErrors,
+	} {
+		if slices.Contains(types, apiErr.Type) && f.has(key) {
+			f.setErr(key, describe(apiErr.Type))
+			return true
+		}
+	}
+	return false
+}
+
+//#endregion field helpers
+
+// user-facing descriptions of the account errors Revolt returns
+var errDescriptions = map[string]string{
+	"InvalidEmail":        "this email address is not accepted",
+	"EmailInUse":          "an account already uses this email address",
+	"Blacklisted":         "this email provider is not accepted",
+	"UnknownUser":         "no account uses this email address",
+	"ShortPassword":       "this password is too short",
+	"CompromisedPassword": "this password is known to be compromised; choose another",
+	"InvalidPassword":     "this password is not accepted",
+	"MissingInvite":       "this instance requires an invite",
+	"InvalidInvite":       "this invite is not valid",
+	"InvalidToken":        "this token is not valid or has expired",
+}
+
+func describe(errType string) string {
+	if d, ok := errDescriptions[errType]; ok {
+		return d
+	}
+	return errType
+}
+
+// Returns an unauthenticated session for the current instance.
+func anonymous() *revoltgo.Session {
+	return instance.NewSession(instance.Current().API, "")
+}
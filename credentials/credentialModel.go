@@ -1,7 +1,11 @@
 package credentials
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"revolt_tui/api"
+	"revolt_tui/instance"
 	"revolt_tui/log"
 	"strings"
 
@@ -17,12 +21,40 @@ const (
 	pass
 )
 
+// the step of the login flow being displayed
+type stage uint8
+
+const (
+	credentialStage stage = iota
+	mfaStage              // see mfa.go
+	// account forms; see account.go
+	registerStage
+	reverifyStage
+	forgotStage
+	resetStage
+)
+
+// Name given to the sessions created by logging in, as listed among the account's sessions.
+// Defaults to naming the host.
+var FriendlyName string = defaultFriendlyName()
+
 type Model struct {
 	Killed          bool
 	emailTI, passTI textinput.Model
 	sel             selected
 	Session         *revoltgo.Session
-	inputErr        string
+	// of the account and session logged in to, once Session is set
+	UserID, Email, SessionID string
+	inputErr                 string
+	notice                   string
+
+	stage      stage
+	busy       bool // a request is in flight
+	unverified bool // the last attempt failed as the account's email is unverified
+	embedded   bool // hosted by a running program (see ReloginModel), so must not quit it
+
+	mfa  mfaStep
+	form accountForm // of the account form being displayed, if any
 }
 
 func InitialModel() Model {
@@ -36,6 +68,27 @@ func InitialModel() Model {
 	return cm
 }
 
+// Returns a model for logging in again from within the running program, after the session's token
+// was rejected.
+// Rather than quitting, it sets Session or Killed and leaves the host to act on them.
+func ReloginModel(notice string) Model {
+	cm := InitialModel()
+	cm.embedded = true
+	cm.notice = notice
+	return cm
+}
+
+// returned when a login request (of either step) completes
+type loginResultMsg struct {
+	result *api.LoginResult
+	err    error
+}
+
+// returned when a request to resend the verification email completes
+type reverifyMsg struct {
+	err error
+}
+
 //#region tea.Model implementation
 
 func (m Model) Init() tea.Cmd {
@@ -43,33 +96,66 @@ func (m Model) Init() tea.Cmd {
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	// check for special keys
-	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+	switch msg := msg.(type) {
+	case loginResultMsg:
+		return m.onLoginResult(msg)
+	case reverifyMsg:
+		m.busy = false
+		if msg.err != nil {
+			m.inputErr = "failed to resend verification email: " + msg.err.Error()
+		} else {
+			m.unverified = false
+			m.notice = "verification email sent; follow its link, then log in"
+		}
+		return m, nil
+	case formResultMsg:
+		return m.onFormResult(msg)
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			m.Killed = true
+			return m, m.quit()
+		}
+		if m.busy {
+			return m, nil
+		}
 		// clear a preexisting error
-		m.inputErr = ""
-		switch keyMsg.Type {
+		m.inputErr, m.notice = "", ""
+		if m.stage == mfaStage {
+			return m.updateMFA(msg)
+		} else if m.stage >= registerStage {
+			return m.updateForm(msg)
+		}
+		switch msg.Type {
 		case tea.KeyTab, tea.KeyUp, tea.KeyDown:
 			return m, m.switchSelected()
-		case tea.KeyCtrlC, tea.KeyEsc:
+		case tea.KeyEsc:
 			m.Killed = true
-			return m, tea.Quit
+			return m, m.quit()
+		case tea.KeyCtrlR:
+			if m.unverified {
+				m.busy = true
+				return m, reverify(strings.TrimSpace(m.emailTI.Value()))
+			}
+			return m.openForm(reverifyStage, strings.TrimSpace(m.emailTI.Value()))
+		case tea.KeyCtrlN:
+			return m.openForm(registerStage, strings.TrimSpace(m.emailTI.Value()))
+		case tea.KeyCtrlF:
+			return m.openForm(forgotStage, strings.TrimSpace(m.emailTI.Value()))
 		case tea.KeyEnter:
 			// attempt to login
-			sess, lr, err := revoltgo.NewWithLogin(revoltgo.LoginData{
-				Email:        strings.TrimSpace(m.emailTI.Value()),
-				Password:     m.passTI.Value(),
-				FriendlyName: "TUIFriendly", // TODO
-			})
-			if err != nil {
-				log.Writer.Error("login failed", "error", err)
-				m.inputErr = err.Error()
-				return m, textinput.Blink
-			}
-			log.Writer.Debug("completed login attempt", "loginResponse", lr)
-			m.Session = sess
-			return m, tea.Quit
+			m.busy = true
+			return m, login(strings.TrimSpace(m.emailTI.Value()), m.passTI.Value())
 		}
+	}
 
+	if m.stage == mfaStage {
+		var cmd tea.Cmd
+		m.mfa.input, cmd = m.mfa.input.Update(msg)
+		return m, cmd
+	} else if m.stage >= registerStage {
+		var cmd tea.Cmd
+		m.form.fields[m.form.focus].input, cmd = m.form.fields[m.form.focus].input.Update(msg)
+		return m, cmd
 	}
 
 	var cmd tea.Cmd
@@ -82,8 +168,34 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m Model) View() string {
-	return fmt.Sprintf("Email%v\nPassword%v\n%s\n",
-		m.emailTI.View(), m.passTI.View(), m.inputErr)
+	var status string
+	switch {
+	case m.busy && m.stage >= registerStage:
+		status = "working..."
+	case m.busy:
+		status = "logging in..."
+	case m.inputErr != "":
+		status = m.inputErr
+	default:
+		status = m.notice
+	}
+	if m.stage == mfaStage {
+		return m.mfa.View() + status + "\n"
+	} else if m.stage >= registerStage {
+		hint := "enter to submit, esc to return to logging in"
+		if m.stage == forgotStage {
+			hint += ", ctrl+t if you already have a reset token"
+		}
+		return m.form.View() + status + "\n\n" + hint + "\n"
+	}
+	if m.unverified && !m.busy {
+		status += "\nPress ctrl+r to resend the verification email."
+	} else if !m.busy {
+		status += "\n\nctrl+n to create an account, ctrl+f if you forgot your password, " +
+			"ctrl+r to resend a verification email"
+	}
+	return fmt.Sprintf("Logging in to %s\n\nEmail%v\nPassword%v\n%s\n",
+		instance.Host(instance.Current().API), m.emailTI.View(), m.passTI.View(), status)
 }
 
 //#endregion
@@ -98,3 +210,77 @@ func (m *Model) switchSelected() tea.Cmd {
 	m.sel = email
 	return m.emailTI.Focus()
 }
+
+// Refocuses the selected input of the credential stage.
+func (m *Model) focusCredentials() tea.Cmd {
+	if m.sel == email {
+		m.passTI.Blur()
+		return m.emailTI.Focus()
+	}
+	m.emailTI.Blur()
+	return m.passTI.Focus()
+}
+
+// Quits the program, unless the model is embedded in another.
+func (m *Model) quit() tea.Cmd {
+	if m.embedded {
+		return nil
+	}
+	return tea.Quit
+}
+
+// Handles the result of either login step, completing the login, requesting a second factor, or
+// reporting the failure.
+func (m Model) onLoginResult(msg loginResultMsg) (tea.Model, tea.Cmd) {
+	m.busy = false
+	if msg.err != nil {
+		log.Writer.Error("login failed", "error", msg.err)
+		var apiErr *api.Error
+		if errors.As(msg.err, &apiErr) && apiErr.Type == api.ErrUnverifiedAccount {
+			m.unverified = true
+			m.inputErr = "your email address has not been verified"
+			return m, nil
+		}
+		m.inputErr = msg.err.Error()
+		return m, textinput.Blink
+	}
+
+	lr := msg.result
+	log.Writer.Debug("completed login attempt", "result", lr.Result, "user ID", lr.UserID)
+	switch lr.Result {
+	case api.LoginSuccess:
+		m.Session = instance.NewSession(instance.Current().API, lr.Token)
+		m.UserID, m.Email, m.SessionID = lr.UserID, strings.TrimSpace(m.emailTI.Value()), lr.SessionID
+		return m, m.quit()
+	case api.LoginMFA:
+		m.stage = mfaStage
+		m.mfa = newMFAStep(lr.Ticket, lr.AllowedMethods)
+		return m, m.mfa.input.Focus()
+	case api.LoginDisabled:
+		m.inputErr = "this account has been disabled"
+	default:
+		m.inputErr = "unexpected login result: " + lr.Result
+	}
+	return m, nil
+}
+
+func login(email, password string) tea.Cmd {
+	return func() tea.Msg {
+		lr, err := api.Login(instance.NewSession(instance.Current().API, ""), email, password, FriendlyName)
+		return loginResultMsg{result: lr, err: err}
+	}
+}
+
+func reverify(email string) tea.Cmd {
+	return func() tea.Msg {
+		return reverifyMsg{err: api.ResendVerification(anonymous(), email)}
+	}
+}
+
+func defaultFriendlyName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "RevoltTUI"
+	}
+	return "RevoltTUI on " + host
+}
@@ -0,0 +1,111 @@
+package credentials
+
+import (
+	"revolt_tui/api"
+	"revolt_tui/instance"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+/**
+ * This file handles the second step of logging in to an account with multi-factor authentication.
+ * Revolt returns a ticket and the methods the account accepts; the user picks a method, enters its
+ * code, and the ticket is exchanged for a session token.
+ */
+
+type mfaStep struct {
+	ticket  string
+	methods []api.MFAMethod
+	method  int // index into methods
+	input   textinput.Model
+}
+
+// user-facing names of each method's input
+var mfaMethodNames = map[api.MFAMethod]string{
+	api.MFATotp:     "Authenticator code",
+	api.MFARecovery: "Recovery code",
+	api.MFAPassword: "Password",
+}
+
+func newMFAStep(ticket string, methods []api.MFAMethod) mfaStep {
+	// prefer codes from an authenticator app, where available
+	step := mfaStep{ticket: ticket, methods: methods, input: textinput.New()}
+	for i, m := range methods {
+		if m == api.MFATotp {
+			step.method = i
+		}
+	}
+	step.prepareInput()
+	return step
+}
+
+// Handles input on the MFA step.
+// Tab cycles the method, enter submits the code, and escape returns to the credentials step.
+func (m Model) updateMFA(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.stage = credentialStage
+		m.mfa = mfaStep{}
+		return m, nil
+	case tea.KeyTab, tea.KeyShiftTab:
+		if len(m.mfa.methods) > 1 {
+			m.mfa.method = (m.mfa.method + 1) % len(m.mfa.methods)
+			m.mfa.prepareInput()
+		}
+		return m, nil
+	case tea.KeyEnter:
+		code := strings.TrimSpace(m.mfa.input.Value())
+		if code == "" || len(m.mfa.methods) == 0 {
+			return m, nil
+		}
+		m.busy = true
+		ticket, method := m.mfa.ticket, m.mfa.methods[m.mfa.method]
+		return m, func() tea.Msg {
+			lr, err := api.LoginWithMFA(instance.NewSession(instance.Current().API, ""), ticket, method, code, FriendlyName)
+			return loginResultMsg{result: lr, err: err}
+		}
+	}
+	var cmd tea.Cmd
+	m.mfa.input, cmd = m.mfa.input.Update(msg)
+	return m, cmd
+}
+
+// Resets the input for the selected method.
+func (s *mfaStep) prepareInput() {
+	s.input.Reset()
+	s.input.EchoMode = textinput.EchoNormal
+	if len(s.methods) > 0 && s.methods[s.method] == api.MFAPassword {
+		s.input.EchoMode = textinput.EchoPassword
+	}
+}
+
+func (s mfaStep) View() string {
+	if len(s.methods) == 0 {
+		return "Multi-factor authentication is required, but Revolt offered no methods. Press esc to go back.\n"
+	}
+	var sb strings.Builder
+	sb.WriteString("Multi-factor authentication is required.\n")
+	if len(s.methods) > 1 {
+		var names []string
+		for i, m := range s.methods {
+			name := mfaMethodNames[m]
+			if name == "" {
+				name = string(m)
+			}
+			if i == s.method {
+				name = "[" + name + "]"
+			}
+			names = append(names, name)
+		}
+		sb.WriteString("Method (tab to change): " + strings.Join(names, " ") + "\n")
+	}
+	label := mfaMethodNames[s.methods[s.method]]
+	if label == "" {
+		label = string(s.methods[s.method])
+	}
+	sb.WriteString(label + s.input.View() + "\n")
+	sb.WriteString("Enter to verify, esc to go back.\n")
+	return sb.String()
+}
@@ -0,0 +1,93 @@
+package credentials
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+/**
+ * This file implements the prompt for the passphrase protecting the encrypted token file.
+ * When the file is new, the passphrase must be entered twice.
+ * When the last passphrase given was wrong, the prompt says so.
+ */
+
+type PassphraseModel struct {
+	Killed     bool
+	Passphrase string // set once entered (and confirmed)
+
+	confirm       bool // ask for the passphrase a second time?
+	first, second textinput.Model
+	onSecond      bool
+	inputErr      string
+}
+
+func NewPassphraseModel(confirm, retry bool) PassphraseModel {
+	pm := PassphraseModel{confirm: confirm, first: textinput.New(), second: textinput.New()}
+	if retry {
+		pm.inputErr = "incorrect passphrase; try again"
+	}
+	pm.first.EchoMode, pm.second.EchoMode = textinput.EchoPassword, textinput.EchoPassword
+	pm.first.Focus()
+	return pm
+}
+
+//#region tea.Model implementation
+
+func (pm PassphraseModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (pm PassphraseModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		pm.inputErr = ""
+		switch keyMsg.Type {
+		case tea.KeyCtrlC, tea.KeyEsc:
+			pm.Killed = true
+			return pm, tea.Quit
+		case tea.KeyEnter:
+			if pm.first.Value() == "" {
+				pm.inputErr = "a passphrase is required"
+				return pm, nil
+			}
+			if !pm.confirm {
+				pm.Passphrase = pm.first.Value()
+				return pm, tea.Quit
+			}
+			if !pm.onSecond {
+				pm.onSecond = true
+				pm.first.Blur()
+				return pm, pm.second.Focus()
+			}
+			if pm.first.Value() != pm.second.Value() {
+				pm.inputErr = "passphrases do not match"
+				pm.first.Reset()
+				pm.second.Reset()
+				pm.second.Blur()
+				pm.onSecond = false
+				return pm, pm.first.Focus()
+			}
+			pm.Passphrase = pm.first.Value()
+			return pm, tea.Quit
+		}
+	}
+
+	var cmd tea.Cmd
+	if pm.onSecond {
+		pm.second, cmd = pm.second.Update(msg)
+	} else {
+		pm.first, cmd = pm.first.Update(msg)
+	}
+	return pm, cmd
+}
+
+func (pm PassphraseModel) View() string {
+	if !pm.confirm {
+		return fmt.Sprintf("Passphrase for the token file%v\n%s\n", pm.first.View(), pm.inputErr)
+	}
+	return fmt.Sprintf("Choose a passphrase to encrypt your token\nPassphrase%v\nConfirm%v\n%s\n",
+		pm.first.View(), pm.second.View(), pm.inputErr)
+}
+
+//#endregion
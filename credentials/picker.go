@@ -0,0 +1,97 @@
+package credentials
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+/**
+ * This file implements the account picker, shown at startup when several accounts are known and
+ * hosted by the accounts mode to switch between them.
+ * The final entry adds another account.
+ */
+
+type PickerModel struct {
+	Killed bool
+	Chosen bool // set once an entry is selected
+	Choice int  // index of the selected account; len(names) if adding an account
+
+	names    []string
+	current  int // index of the account in use; -1 if none
+	cursor   int
+	embedded bool // hosted by a running program, so must not quit it
+}
+
+// Returns a picker over the given account names, with the cursor on the given account.
+func NewPickerModel(names []string, selected int) PickerModel {
+	return PickerModel{names: names, current: -1, cursor: max(selected, 0)}
+}
+
+// Returns a picker for use within the running program, marking the account in use.
+// Rather than quitting, it sets Chosen or Killed and leaves the host to act on them; a chosen picker
+// may be reused after clearing Chosen.
+func EmbeddedPickerModel(names []string, current int) PickerModel {
+	pm := NewPickerModel(names, current)
+	pm.current, pm.embedded = current, true
+	return pm
+}
+
+//#region tea.Model implementation
+
+func (pm PickerModel) Init() tea.Cmd {
+	return nil
+}
+
+func (pm PickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return pm, nil
+	}
+	switch keyMsg.String() {
+	case "ctrl+c", "esc":
+		pm.Killed = true
+		return pm, pm.quit()
+	case "up", "k", "shift+tab":
+		pm.cursor = (pm.cursor + len(pm.names)) % (len(pm.names) + 1)
+	case "down", "j", "tab":
+		pm.cursor = (pm.cursor + 1) % (len(pm.names) + 1)
+	case "enter":
+		pm.Chosen, pm.Choice = true, pm.cursor
+		return pm, pm.quit()
+	}
+	return pm, nil
+}
+
+func (pm PickerModel) View() string {
+	var sb strings.Builder
+	sb.WriteString("Choose an account\n\n")
+	for i := range len(pm.names) + 1 {
+		name := "Add an account"
+		if i < len(pm.names) {
+			name = pm.names[i]
+		}
+		if i == pm.cursor {
+			sb.WriteString("> ")
+		} else {
+			sb.WriteString("  ")
+		}
+		sb.WriteString(name)
+		if i == pm.current {
+			sb.WriteString(" (current)")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\nenter to select, esc to cancel\n")
+	return sb.String()
+}
+
+//#endregion
+
+// Quits the program, unless the model is embedded in another.
+func (pm *PickerModel) quit() tea.Cmd {
+	if pm.embedded {
+		return nil
+	}
+	return tea.Quit
+}
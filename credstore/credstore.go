@@ -0,0 +1,97 @@
+/*
+The credstore package stores session tokens, keyed by account.
+Three backends are available: the OS keyring (Secret Service, Keychain, or Credential Manager), a
+file in the config directory encrypted by a passphrase, and the legacy plaintext token files, which
+must be opted into explicitly.
+Open selects a backend; Migrate moves tokens left in the plaintext files into it.
+*/
+package credstore
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"revolt_tui/cfgdir"
+	"revolt_tui/log"
+	"strings"
+)
+
+// DefaultKey identifies the token of the (only) account.
+const DefaultKey string = "default"
+
+// Returned by Get if no token is stored under the key.
+var ErrNotFound = errors.New("no stored token")
+
+// A place to store tokens.
+type Store interface {
+	Name() string // user-facing name of the backend
+	Get(key string) (string, error)
+	Set(key, token string) error
+	Delete(key string) error
+}
+
+// Backend names, as accepted by Open
+const (
+	Auto      string = "auto" // keyring if available, otherwise the encrypted file
+	Keyring   string = "keyring"
+	File      string = "file"
+	Plaintext string = "plaintext"
+)
+
+// Returns the names of the backends accepted by Open.
+func Backends() []string {
+	return []string{Auto, Keyring, File, Plaintext}
+}
+
+// Returns the named backend.
+// passphrase is called if the encrypted file is used and must be unlocked, until it gives a passphrase
+// that opens the file (or too many wrong ones); it is told whether the file is new, in which case the
+// passphrase should be confirmed, and whether the last passphrase given was wrong.
+func Open(backend string, passphrase func(isNew, retry bool) (string, error)) (Store, error) {
+	switch strings.ToLower(backend) {
+	case Auto, "":
+		if keyringAvailable() {
+			return keyringStore{}, nil
+		}
+		log.Writer.Info("OS keyring is unavailable; falling back to an encrypted token file")
+		return newEncryptedFile(path.Join(cfgdir.Get(), encryptedFileName), passphrase), nil
+	case Keyring:
+		if !keyringAvailable() {
+			return nil, errors.New("the OS keyring is unavailable")
+		}
+		return keyringStore{}, nil
+	case File:
+		return newEncryptedFile(path.Join(cfgdir.Get(), encryptedFileName), passphrase), nil
+	case Plaintext:
+		return plaintextFile{dir: cfgdir.Get()}, nil
+	}
+	return nil, fmt.Errorf("unknown credential store '%s'; options are: %s",
+		backend, strings.Join(Backends(), ", "))
+}
+
+// Moves the tokens found in the plaintext files into the given store, removing them from the files.
+// Does nothing if the store is the plaintext file or there are no such tokens.
+func Migrate(to Store) error {
+	if _, ok := to.(plaintextFile); ok {
+		return nil
+	}
+	pf := plaintextFile{dir: cfgdir.Get()}
+	keys, err := pf.keys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		token, err := pf.Get(key)
+		if err != nil {
+			return err
+		}
+		if err := to.Set(key, token); err != nil {
+			return fmt.Errorf("failed to migrate plaintext token to %s: %v", to.Name(), err)
+		}
+		if err := pf.Delete(key); err != nil {
+			return err
+		}
+		log.Writer.Info("migrated plaintext token", "key", key, "to", to.Name())
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package credstore
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+const encryptedFileName string = "tokens.enc" // in config directory
+
+// scrypt parameters, per the package's recommendation for interactive logins
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	saltSize int = 16
+)
+
+// how many times the passphrase is asked for before giving up
+const maxPassphraseAttempts int = 3
+
+// Returned if the passphrase does not decrypt the stored tokens.
+var ErrBadPassphrase = errors.New("incorrect passphrase")
+
+// stores tokens in a JSON file, each sealed with a key derived from the user's passphrase
+type encryptedFile struct {
+	path       string
+	passphrase func(isNew, retry bool) (string, error)
+
+	mtx  sync.Mutex
+	pass string // set once it has been checked against the file
+}
+
+var _ Store = &encryptedFile{}
+
+// a single sealed token
+type sealed struct {
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func newEncryptedFile(path string, passphrase func(isNew, retry bool) (string, error)) *encryptedFile {
+	return &encryptedFile{path: path, passphrase: passphrase}
+}
+
+func (*encryptedFile) Name() string {
+	return "encrypted file"
+}
+
+func (f *encryptedFile) Get(key string) (string, error) {
+	entries, err := f.read()
+	if err != nil {
+		return "", err
+	}
+	s, ok := entries[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	pass, err := f.unlock(entries)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(pass, s.Salt)
+	if err != nil {
+		return "", err
+	}
+	plain, err := aead.Open(nil, s.Nonce, s.Ciphertext, []byte(key))
+	if err != nil {
+		return "", ErrBadPassphrase
+	}
+	return string(plain), nil
+}
+
+func (f *encryptedFile) Set(key, token string) error {
+	entries, err := f.read()
+	if err != nil {
+		return err
+	}
+	// never seal with a passphrase other than that of the existing tokens
+	pass, err := f.unlock(entries)
+	if err != nil {
+		return err
+	}
+	s := sealed{Salt: make([]byte, saltSize), Nonce: make([]byte, chacha20poly1305.NonceSizeX)}
+	if _, err := rand.Read(s.Salt); err != nil {
+		return err
+	}
+	if _, err := rand.Read(s.Nonce); err != nil {
+		return err
+	}
+	aead, err := newAEAD(pass, s.Salt)
+	if err != nil {
+		return err
+	}
+	s.Ciphertext = aead.Seal(nil, s.Nonce, []byte(token), []byte(key))
+	entries[key] = s
+	return f.write(entries)
+}
+
+func (f *encryptedFile) Delete(key string) error {
+	entries, err := f.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := entries[key]; !ok {
+		return nil
+	}
+	delete(entries, key)
+	return f.write(entries)
+}
+
+// Returns the user's passphrase, asking for it until it opens one of the given tokens (any will do,
+// if there are none).
+// Only a passphrase that passed is remembered; after too many attempts, ErrBadPassphrase is returned
+// and the next call asks anew.
+func (f *encryptedFile) unlock(entries map[string]sealed) (string, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.pass != "" {
+		return f.pass, nil
+	}
+	for attempt := 0; attempt < maxPassphraseAttempts; attempt++ {
+		pass, err := f.passphrase(len(entries) == 0, attempt > 0)
+		if err != nil {
+			return "", err
+		}
+		if pass == "" {
+			return "", errors.New("a passphrase is required")
+		}
+		if opensAny(pass, entries) {
+			f.pass = pass
+			return pass, nil
+		}
+	}
+	return "", ErrBadPassphrase
+}
+
+// Does the passphrase open any of the given tokens? True if there are none.
+func opensAny(pass string, entries map[string]sealed) bool {
+	if len(entries) == 0 {
+		return true
+	}
+	for key, s := range entries {
+		aead, err := newAEAD(pass, s.Salt)
+		if err != nil {
+			continue
+		}
+		if _, err := aead.Open(nil, s.Nonce, s.Ciphertext, []byte(key)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the sealed tokens in the file; a missing file holds none.
+func (f *encryptedFile) read() (map[string]sealed, error) {
+	entries := make(map[string]sealed)
+	raw, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (f *encryptedFile) write(entries map[string]sealed) error {
+	raw, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.path, raw, 0600)
+}
+
+// Derives the token key from the passphrase and salt.
+func newAEAD(pass string, salt []byte) (cipher.AEAD, error) {
+	k, err := scrypt.Key([]byte(pass), salt, scryptN, scryptR, scryptP, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.NewX(k)
+}
@@ -0,0 +1,90 @@
+package credstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Returns a passphrase func giving each of the given passphrases in turn, and a count of the calls.
+func passphrases(t *testing.T, given ...string) (func(isNew, retry bool) (string, error), *int) {
+	calls := new(int)
+	return func(_, retry bool) (string, error) {
+		if retry != (*calls > 0) {
+			t.Errorf("call %d: retry = %v", *calls, retry)
+		}
+		if *calls >= len(given) {
+			t.Fatalf("asked for a passphrase %d times; expected at most %d", *calls+1, len(given))
+		}
+		*calls++
+		return given[*calls-1], nil
+	}, calls
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	p := filepath.Join(t.TempDir(), encryptedFileName)
+	pass, _ := passphrases(t, "hunter2")
+	f := newEncryptedFile(p, pass)
+	if err := f.Set("account", "token"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a fresh store, as on the next run
+	pass, calls := passphrases(t, "hunter2")
+	f = newEncryptedFile(p, pass)
+	got, err := f.Get("account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "token" {
+		t.Errorf("Get = %q; want %q", got, "token")
+	}
+	if _, err := f.Get("account"); err != nil || *calls != 1 {
+		t.Errorf("second Get: err = %v, passphrase asked %d times; want nil, 1", err, *calls)
+	}
+	if _, err := f.Get("other"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing key: err = %v; want ErrNotFound", err)
+	}
+}
+
+func TestEncryptedBadPassphrase(t *testing.T) {
+	p := filepath.Join(t.TempDir(), encryptedFileName)
+	pass, _ := passphrases(t, "hunter2")
+	if err := newEncryptedFile(p, pass).Set("account", "token"); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every attempt wrong: nothing is read, nor written with the wrong passphrase
+	wrong := make([]string, maxPassphraseAttempts)
+	for i := range wrong {
+		wrong[i] = "wrong"
+	}
+	pass, _ = passphrases(t, wrong...)
+	f := newEncryptedFile(p, pass)
+	if _, err := f.Get("account"); !errors.Is(err, ErrBadPassphrase) {
+		t.Errorf("Get: err = %v; want ErrBadPassphrase", err)
+	}
+	pass, _ = passphrases(t, wrong...)
+	f.passphrase = pass
+	if err := f.Set("other", "token2"); !errors.Is(err, ErrBadPassphrase) {
+		t.Errorf("Set: err = %v; want ErrBadPassphrase", err)
+	}
+	if after, err := os.ReadFile(p); err != nil || string(after) != string(before) {
+		t.Errorf("the file was altered after a wrong passphrase (err = %v)", err)
+	}
+
+	// a wrong attempt, then the right one
+	pass, calls := passphrases(t, "wrong", "hunter2")
+	f = newEncryptedFile(p, pass)
+	if got, err := f.Get("account"); err != nil || got != "token" {
+		t.Errorf("Get = %q, %v; want %q, nil", got, err, "token")
+	}
+	if *calls != 2 {
+		t.Errorf("passphrase asked %d times; want 2", *calls)
+	}
+}
@@ -0,0 +1,44 @@
+package credstore
+
+import (
+	"errors"
+
+	"github.com/zalando/go-keyring"
+)
+
+const keyringService string = "revolttui"
+
+// stores tokens in the OS keyring, as secrets of the keyringService named by their key
+type keyringStore struct{}
+
+var _ Store = keyringStore{}
+
+func (keyringStore) Name() string {
+	return "OS keyring"
+}
+
+func (keyringStore) Get(key string) (string, error) {
+	token, err := keyring.Get(keyringService, key)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", ErrNotFound
+	}
+	return token, err
+}
+
+func (keyringStore) Set(key, token string) error {
+	return keyring.Set(keyringService, key, token)
+}
+
+func (keyringStore) Delete(key string) error {
+	if err := keyring.Delete(keyringService, key); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Can the keyring be reached?
+// A lookup of a missing secret succeeds (with ErrNotFound) only if a keyring is running.
+func keyringAvailable() bool {
+	_, err := keyring.Get(keyringService, "availability-probe")
+	return err == nil || errors.Is(err, keyring.ErrNotFound)
+}
@@ -0,0 +1,132 @@
+package credstore
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	// holds the token of DefaultKey, as earlier versions stored their only token; in config directory
+	plaintextFileName string = "token"
+	// holds every other token, by key; in config directory
+	plaintextMapFileName string = "tokens.json"
+)
+
+// the legacy store: unencrypted tokens in the config directory.
+// The token of DefaultKey is kept in the legacy token file, so earlier versions can still read it;
+// the tokens of other keys are kept in a JSON map beside it.
+type plaintextFile struct {
+	dir string
+}
+
+var _ Store = plaintextFile{}
+
+func (plaintextFile) Name() string {
+	return "plaintext file"
+}
+
+func (p plaintextFile) Get(key string) (string, error) {
+	if key == DefaultKey {
+		raw, err := os.ReadFile(path.Join(p.dir, plaintextFileName))
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrNotFound
+		} else if err != nil {
+			return "", err
+		}
+		token := strings.TrimSpace(string(raw))
+		if token == "" {
+			return "", ErrNotFound
+		}
+		return token, nil
+	}
+	tokens, err := p.read()
+	if err != nil {
+		return "", err
+	}
+	token, ok := tokens[key]
+	if !ok || token == "" {
+		return "", ErrNotFound
+	}
+	return token, nil
+}
+
+func (p plaintextFile) Set(key, token string) error {
+	if key == DefaultKey {
+		return os.WriteFile(path.Join(p.dir, plaintextFileName), []byte(token), 0600)
+	}
+	tokens, err := p.read()
+	if err != nil {
+		return err
+	}
+	tokens[key] = token
+	return p.write(tokens)
+}
+
+func (p plaintextFile) Delete(key string) error {
+	if key == DefaultKey {
+		err := os.Remove(path.Join(p.dir, plaintextFileName))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	tokens, err := p.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := tokens[key]; !ok {
+		return nil
+	}
+	delete(tokens, key)
+	return p.write(tokens)
+}
+
+// Returns the keys of every stored token.
+func (p plaintextFile) keys() ([]string, error) {
+	tokens, err := p.read()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(tokens)+1)
+	if _, err := p.Get(DefaultKey); err == nil {
+		keys = append(keys, DefaultKey)
+	}
+	for k := range tokens {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// Returns the tokens of the map file; a missing file holds none.
+func (p plaintextFile) read() (map[string]string, error) {
+	tokens := make(map[string]string)
+	raw, err := os.ReadFile(path.Join(p.dir, plaintextMapFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return tokens, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Writes the tokens to the map file, removing it once empty.
+func (p plaintextFile) write(tokens map[string]string) error {
+	mapPath := path.Join(p.dir, plaintextMapFileName)
+	if len(tokens) == 0 {
+		if err := os.Remove(mapPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	raw, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(mapPath, raw, 0600)
+}
@@ -0,0 +1,96 @@
+/*
+The drafts package stores unsent messages, keyed by channel ID, so they survive channel switches and
+restarts.
+Drafts are held in memory and written to the current account's profile directory by Save; they are
+loaded whenever an account is put to use (see the accounts package) and saved on exit.
+*/
+package drafts
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"revolt_tui/cfgdir"
+	"sync"
+)
+
+const (
+	FileName       string = "drafts.json" // in profile directory
+	filePermission        = 0600
+)
+
+var (
+	drafts map[string]string = make(map[string]string)
+	dirty  bool              // drafts have changed since last load/save
+	mtx    sync.Mutex
+)
+
+// Loads any drafts persisted in the profile directory, replacing those in memory.
+// A missing file is not an error; it leaves no drafts.
+func Load() error {
+	raw, err := os.ReadFile(path.Join(cfgdir.Profile(), FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		raw = []byte("{}")
+	} else if err != nil {
+		return err
+	}
+	d := make(map[string]string)
+	if err := json.Unmarshal(raw, &d); err != nil {
+		return err
+	}
+
+	mtx.Lock()
+	drafts = d
+	dirty = false
+	mtx.Unlock()
+	return nil
+}
+
+// Writes the current drafts to the profile directory, if they have changed.
+func Save() error {
+	mtx.Lock()
+	defer mtx.Unlock()
+	if !dirty {
+		return nil
+	}
+	raw, err := json.Marshal(drafts)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path.Join(cfgdir.Profile(), FileName), raw, filePermission); err != nil {
+		return err
+	}
+	dirty = false
+	return nil
+}
+
+// Returns the draft for the given channel, if one exists.
+func Get(channelID string) string {
+	mtx.Lock()
+	defer mtx.Unlock()
+	return drafts[channelID]
+}
+
+// Stores the draft for the given channel. An empty draft clears it.
+func Set(channelID, text string) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	if drafts[channelID] == text {
+		return
+	}
+	if text == "" {
+		delete(drafts, channelID)
+	} else {
+		drafts[channelID] = text
+	}
+	dirty = true
+}
+
+// Does the given channel have a draft?
+func Has(channelID string) bool {
+	mtx.Lock()
+	defer mtx.Unlock()
+	_, ok := drafts[channelID]
+	return ok
+}
@@ -0,0 +1,211 @@
+/*
+The instance package selects the Revolt instance (the public one or a self-hosted one) that sessions
+talk to.
+revoltgo always addresses the public API, so sessions made by NewSession rewrite their requests to
+the instance's API instead. As revoltgo discovers the websocket from the API's root, connections
+follow the rewrite. The root configuration is also fetched by Use (or Discover), for the instance's
+web app, its account policies (ex: whether new accounts need an invite) and its other services
+(ex: Autumn, the file server, which AttachmentURL addresses).
+*/
+package instance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"revolt_tui/log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sentinelb51/revoltgo"
+)
+
+// API of the public Revolt instance, which revoltgo addresses
+const Official string = "https://api.revolt.chat"
+
+const discoveryTimeout = 10 * time.Second
+
+// returned by Use and Discover if the URL given does not serve a Revolt API
+var ErrNotRevolt = errors.New("not a Revolt API")
+
+// An instance, as described by the root configuration of its API.
+type Info struct {
+	API     string // base URL of the REST API
+	WS      string // events websocket
+	App     string // web client, which serves invite links
+	Autumn  string // file server; empty if disabled
+	January string // link embed proxy; empty if disabled
+
+	Captcha      bool // account creation and recovery require a captcha
+	InviteOnly   bool // account creation requires an invite
+	VerifyEmails bool // new accounts must verify their email before logging in
+}
+
+var (
+	current = Info{API: Official}
+	mtx     sync.Mutex
+)
+
+// Normalizes the given API base URL, assuming https if no scheme is given.
+// An empty URL is the official instance.
+func Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return Official, nil
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme %q in instance URL", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("instance URL %q has no host", raw)
+	}
+	u.RawQuery, u.Fragment = "", ""
+	return strings.TrimRight(u.String(), "/"), nil
+}
+
+// Returns the host of the given API base URL, for display.
+func Host(api string) string {
+	if u, err := url.Parse(api); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return api
+}
+
+// Makes the instance with the given API the current one, fetching its root configuration.
+// The instance is made current even if the configuration cannot be fetched, in which case the error
+// is returned; an API that does not describe itself as Revolt is an error and is not made current.
+func Use(api string) (Info, error) {
+	info, err := Discover(api)
+	if errors.Is(err, ErrNotRevolt) {
+		return info, err
+	}
+	Set(info)
+	return info, err
+}
+
+// Makes the given instance (as returned by Discover) the current one.
+func Set(info Info) {
+	mtx.Lock()
+	current = info
+	mtx.Unlock()
+	log.Writer.Info("using instance", "API", info.API, "app", info.App, "websocket", info.WS, "autumn", info.Autumn)
+}
+
+// Returns the current instance.
+func Current() Info {
+	mtx.Lock()
+	defer mtx.Unlock()
+	return current
+}
+
+// Returns a session for the instance with the given API, authenticated by the given token (which
+// may be empty).
+func NewSession(api, token string) *revoltgo.Session {
+	s := revoltgo.New(token)
+	if api == Official {
+		return s
+	}
+	base, err := url.Parse(api)
+	if err != nil { // unreachable for normalized URLs
+		log.Writer.Error("invalid instance URL", "API", api, "error", err)
+		return s
+	}
+	next := s.HTTP.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	s.HTTP.Transport = rewriter{base: base, next: next}
+	return s
+}
+
+// Fetches the root configuration of the given API, without making it current.
+// Returns an Info populated with just the API if it cannot be fetched; failures other than
+// ErrNotRevolt are logged, as the instance remains usable.
+func Discover(api string) (info Info, err error) {
+	defer func() {
+		if err != nil && !errors.Is(err, ErrNotRevolt) {
+			log.Writer.Warn("failed to discover instance", "API", api, "error", err)
+		}
+	}()
+
+	info = Info{API: api}
+	client := http.Client{Timeout: discoveryTimeout}
+	resp, err := client.Get(api)
+	if err != nil {
+		return info, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return info, fmt.Errorf("%w: root responded %s", ErrNotRevolt, resp.Status)
+	}
+	var root revoltgo.RevoltAPI
+	if err := json.NewDecoder(resp.Body).Decode(&root); err != nil || root.Revolt == "" {
+		return info, fmt.Errorf("%w: root does not describe a Revolt instance", ErrNotRevolt)
+	}
+
+	info.WS, info.App = root.WS, strings.TrimRight(root.App, "/")
+	if root.Features.Autumn.Enabled {
+		info.Autumn = root.Features.Autumn.URL
+	}
+	if root.Features.January.Enabled {
+		info.January = root.Features.January.URL
+	}
+	info.Captcha = root.Features.Captcha.Enabled
+	info.InviteOnly = root.Features.InviteOnly
+	info.VerifyEmails = root.Features.Email
+	return info, nil
+}
+
+// Returns the URL of the given attachment on the current instance's file server, or "" if the
+// instance has no file server (or its configuration could not be fetched).
+func AttachmentURL(a *revoltgo.Attachment) string {
+	autumn := Current().Autumn
+	if a == nil || autumn == "" {
+		return ""
+	}
+	return strings.TrimRight(autumn, "/") + "/" + a.Tag + "/" + a.ID
+}
+
+// Returns the given external link routed through the current instance's link proxy, as Revolt's
+// clients fetch embedded media; the link is returned as is if the instance has no proxy.
+func ProxyURL(link string) string {
+	january := Current().January
+	if link == "" || january == "" {
+		return link
+	}
+	return strings.TrimRight(january, "/") + "/proxy?url=" + url.QueryEscape(link)
+}
+
+//#region helpers
+
+// redirects requests bound for the official API to another instance's
+type rewriter struct {
+	base *url.URL
+	next http.RoundTripper
+}
+
+var officialHost = Host(Official)
+
+func (r rewriter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != officialHost {
+		return r.next.RoundTrip(req)
+	}
+	out := req.Clone(req.Context())
+	out.URL.Scheme, out.URL.Host = r.base.Scheme, r.base.Host
+	out.URL.Path = r.base.Path + req.URL.Path
+	out.URL.RawPath = ""
+	out.Host = ""
+	return r.next.RoundTrip(out)
+}
+
+//#endregion helpers
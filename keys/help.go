@@ -0,0 +1,64 @@
+package keys
+
+import (
+	"revolt_tui/stylesheet/colors"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	helpTitleSty, helpKeySty lipgloss.Style
+	helpColSty               lipgloss.Style = lipgloss.NewStyle().PaddingRight(4)
+)
+
+func init() {
+	colors.OnChange(func() {
+		helpTitleSty = lipgloss.NewStyle().Bold(true).Foreground(colors.LeftField)
+		helpKeySty = lipgloss.NewStyle().Foreground(colors.TabBorderForeground).PaddingRight(2)
+	})
+}
+
+// Generates the help view for the given scopes, rendering one column per scope.
+// Parent scopes are included automatically, outermost first.
+func HelpView(scopes ...Scope) string {
+	// collect each scope's ancestry, skipping duplicates
+	var ordered []Scope
+	seen := make(map[Scope]bool)
+	for _, s := range scopes {
+		var chain []Scope
+		for ; s != ""; s = parents[s] {
+			chain = append([]Scope{s}, chain...)
+		}
+		for _, c := range chain {
+			if !seen[c] {
+				seen[c] = true
+				ordered = append(ordered, c)
+			}
+		}
+	}
+
+	mtx.RLock()
+	defer mtx.RUnlock()
+
+	var cols []string
+	for _, s := range ordered {
+		var ks, descs []string
+		for _, d := range defaults {
+			if scopeOf(d.id) != s || !bindings[d.id].Enabled() {
+				continue
+			}
+			h := bindings[d.id].Help()
+			ks = append(ks, h.Key)
+			descs = append(descs, h.Desc)
+		}
+		if ks == nil {
+			continue
+		}
+		body := lipgloss.JoinHorizontal(lipgloss.Top,
+			helpKeySty.Render(lipgloss.JoinVertical(lipgloss.Left, ks...)),
+			lipgloss.JoinVertical(lipgloss.Left, descs...))
+		cols = append(cols, helpColSty.Render(helpTitleSty.Render(string(s))+"\n"+body))
+	}
+
+	return lipgloss.JoinHorizontal(lipgloss.Top, cols...)
+}
@@ -0,0 +1,398 @@
+/*
+The keys package owns every keybinding the TUI responds to.
+Bindings are declared once in the defaults table below, identified by a "<scope>.<action>" ID, and
+may be replaced wholesale by a preset or individually by the user's keybindings file in the config
+directory.
+Load is called by main on startup; it refuses any configuration where two actions that can be active
+at the same time share a key.
+*/
+package keys
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const FileName string = "keybindings.json" // in config directory
+
+// A scope is a group of bindings that are active together.
+// Scopes are nested; a binding conflicts with any binding in the same scope or a parent scope, or in
+// a scope shown at the same time (see concurrent).
+type Scope string
+
+const (
+	Global           Scope = "global"
+	ServerSelection  Scope = "serverselection"
+	Prompt           Scope = "prompt" // replaces the server list's bindings while one of its prompts is open
+	Server           Scope = "server"
+	Channels         Scope = "channels"
+	Chat             Scope = "chat"
+	MemberList       Scope = "memberlist"
+	Settings         Scope = "settings"
+	Members          Scope = "members"
+	Invites          Scope = "invites"
+	AccountSelection Scope = "accountselection"
+	Sessions         Scope = "sessions"
+)
+
+// parent of each scope; Global is the root.
+var parents = map[Scope]Scope{
+	ServerSelection:  Global,
+	Prompt:           Global,
+	Server:           Global,
+	Channels:         Server,
+	Chat:             Server,
+	MemberList:       Server,
+	Settings:         Server,
+	Members:          Server,
+	Invites:          Server,
+	AccountSelection: Global,
+	Sessions:         Global,
+}
+
+// sibling scopes shown at the same time: the panes of server mode's split layout
+var concurrent = [][]Scope{
+	{Channels, Chat, MemberList},
+}
+
+// bindings of concurrent scopes that may share keys, as only the focused pane receives them
+var shared = [][2]string{
+	{ChannelsSelect, ChatSend},
+	{MemberListUp, ChatSelectUp},
+	{MemberListDown, ChatSelectDown},
+}
+
+// Binding IDs
+const (
+	Quit                     = "global.quit"
+	Help                     = "global.help"
+	Accounts                 = "global.accounts"
+	ServerSelectionSelect    = "serverselection.select"
+	ServerSelectionUp        = "serverselection.moveUp"
+	ServerSelectionDown      = "serverselection.moveDown"
+	ServerSelectionFolder    = "serverselection.folder"
+	ServerSelectionJoin      = "serverselection.join"
+	PromptConfirm            = "prompt.confirm"
+	PromptCancel             = "prompt.cancel"
+	ServerNextTab            = "server.nextTab"
+	ServerPreviousTab        = "server.previousTab"
+	ServerMembers            = "server.members"
+	ServerNextPane           = "server.nextPane"
+	ServerPreviousPane       = "server.previousPane"
+	MemberListUp             = "memberlist.up"
+	MemberListDown           = "memberlist.down"
+	ChannelsSelect           = "channels.select"
+	ChatSend                 = "chat.send"
+	ChatNewline              = "chat.newline"
+	ChatEditor               = "chat.editor"
+	ChatRetry                = "chat.retry"
+	ChatDiscard              = "chat.discard"
+	ChatSelect               = "chat.select"
+	ChatSelectUp             = "chat.selectUp"
+	ChatSelectDown           = "chat.selectDown"
+	ChatMark                 = "chat.mark"
+	ChatDeleteMarked         = "chat.deleteMarked"
+	SettingsNextField        = "settings.nextField"
+	SettingsPreviousField    = "settings.previousField"
+	SettingsToggle           = "settings.toggle"
+	SettingsMoveUp           = "settings.moveUp"
+	SettingsMoveDown         = "settings.moveDown"
+	SettingsSave             = "settings.save"
+	SettingsConfirm          = "settings.confirm"
+	SettingsCancel           = "settings.cancel"
+	SettingsReset            = "settings.reset"
+	SettingsSelect           = "settings.select"
+	SettingsBack             = "settings.back"
+	MembersKick              = "members.kick"
+	MembersBan               = "members.ban"
+	MembersTimeout           = "members.timeout"
+	MembersUnban             = "members.unban"
+	MembersBans              = "members.bans"
+	InvitesCreate            = "invites.create"
+	InvitesRevoke            = "invites.revoke"
+	AccountSelectionLogout   = "accountselection.logout"
+	AccountSelectionSessions = "accountselection.sessions"
+	SessionsRevoke           = "sessions.revoke"
+	SessionsRevokeOthers     = "sessions.revokeOthers"
+	SessionsConfirm          = "sessions.confirm"
+	SessionsBack             = "sessions.back"
+)
+
+type definition struct {
+	id   string
+	keys []string
+	help string
+}
+
+// the default bindings, in the order they should be displayed
+var defaults = []definition{
+	{Quit, []string{"ctrl+c"}, "quit"},
+	{Help, []string{"f1"}, "toggle help"},
+	{Accounts, []string{"f2"}, "switch account"},
+	{ServerSelectionSelect, []string{"enter"}, "open server/toggle folder"},
+	{ServerSelectionUp, []string{"shift+up"}, "move server up"},
+	{ServerSelectionDown, []string{"shift+down"}, "move server down"},
+	{ServerSelectionFolder, []string{"F"}, "move server into folder"},
+	{ServerSelectionJoin, []string{"i"}, "join server by invite"},
+	{PromptConfirm, []string{"enter"}, "confirm"},
+	{PromptCancel, []string{"esc"}, "back/cancel"},
+	{ServerNextTab, []string{"tab"}, "next tab"},
+	{ServerPreviousTab, []string{"shift+tab"}, "previous tab"},
+	{ServerMembers, []string{"alt+m"}, "toggle member list (wide terminals)"},
+	{ServerNextPane, []string{"ctrl+right"}, "focus next pane (wide terminals)"},
+	{ServerPreviousPane, []string{"ctrl+left"}, "focus previous pane (wide terminals)"},
+	{MemberListUp, []string{"up"}, "scroll member list up"},
+	{MemberListDown, []string{"down"}, "scroll member list down"},
+	{ChannelsSelect, []string{"enter"}, "open channel"},
+	{ChatSend, []string{"enter"}, "send message"},
+	{ChatNewline, []string{"alt+enter", "ctrl+j"}, "insert newline"},
+	{ChatEditor, []string{"ctrl+o"}, "compose in $EDITOR"},
+	{ChatRetry, []string{"ctrl+r"}, "retry failed messages"},
+	{ChatDiscard, []string{"ctrl+x"}, "discard failed message"},
+	{ChatSelect, []string{"alt+s"}, "select messages to delete (moderators)"},
+	{ChatSelectUp, []string{"up"}, "older message (while selecting)"},
+	{ChatSelectDown, []string{"down"}, "newer message (while selecting)"},
+	{ChatMark, []string{" "}, "mark/unmark message (while selecting)"},
+	{ChatDeleteMarked, []string{"alt+x"}, "delete marked messages"},
+	{SettingsNextField, []string{"down"}, "next field"},
+	{SettingsPreviousField, []string{"up"}, "previous field"},
+	{SettingsToggle, []string{" "}, "toggle option"},
+	{SettingsMoveUp, []string{"shift+up"}, "move item up"},
+	{SettingsMoveDown, []string{"shift+down"}, "move item down"},
+	{SettingsSave, []string{"ctrl+s"}, "save changes"},
+	{SettingsConfirm, []string{"y"}, "confirm"},
+	{SettingsCancel, []string{"n"}, "cancel"},
+	{SettingsReset, []string{"ctrl+r"}, "discard changes"},
+	{SettingsSelect, []string{"enter"}, "open/apply"},
+	{SettingsBack, []string{"esc"}, "back/cancel"},
+	{MembersKick, []string{"ctrl+k"}, "kick member"},
+	{MembersBan, []string{"ctrl+b"}, "ban member"},
+	{MembersTimeout, []string{"ctrl+t"}, "time out member"},
+	{MembersUnban, []string{"ctrl+u"}, "unban user"},
+	{MembersBans, []string{"ctrl+l"}, "toggle members/bans"},
+	{InvitesCreate, []string{"ctrl+n"}, "create invite"},
+	{InvitesRevoke, []string{"ctrl+x"}, "revoke invite"},
+	{AccountSelectionLogout, []string{"ctrl+l"}, "log out of the current account"},
+	{AccountSelectionSessions, []string{"ctrl+s"}, "manage the current account's sessions"},
+	{SessionsRevoke, []string{"ctrl+x"}, "revoke session"},
+	{SessionsRevokeOthers, []string{"ctrl+a"}, "revoke all other sessions"},
+	{SessionsConfirm, []string{"y"}, "confirm revocation"},
+	{SessionsBack, []string{"esc"}, "back/cancel"},
+}
+
+// presets are layered on top of the defaults, prior to the user's own bindings
+var presets = map[string]map[string][]string{
+	"default": {},
+	"vi": {
+		ServerNextTab:         {"tab", "alt+l"},
+		ServerPreviousTab:     {"shift+tab", "alt+h"},
+		ServerSelectionSelect: {"enter", "o"},
+		ServerSelectionUp:     {"shift+up", "K"},
+		ServerSelectionDown:   {"shift+down", "J"},
+		ChannelsSelect:        {"enter", "o"},
+		ChatSelectUp:          {"up", "k"},
+		ChatSelectDown:        {"down", "j"},
+		MemberListUp:          {"up", "k"},
+		MemberListDown:        {"down", "j"},
+	},
+}
+
+// format of the keybindings file
+type file struct {
+	Preset   string              `json:"preset"`
+	Bindings map[string][]string `json:"bindings"`
+}
+
+var (
+	bindings map[string]key.Binding = build()
+	mtx      sync.RWMutex
+)
+
+// Loads the keybindings file at the given path, layering its preset and bindings over the defaults.
+// A missing file is not an error; the defaults are put back in effect (ex: once the file is deleted).
+// On error, the current bindings are left untouched.
+func Load(path string) error {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Apply("", nil)
+	} else if err != nil {
+		return err
+	}
+	var f file
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return Apply(f.Preset, f.Bindings)
+}
+
+// Replaces the active bindings with the defaults, overlaid by the named preset and then the given
+// overrides (keyed by binding ID).
+// Returns an error if the preset or an ID is unknown or if the result contains conflicting keys.
+func Apply(preset string, overrides map[string][]string) error {
+	if preset == "" {
+		preset = "default"
+	}
+	layer, ok := presets[preset]
+	if !ok {
+		return fmt.Errorf("unknown keybinding preset '%s'; options are: %s",
+			preset, strings.Join(Presets(), ", "))
+	}
+	for id := range overrides {
+		if !known(id) {
+			return fmt.Errorf("unknown keybinding '%s'", id)
+		}
+	}
+
+	b := build(layer, overrides)
+	if err := conflicts(b); err != nil {
+		return err
+	}
+
+	mtx.Lock()
+	bindings = b
+	mtx.Unlock()
+	return nil
+}
+
+// Returns the names of the available presets.
+func Presets() []string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the binding associated to the given ID.
+func Get(id string) key.Binding {
+	mtx.RLock()
+	defer mtx.RUnlock()
+	return bindings[id]
+}
+
+// Does the given key message trigger any of the given binding IDs?
+func Matches(msg tea.KeyMsg, ids ...string) bool {
+	mtx.RLock()
+	defer mtx.RUnlock()
+	for _, id := range ids {
+		if key.Matches(msg, bindings[id]) {
+			return true
+		}
+	}
+	return false
+}
+
+//#region helper functions
+
+// generates a binding set from the defaults, applying each layer in order
+func build(layers ...map[string][]string) map[string]key.Binding {
+	b := make(map[string]key.Binding, len(defaults))
+	for _, d := range defaults {
+		k := d.keys
+		for _, layer := range layers {
+			if override, ok := layer[d.id]; ok {
+				k = override
+			}
+		}
+		b[d.id] = key.NewBinding(key.WithKeys(k...), key.WithHelp(displayKeys(k), d.help))
+	}
+	return b
+}
+
+// joins the given keys for display, naming those that are otherwise invisible
+func displayKeys(k []string) string {
+	names := make([]string, len(k))
+	for i, s := range k {
+		if s == " " {
+			s = "space"
+		}
+		names[i] = s
+	}
+	return strings.Join(names, "/")
+}
+
+// is the given ID in the defaults table?
+func known(id string) bool {
+	for _, d := range defaults {
+		if d.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the scope a binding ID belongs to
+func scopeOf(id string) Scope {
+	s, _, _ := strings.Cut(id, ".")
+	return Scope(s)
+}
+
+// is a the same scope as b or one of b's ancestors?
+func encloses(a, b Scope) bool {
+	for s := b; s != ""; s = parents[s] {
+		if s == a {
+			return true
+		}
+	}
+	return false
+}
+
+// are a and b distinct scopes shown at the same time?
+func concurrentScopes(a, b Scope) bool {
+	for _, group := range concurrent {
+		if a != b && slices.Contains(group, a) && slices.Contains(group, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// may the given bindings share keys?
+func sharing(a, b string) bool {
+	for _, pair := range shared {
+		if pair == [2]string{a, b} || pair == [2]string{b, a} {
+			return true
+		}
+	}
+	return false
+}
+
+// returns an error describing every pair of bindings that can be active simultaneously and share a key
+func conflicts(b map[string]key.Binding) error {
+	var errs []string
+	for i, a := range defaults {
+		for _, o := range defaults[i+1:] {
+			sa, so := scopeOf(a.id), scopeOf(o.id)
+			if concurrentScopes(sa, so) {
+				if sharing(a.id, o.id) {
+					continue
+				}
+			} else if !encloses(sa, so) && !encloses(so, sa) {
+				continue
+			}
+			for _, k := range b[a.id].Keys() {
+				for _, ko := range b[o.id].Keys() {
+					if k == ko {
+						errs = append(errs, fmt.Sprintf("'%s' is bound to both %s and %s", k, a.id, o.id))
+					}
+				}
+			}
+		}
+	}
+	if errs != nil {
+		return errors.New("conflicting keybindings:\n" + strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+//#endregion helper functions
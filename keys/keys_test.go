@@ -0,0 +1,68 @@
+package keys
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPresetsHaveNoConflicts(t *testing.T) {
+	for _, name := range Presets() {
+		if err := conflicts(build(presets[name])); err != nil {
+			t.Errorf("preset %s: %v", name, err)
+		}
+	}
+}
+
+func TestApplyConflicts(t *testing.T) {
+	t.Cleanup(func() { Apply("", nil) })
+
+	tests := []struct {
+		name      string
+		preset    string
+		overrides map[string][]string
+		conflict  string // a binding ID named in the error; empty if no error is expected
+	}{
+		{"defaults", "", nil, ""},
+		{"same scope", "", map[string][]string{ChatEditor: {"enter"}}, ChatSend},
+		{"parent scope", "", map[string][]string{ChatEditor: {"tab"}}, ServerNextTab},
+		{"global scope", "vi", map[string][]string{ChannelsSelect: {"ctrl+c"}}, Quit},
+		{"concurrent siblings", "", map[string][]string{ChannelsSelect: {"ctrl+o"}}, ChatEditor},
+		{"concurrent siblings in a preset", "vi", map[string][]string{MemberListUp: {"up", "alt+s"}}, ChatSelect},
+		{"shared across concurrent siblings", "", map[string][]string{ChannelsSelect: {"enter", "o"}}, ""},
+		{"siblings not shown together", "", map[string][]string{MembersKick: {"ctrl+o"}}, ""},
+		{"unrelated scopes", "", map[string][]string{SessionsRevoke: {"ctrl+o"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Apply(tt.preset, tt.overrides)
+			switch {
+			case tt.conflict == "" && err != nil:
+				t.Errorf("Apply: unexpected error: %v", err)
+			case tt.conflict != "" && err == nil:
+				t.Errorf("Apply: expected a conflict with %s", tt.conflict)
+			case tt.conflict != "" && !strings.Contains(err.Error(), tt.conflict):
+				t.Errorf("Apply: error does not name %s: %v", tt.conflict, err)
+			}
+		})
+	}
+}
+
+func TestApplyKeepsBindingsOnError(t *testing.T) {
+	t.Cleanup(func() { Apply("", nil) })
+
+	if err := Apply("vi", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply("", map[string][]string{ChatEditor: {"enter"}}); err == nil {
+		t.Fatal("Apply: expected a conflict")
+	}
+	if err := Apply("nonexistent", nil); err == nil {
+		t.Fatal("Apply: expected an unknown preset error")
+	}
+	if err := Apply("", map[string][]string{"chat.nonexistent": {"x"}}); err == nil {
+		t.Fatal("Apply: expected an unknown binding error")
+	}
+	if got := Get(ChatSelectUp).Keys(); len(got) != 2 || got[1] != "k" {
+		t.Errorf("bindings changed after failed Apply: %s = %v; want the vi preset's", ChatSelectUp, got)
+	}
+}
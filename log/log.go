@@ -10,7 +10,6 @@ import (
 	"revolt_tui/cfgdir"
 
 	"github.com/charmbracelet/log"
-	"github.com/spf13/pflag"
 )
 
 const (
@@ -23,12 +22,8 @@ var Writer *log.Logger
 var logPath string   // set on Initialize()
 var logFile *os.File // set on Initialize()
 
-// Initializes the writer singleton
-func Initialize() error {
-	loglevel, err := pflag.CommandLine.GetString("loglevel")
-	if err != nil {
-		panic(err) // developer error
-	}
+// Initializes the writer singleton, logging at the given level
+func Initialize(loglevel string) error {
 	lvl, err := log.ParseLevel(loglevel)
 	if err != nil {
 		return fmt.Errorf("unknown log level '%s'; see -h for help", loglevel)
@@ -58,6 +53,16 @@ func Initialize() error {
 	return nil
 }
 
+// Changes the level of the writer singleton.
+func SetLevel(loglevel string) error {
+	lvl, err := log.ParseLevel(loglevel)
+	if err != nil {
+		return fmt.Errorf("unknown log level '%s'", loglevel)
+	}
+	Writer.SetLevel(lvl)
+	return nil
+}
+
 // Destroys the writer singleton.
 // Should only be called on program exit.
 func Destroy() {
@@ -1,147 +1,375 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
+	"revolt_tui/accounts"
+	"revolt_tui/api"
 	"revolt_tui/broker"
 	"revolt_tui/cfgdir"
+	"revolt_tui/config"
 	"revolt_tui/controller"
 	"revolt_tui/credentials"
+	"revolt_tui/credstore"
+	"revolt_tui/drafts"
+	"revolt_tui/instance"
+	"revolt_tui/keys"
 	"revolt_tui/log"
 	"revolt_tui/modes"
+	accountselection "revolt_tui/modes/accountSelection"
+	"revolt_tui/modes/login"
 	"revolt_tui/modes/server"
 	serverselection "revolt_tui/modes/serverSelection"
+	"revolt_tui/modes/sessions"
+	"revolt_tui/stylesheet/colors"
+	"slices"
+	"strings"
+	"sync"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/sentinelb51/revoltgo"
 	"github.com/spf13/pflag"
 )
 
-const (
-	tokenFileName string = "token"
-)
+// if set, unlocks the encrypted token file without prompting
+const passphraseEnv string = "REVOLTTUI_PASSPHRASE"
 
-// main's init just defines flags
+// main's init just defines flags.
+// Flags left unset fall back to the config file and environment; see the config package.
 func init() {
-	pflag.String("loglevel", "DEBUG",
+	pflag.String(config.FileFlag, "",
+		"config file to use in place of the one in the config directory (config.toml, config.yaml, or config.yml)")
+	pflag.String("loglevel", config.Defaults().LogLevel,
 		"set the log level.\n"+
 			"Viable options (from most verbose to least) are: debug, info, warn, error, fatal")
+	pflag.String("credential-store", credstore.Auto,
+		"where to store the session token.\n"+
+			"Viable options are: auto (keyring, falling back to file), keyring, file (encrypted by a passphrase), "+
+			"plaintext (unencrypted, not recommended)")
+	pflag.String("instance", "",
+		"API URL of the Revolt instance to use (ex: https://revolt.example.com/api).\n"+
+			"Only accounts on this instance are offered and new logins are made to it. "+
+			"Defaults to the instance of the chosen account, or the official instance")
+	pflag.String("session-name", credentials.FriendlyName,
+		"name given to sessions created by logging in, as listed among the account's sessions")
+	pflag.String("timestamp-format", config.Defaults().TimestampFormat,
+		"layout of message timestamps, as a Go time layout (ex: 15:04)")
 }
 
 func main() {
 	// consume flags
 	pflag.Parse()
 
+	// load settings, refusing to start on a bad configuration
+	settings, cfgFiles, err := config.Load(pflag.CommandLine)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		return
+	}
+	broker.SetSettings(settings)
+	colors.Apply(settings.Theme)
+
 	// set up the logger singleton
-	if err := log.Initialize(); err != nil {
+	if err := log.Initialize(settings.LogLevel); err != nil {
 		fmt.Fprintf(os.Stderr, "%v", err)
 		return
 	}
+	log.Writer.Info("loaded settings", "files", cfgFiles)
 
-	// attempt to login via token, fallback to credentials on failure
-	var session *revoltgo.Session = loginViaToken()
-	if session == nil {
-		var killed bool
-		session, killed = loginViaCredentials()
-		if killed {
-			fmt.Fprintln(os.Stdout, "You must authenticate to use RevoltTUI")
-			log.Destroy()
-			return
+	// load user keybindings, refusing to start on a bad configuration
+	if err := keys.Load(keysPath()); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		log.Destroy()
+		return
+	}
+
+	if settings.SessionName != "" {
+		credentials.FriendlyName = settings.SessionName
+	}
+
+	// open the token store, moving any plaintext tokens (ex: left by earlier versions) into it
+	store, err := credstore.Open(settings.CredentialStore, promptPassphrase)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		log.Destroy()
+		return
+	}
+	if err := credstore.Migrate(store); err != nil {
+		log.Writer.Warn("failed to migrate plaintext tokens", "error", err)
+	}
+
+	// load the known accounts, adopting the single account of earlier versions
+	if err := accounts.Load(); err != nil {
+		log.Writer.Warn("failed to load accounts", "error", err)
+	}
+	if err := accounts.Adopt(store); err != nil {
+		log.Writer.Warn("failed to adopt existing account", "error", err)
+	}
+
+	// restrict accounts to the requested instance, if any (normalized by config)
+	onlyAPI := settings.Instance
+
+	// pick an account and attempt to login via its token, fallback to credentials on failure
+	account, add, killed := chooseAccount(onlyAPI)
+	if !killed {
+		target := onlyAPI
+		if !add {
+			target = account.API()
+		} else if target == "" {
+			target = instance.Official
 		}
-		if session == nil { // die on failure
-			fmt.Fprintln(os.Stderr, "An error has occurred. Sorry, friend.")
+		if _, err := instance.Use(target); errors.Is(err, instance.ErrNotRevolt) {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", target, err)
 			log.Destroy()
 			return
 		}
-		// write the token from the session so we do not need to prompt next time
-		tknpth := path.Join(cfgdir.Get(), tokenFileName)
-		log.Writer.Debugf("creating token at path '%v'", tknpth)
-		tokenFile, err := os.OpenFile(tknpth, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
-		if err != nil {
-			log.Writer.Warn("failed to create token file", "error", err)
-		} else {
-			tokenFile.WriteString(session.Token)
+	}
+	var session *revoltgo.Session
+	if !killed && !add {
+		session = loginViaToken(store, &account)
+	}
+	fresh := session == nil // the token must be stored once the account is recorded
+	if fresh && !killed {
+		session, account, killed = loginViaCredentials()
+	}
+	if killed {
+		fmt.Fprintln(os.Stdout, "You must authenticate to use RevoltTUI")
+		log.Destroy()
+		return
+	}
+	if session == nil { // die on failure
+		fmt.Fprintln(os.Stderr, "An error has occurred. Sorry, friend.")
+		log.Destroy()
+		return
+	}
+	// load the account's drafts, outbox, etc
+	if account, err = accounts.Use(account); err != nil {
+		log.Writer.Warn("failed to use account profile", "account", account.ID, "error", err)
+	}
+	// layer the account's own settings, if it has any
+	if s, files, err := config.Load(pflag.CommandLine); err != nil {
+		log.Writer.Warn("ignoring invalid account settings", "account", account.ID, "error", err)
+	} else if !slices.Equal(files, cfgFiles) {
+		broker.SetSettings(s)
+		colors.Apply(s.Theme)
+		if err := log.SetLevel(s.LogLevel); err != nil {
+			log.Writer.Warn("failed to change log level", "error", err)
 		}
-		if tokenFile != nil {
-			tokenFile.Close()
+		log.Writer.Info("loaded account settings", "files", files)
+	}
+	if fresh {
+		// store the token from the session so we do not need to prompt next time
+		if err := store.Set(account.TokenKey(), session.Token); err != nil {
+			log.Writer.Warn("failed to store token", "store", store.Name(), "error", err)
 		}
 	}
 
 	// register modes
 	modes.Add(modes.ServerSelection, &serverselection.Action{})
 	modes.Add(modes.Server, server.New())
-
-	// provide the session information to data broker so it is ready to be accessed
-	broker.InitializeSession(session)
+	modes.Add(modes.Login, login.New(store))
+	modes.Add(modes.AccountSelection, accountselection.New(store))
+	modes.Add(modes.Sessions, &sessions.Action{})
 
 	// spin up program
 	p := tea.NewProgram(controller.Initial())
 
-	// attach ready handler to our revoltgo session so we can inject messages into bubble tea
-	session.AddHandler(func(session *revoltgo.Session, r *revoltgo.EventReady) {
-		// update the cache
-		broker.OnEventReadyFunc(session, r)
-		log.Writer.Info("cache updated")
-		p.Send(broker.CacheUpdatedMsg{})
+	// provide the session information to data broker so it is ready to be accessed;
+	// the broker injects session events (ex: Ready, connection changes) into the program
+	broker.AttachProgram(p)
+	broker.InitializeSession(session)
+
+	// reload settings and keybindings as their files change, and as the account (with its own settings)
+	// changes
+	watchConfig()
+	broker.SetConfigReloader(func() {
+		watchConfig()
+		reloadConfig()
 	})
 
-	_, err := p.Run()
-	if err != nil {
+	if _, err := p.Run(); err != nil {
 		log.Writer.Error("error running the main model", "error", err)
 	}
+	watcherMTX.Lock()
+	if watcher != nil {
+		watcher.Close()
+	}
+	watcherMTX.Unlock()
 
 	// on completion, clean up resources
-	session.Close()
+	if err := drafts.Save(); err != nil {
+		log.Writer.Warn("failed to save drafts", "error", err)
+	}
+	// the session may have been replaced by a new login
+	broker.CloseSession()
 	log.Destroy()
 }
 
-// Attempts to authenticate via the existing token, found in the config directory.
-// Automatically logs to the given logger.
-// Returns an authenticated session or nil.
-func loginViaToken() (session *revoltgo.Session) {
-	tknPth := path.Join(cfgdir.Get(), tokenFileName)
-	f, err := os.Open(tknPth)
+// Returns the path to the user's keybindings file.
+func keysPath() string {
+	return path.Join(cfgdir.Get(), keys.FileName)
+}
+
+var (
+	watcher    io.Closer // of the config files; nil if they could not be watched
+	watcherMTX sync.Mutex
+)
+
+// (Re)starts watching the config files, including those of the current account's profile.
+func watchConfig() {
+	w, err := config.Watch(pflag.CommandLine, []string{keysPath()}, reloadConfig)
 	if err != nil {
-		log.Writer.Warn("failed to open token file. Skipping token login.",
-			"error", err, "file path", tknPth)
-		return nil
+		log.Writer.Warn("failed to watch config files; changes require a restart", "error", err)
 	}
+	watcherMTX.Lock()
+	if watcher != nil {
+		watcher.Close()
+	}
+	watcher = w
+	watcherMTX.Unlock()
+}
 
-	token, err := io.ReadAll(f)
-	if err != nil {
+// Reloads the settings and keybindings from their files, sending the result to the program.
+// Keybindings are only replaced if the settings are also valid, so a bad edit changes nothing.
+func reloadConfig() {
+	settings, files, err := config.Load(pflag.CommandLine)
+	if err == nil {
+		err = keys.Load(keysPath())
+	}
+	log.Writer.Info("reloaded config files", "files", files, "error", err)
+	broker.Send(broker.ConfigChangedMsg{Settings: settings, Err: err})
+}
+
+// Attempts to authenticate as the given account via its existing token, found in the given store.
+// The token is checked against Revolt first; a rejected token is removed from the store. If Revolt
+// cannot be reached, the token is trusted and the connection manager keeps retrying.
+// Automatically logs to the given logger.
+// Returns an authenticated session or nil. The account's details are updated on validation.
+func loginViaToken(store credstore.Store, account *accounts.Account) (session *revoltgo.Session) {
+	token, err := store.Get(account.TokenKey())
+	if errors.Is(err, credstore.ErrNotFound) {
+		log.Writer.Info("no stored token. Skipping token login.", "store", store.Name())
+		return nil
+	} else if err != nil {
 		log.Writer.Warn("failed to read token. Skipping token login.",
-			"error", err, "file path", tknPth)
+			"error", err, "store", store.Name())
+		return nil
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		log.Writer.Info("stored token is empty. Skipping token login.", "store", store.Name())
+		return nil
+	}
+
+	if self, err := api.ValidateToken(account.API(), token); api.Unauthorized(err) {
+		log.Writer.Warn("stored token was rejected. Falling back to credentials.", "store", store.Name())
+		if err := store.Delete(account.TokenKey()); err != nil {
+			log.Writer.Warn("failed to delete rejected token", "store", store.Name(), "error", err)
+		}
 		return nil
+	} else if err != nil {
+		log.Writer.Warn("failed to validate token; continuing with it", "error", err)
+	} else if account.UserID != "" && self.ID != account.UserID {
+		log.Writer.Error("stored token belongs to another user. Falling back to credentials.",
+			"account", account.ID, "expected", account.UserID, "got", self.ID)
+		return nil
+	} else {
+		log.Writer.Info("validated stored token", "user", self.Username)
+		account.UserID, account.Username = self.ID, self.Username
+	}
+	return instance.NewSession(account.API(), token)
+}
+
+// Returns the passphrase of the encrypted token file, from the environment or by prompting.
+// If the file is new, the prompt asks for confirmation; if the last passphrase was wrong, it says so.
+func promptPassphrase(isNew, retry bool) (string, error) {
+	if pass := os.Getenv(passphraseEnv); pass != "" {
+		if retry { // the environment cannot be asked again
+			return "", fmt.Errorf("$%s: %w", passphraseEnv, credstore.ErrBadPassphrase)
+		}
+		return pass, nil
 	}
-	return revoltgo.New(string(token))
+	final, err := tea.NewProgram(credentials.NewPassphraseModel(isNew, retry), tea.WithAltScreen()).Run()
+	if err != nil {
+		return "", err
+	}
+	pm, ok := final.(credentials.PassphraseModel)
+	if !ok || pm.Killed {
+		return "", errors.New("no passphrase was given")
+	}
+	return pm.Passphrase, nil
 }
 
 // Attempts to authenticate via email and password.
 // Automatically logs to the given logger.
-// Returns an authenticated session.
+// Returns an authenticated session and the account it belongs to.
 // Main is expected to exit if nil is returned; the error will already have been logged.
-func loginViaCredentials() (session *revoltgo.Session, killed bool) {
+func loginViaCredentials() (session *revoltgo.Session, account accounts.Account, killed bool) {
 	// spawn the login dialog
 	credProg := tea.NewProgram(credentials.InitialModel(), tea.WithAltScreen())
 	finalCredModelRaw, err := credProg.Run()
 	if err != nil {
 		log.Writer.Error(err)
-		return nil, false
+		return nil, account, false
 	}
 
 	// cast the raw model to its actual model
 	credModel, ok := finalCredModelRaw.(credentials.Model)
 	if !ok {
 		log.Writer.Error("failed to cast final credential model")
-		return nil, false
+		return nil, account, false
 	}
 
 	// if the program was killed, do not try to authenticate
 	if credModel.Killed {
-		return nil, true
+		return nil, account, true
 	}
 
-	return credModel.Session, false
+	account = accounts.Account{ID: credModel.UserID, UserID: credModel.UserID, Email: credModel.Email,
+		Instance: instance.Current().API, SessionID: credModel.SessionID}
+	return credModel.Session, account, false
+}
+
+// Selects the account to log in to: the only one known, or the user's pick if there are several.
+// If an API is given, only accounts on that instance are considered.
+// If add is set, a new account should be logged in to.
+func chooseAccount(onlyAPI string) (account accounts.Account, add, killed bool) {
+	known := accounts.List()
+	if onlyAPI != "" {
+		known = slices.DeleteFunc(known, func(a accounts.Account) bool { return a.API() != onlyAPI })
+	}
+	switch len(known) {
+	case 0:
+		return account, true, false
+	case 1:
+		return known[0], false, false
+	}
+
+	var (
+		names    = make([]string, len(known))
+		selected int
+	)
+	last, _ := accounts.Last()
+	for i, a := range known {
+		names[i] = a.Name()
+		if a.ID == last.ID {
+			selected = i
+		}
+	}
+	final, err := tea.NewProgram(credentials.NewPickerModel(names, selected), tea.WithAltScreen()).Run()
+	if err != nil {
+		log.Writer.Error("failed to run account picker", "error", err)
+		return account, false, true
+	}
+	pm, ok := final.(credentials.PickerModel)
+	if !ok || pm.Killed {
+		return account, false, true
+	}
+	if pm.Choice >= len(known) {
+		return account, true, false
+	}
+	return known[pm.Choice], false, false
 }
@@ -0,0 +1,236 @@
+/*
+This package represents the account selection mode, where the user switches between the accounts
+they have logged in to (or adds another) without restarting.
+Switching connects with the chosen account's stored token; accounts without a usable token are
+logged in to anew via the login mode.
+The current account may also be logged out of here, or have its sessions managed (see the sessions
+mode).
+*/
+package accountselection
+
+import (
+	"errors"
+	"revolt_tui/accounts"
+	"revolt_tui/api"
+	"revolt_tui/broker"
+	"revolt_tui/credentials"
+	"revolt_tui/credstore"
+	"revolt_tui/instance"
+	"revolt_tui/keys"
+	"revolt_tui/log"
+	"revolt_tui/modes"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sentinelb51/revoltgo"
+)
+
+type Action struct {
+	store   credstore.Store
+	known   []accounts.Account // in the order given to the picker
+	picker  credentials.PickerModel
+	busy    bool // connecting to the chosen account
+	newMode modes.Mode
+}
+
+var _ modes.Action = &Action{}
+
+// Creates the account selection mode, reading tokens from the given store.
+func New(store credstore.Store) *Action {
+	return &Action{store: store}
+}
+
+func (a *Action) ChangeMode() (bool, modes.Mode) {
+	if a.newMode == modes.AccountSelection {
+		return false, modes.AccountSelection
+	}
+	return true, a.newMode
+}
+
+func (a *Action) Enter() (bool, tea.Cmd) {
+	a.newMode = modes.AccountSelection
+	a.busy = false
+	a.known = accounts.List()
+	cur, _ := accounts.Current()
+	if broker.Invalidated(broker.Session()) { // no account is in use
+		cur = accounts.Account{}
+	}
+	var (
+		names   = make([]string, len(a.known))
+		current = -1
+	)
+	for i, acct := range a.known {
+		names[i] = acct.Name()
+		if acct.ID == cur.ID {
+			current = i
+		}
+	}
+	a.picker = credentials.EmbeddedPickerModel(names, current)
+	return true, nil
+}
+
+func (a *Action) Update(msg tea.Msg) tea.Cmd {
+	switch m := msg.(type) {
+	case accountSessionMsg:
+		a.busy = false
+		if m.err != nil {
+			broker.PostError(m.err)
+			return nil
+		}
+		// later requests (ex: logging in anew) are made of the account's instance
+		instance.Set(m.instance)
+		if m.session == nil { // no usable token; log in anew
+			a.newMode = modes.Login
+			return nil
+		}
+		acct, err := accounts.Activate(a.store, m.account, m.session)
+		if err != nil {
+			log.Writer.Error("failed to use account profile", "account", acct.ID, "error", err)
+			broker.PostError(errors.New("switched to " + acct.Name() + ", but failed to load its profile: " + err.Error()))
+		} else {
+			broker.PostNotice("switched to " + acct.Name())
+		}
+		a.newMode = modes.ServerSelection
+		return nil
+	case loggedOutMsg:
+		a.busy = false
+		if m.err != nil {
+			broker.PostError(m.err)
+		} else {
+			broker.PostNotice("logged out of " + m.account.Name())
+		}
+		a.Enter() // relist, without a current account
+		return nil
+	case tea.KeyMsg:
+		if a.busy {
+			return nil
+		}
+		if !broker.Invalidated(broker.Session()) {
+			switch {
+			case keys.Matches(m, keys.AccountSelectionLogout):
+				if acct, ok := accounts.Current(); ok {
+					a.busy = true
+					return logout(a.store, acct)
+				}
+				return nil
+			case keys.Matches(m, keys.AccountSelectionSessions):
+				a.newMode = modes.Sessions
+				return nil
+			}
+		}
+	}
+
+	mdl, cmd := a.picker.Update(msg)
+	a.picker = mdl.(credentials.PickerModel)
+	switch {
+	case a.picker.Killed:
+		// without a usable session, there is nothing to return to
+		if broker.Invalidated(broker.Session()) {
+			return tea.Quit
+		}
+		a.newMode = modes.ServerSelection
+	case a.picker.Chosen:
+		a.picker.Chosen = false
+		if a.picker.Choice >= len(a.known) {
+			a.newMode = modes.Login
+			return nil
+		}
+		acct := a.known[a.picker.Choice]
+		if cur, ok := accounts.Current(); ok && cur.ID == acct.ID && !broker.Invalidated(broker.Session()) {
+			a.newMode = modes.ServerSelection
+			return nil
+		}
+		a.busy = true
+		return connect(a.store, acct)
+	}
+	return cmd
+}
+
+func (a *Action) View() string {
+	if a.busy {
+		return a.picker.View() + "working..."
+	}
+	if broker.Invalidated(broker.Session()) {
+		return a.picker.View()
+	}
+	return a.picker.View() + keys.Get(keys.AccountSelectionLogout).Help().Key + " to log out, " +
+		keys.Get(keys.AccountSelectionSessions).Help().Key + " to manage sessions"
+}
+
+func (a *Action) KeyScopes() []keys.Scope {
+	return []keys.Scope{keys.AccountSelection}
+}
+
+// returned when the chosen account's stored token has been checked.
+// session is nil if there is no usable token.
+type accountSessionMsg struct {
+	account  accounts.Account
+	instance instance.Info // of the account; made current unless err is set
+	session  *revoltgo.Session
+	err      error
+}
+
+// Prepares a session for the given account from its stored token.
+// The current instance is left as it is; the account's is returned for Update to switch to.
+func connect(store credstore.Store, acct accounts.Account) tea.Cmd {
+	return func() tea.Msg {
+		info, err := instance.Discover(acct.API())
+		if errors.Is(err, instance.ErrNotRevolt) {
+			return accountSessionMsg{account: acct, err: err}
+		}
+
+		token, err := store.Get(acct.TokenKey())
+		if errors.Is(err, credstore.ErrNotFound) {
+			return accountSessionMsg{account: acct, instance: info}
+		} else if err != nil {
+			log.Writer.Warn("failed to read token", "account", acct.ID, "error", err)
+			return accountSessionMsg{account: acct, err: errors.New("failed to read token: " + err.Error())}
+		}
+		token = strings.TrimSpace(token)
+
+		self, err := api.ValidateToken(acct.API(), token)
+		if api.Unauthorized(err) {
+			log.Writer.Warn("stored token was rejected", "account", acct.ID)
+			if err := store.Delete(acct.TokenKey()); err != nil {
+				log.Writer.Warn("failed to delete rejected token", "account", acct.ID, "error", err)
+			}
+			return accountSessionMsg{account: acct, instance: info}
+		} else if err != nil {
+			log.Writer.Warn("failed to validate token", "account", acct.ID, "error", err)
+			return accountSessionMsg{account: acct, err: errors.New("failed to reach Revolt: " + err.Error())}
+		}
+		// a token stored for another account must not be used as this one; log in anew
+		if acct.UserID != "" && self.ID != acct.UserID {
+			log.Writer.Error("stored token belongs to another user", "account", acct.ID,
+				"expected", acct.UserID, "got", self.ID)
+			return accountSessionMsg{account: acct, instance: info}
+		}
+		acct.UserID, acct.Username = self.ID, self.Username
+		return accountSessionMsg{account: acct, instance: info, session: instance.NewSession(acct.API(), token)}
+	}
+}
+
+// returned when logging out of an account completes
+type loggedOutMsg struct {
+	account accounts.Account
+	err     error
+}
+
+// Logs out of the given (current) account: its session is ended server-side and its token is
+// forgotten. The token is forgotten even if Revolt cannot be reached.
+func logout(store credstore.Store, acct accounts.Account) tea.Cmd {
+	s := broker.Session()
+	return func() tea.Msg {
+		broker.EndSession()
+		var errs []error
+		if err := api.Logout(s); err != nil {
+			log.Writer.Warn("failed to end session server-side", "account", acct.ID, "error", err)
+			errs = append(errs, errors.New("failed to end the session with Revolt: "+err.Error()))
+		}
+		if err := accounts.SignOut(store, acct); err != nil {
+			log.Writer.Warn("failed to forget token", "account", acct.ID, "error", err)
+			errs = append(errs, errors.New("failed to forget the stored token: "+err.Error()))
+		}
+		return loggedOutMsg{account: acct, err: errors.Join(errs...)}
+	}
+}
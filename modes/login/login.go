@@ -0,0 +1,92 @@
+/*
+This package represents the login mode, entered when the session's token is rejected while the
+program is running (see broker.SessionInvalidatedMsg) or when adding an account.
+It hosts the credentials model within the program, so the user can log in without restarting; the
+account logged in to is put to use, its session replaces the old one, and control returns to
+server selection.
+*/
+package login
+
+import (
+	"errors"
+	"revolt_tui/accounts"
+	"revolt_tui/broker"
+	"revolt_tui/credentials"
+	"revolt_tui/credstore"
+	"revolt_tui/instance"
+	"revolt_tui/keys"
+	"revolt_tui/log"
+	"revolt_tui/modes"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type Action struct {
+	store   credstore.Store // where the new token is kept
+	creds   credentials.Model
+	newMode modes.Mode
+}
+
+var _ modes.Action = &Action{}
+
+// Creates the login mode, storing new tokens in the given store.
+func New(store credstore.Store) *Action {
+	return &Action{store: store}
+}
+
+func (a *Action) ChangeMode() (bool, modes.Mode) {
+	if a.newMode == modes.Login {
+		return false, modes.Login
+	}
+	return true, a.newMode
+}
+
+func (a *Action) Enter() (bool, tea.Cmd) {
+	a.newMode = modes.Login
+	notice := "Log in to add an account (esc to cancel)."
+	switch {
+	case broker.LoggedOut(broker.Session()):
+		notice = "Log in to continue (esc to cancel)."
+	case broker.Invalidated(broker.Session()):
+		notice = "Your session has expired or was revoked; please log in again."
+	}
+	a.creds = credentials.ReloginModel(notice)
+	return true, nil
+}
+
+func (a *Action) Update(msg tea.Msg) tea.Cmd {
+	if _, ok := msg.(broker.SessionInvalidatedMsg); ok { // already logging in
+		return nil
+	}
+	mdl, cmd := a.creds.Update(msg)
+	a.creds = mdl.(credentials.Model)
+
+	if a.creds.Killed {
+		// after a revocation, there is nothing to return to
+		if broker.Invalidated(broker.Session()) && !broker.LoggedOut(broker.Session()) {
+			return tea.Quit
+		}
+		a.newMode = modes.AccountSelection
+		return nil
+	}
+	if session := a.creds.Session; session != nil {
+		acct := accounts.Account{ID: a.creds.UserID, UserID: a.creds.UserID, Email: a.creds.Email,
+			Instance: instance.Current().API, SessionID: a.creds.SessionID}
+		acct, err := accounts.Activate(a.store, acct, session)
+		if err != nil {
+			log.Writer.Error("failed to use account profile", "account", acct.ID, "error", err)
+			broker.PostError(errors.New("failed to load account profile: " + err.Error()))
+		}
+		a.newMode = modes.ServerSelection
+		return nil
+	}
+	return cmd
+}
+
+func (a *Action) View() string {
+	return a.creds.View()
+}
+
+func (a *Action) KeyScopes() []keys.Scope {
+	return []keys.Scope{keys.Global}
+}
@@ -7,10 +7,12 @@ Each mode must register the functions required for it to work:
     Returns whether or not the setup was successful (the action should do its own logging, hence a simple bool).
  3. Update. Update is the function that the controller calls in place of its own Update() function.
  4. View. Like Update, but for View functions.
+ 5. KeyScopes. KeyScopes returns the keybinding scopes currently active in the mode, used to generate the help view.
 */
 package modes
 
 import (
+	"revolt_tui/keys"
 	"revolt_tui/log"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -23,6 +25,12 @@ const (
 	ServerSelection Mode = iota
 	// Interacting with a selected server
 	Server
+	// Logging in again after the session's token was rejected, or to add an account
+	Login
+	// Switching between accounts
+	AccountSelection
+	// Managing the current account's sessions
+	Sessions
 )
 
 type Action interface {
@@ -32,6 +40,8 @@ type Action interface {
 	Enter() (success bool, init tea.Cmd)
 	Update(msg tea.Msg) tea.Cmd
 	View() string
+	// Returns the keybinding scopes currently in effect, for display in the help view
+	KeyScopes() []keys.Scope
 }
 
 var modes map[Mode]Action = make(map[Mode]Action)
@@ -2,10 +2,14 @@ package server
 
 import (
 	"revolt_tui/broker"
+	"revolt_tui/drafts"
+	"revolt_tui/keys"
 	"revolt_tui/log"
+	"strconv"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/sentinelb51/revoltgo"
@@ -19,11 +23,21 @@ type channelTab struct {
 	list          list.Model
 	activeChannel *revoltgo.Channel
 	selectionErr  string
+
+	server    *revoltgo.Server
+	channels  map[string]*revoltgo.Channel // channel ID -> channel; nil if it could not be fetched
+	pending   map[string]bool              // channel ID -> is being fetched?
+	collapsed map[string]bool              // category ID -> is collapsed?
+	spinner   spinner.Model                // shared by every pending item
 }
 
 var _ tab = &channelTab{}
 
-const changeChannelErrString string = "an error has occurred changing channel to "
+const (
+	changeChannelErrString string = "an error has occurred changing channel to "
+	voiceUnsupportedString string = "only text channels can be opened"
+	pendingString          string = "channel is still loading"
+)
 
 func (tc *channelTab) Name() string {
 	return "channels"
@@ -33,45 +47,144 @@ func (tc *channelTab) Enabled() bool {
 	return true
 }
 
-func (c *channelTab) Init(s *revoltgo.Server, width, height int) {
+// Populates the list from the broker's cache, fetching any channels missing from it in the background.
+func (c *channelTab) Init(s *revoltgo.Server, width, height int) tea.Cmd {
 	// s is nil checked prior to call
-	var itms []list.Item // = make([]list.Item, len(s.Channels))
+	// a new server has been entered; forget the channel selected in the last one
+	c.activeChannel = nil
+	broker.SetCurrentChannel(nil)
+	c.selectionErr = ""
+
+	c.server = s
+	c.collapsed = make(map[string]bool)
+	c.channels = make(map[string]*revoltgo.Channel, len(s.Channels))
+	c.pending = make(map[string]bool)
+	var cmds []tea.Cmd
 	for _, chID := range s.Channels {
-		ci := channelItem{channelID: chID}
-		if channel, err := broker.Session.Channel(chID); err != nil {
-			log.Writer.Warn("failed to fetch channel", "id", chID, "error", err)
-			ci.name = "[unknown]"
-			ci.description = "failed to retrieve channel information"
-		} else if channel.ChannelType == revoltgo.ChannelTypeText {
-			ci.name = channel.Name
-			ci.description = channel.Description
-			ci.channel = channel
-
-			itms = append(itms, ci)
+		if ch := broker.Channel(chID); ch != nil {
+			c.channels[chID] = ch
+			continue
 		}
+		c.pending[chID] = true
+		cmds = append(cmds, fetchChannel(s.ID, chID))
+	}
 
-		//itms[i] = ci
+	c.list = list.New(nil, list.NewDefaultDelegate(), width, height-1)
+	c.list.Title = s.Name
+	c.spinner = newSpinner()
+	c.rebuild()
+
+	if len(cmds) > 0 {
+		cmds = append(cmds, addressTick(CHANNELS, c.spinner.Tick))
 	}
+	return tea.Batch(cmds...)
+}
 
-	c.list = list.New(itms, list.NewDefaultDelegate(), width, 30)
+// Regenerates the list items from the server's categories, respecting collapsed categories.
+// Channels not in any category are listed first, as in the official client.
+func (c *channelTab) rebuild() {
+	var (
+		itms         []list.Item
+		categorized  = make(map[string]bool)
+		categoryItms []list.Item
+	)
+	for _, cat := range c.server.Categories {
+		if cat == nil {
+			continue
+		}
+		categoryItms = append(categoryItms, categoryItem{
+			categoryID: cat.ID, title: cat.Title, count: len(cat.Channels), collapsed: c.collapsed[cat.ID]})
+		for _, chID := range cat.Channels {
+			categorized[chID] = true
+			if !c.collapsed[cat.ID] {
+				categoryItms = append(categoryItms, c.item(chID))
+			}
+		}
+	}
+	for _, chID := range c.server.Channels {
+		if !categorized[chID] {
+			itms = append(itms, c.item(chID))
+		}
+	}
+	itms = append(itms, categoryItms...)
 
+	c.list.SetItems(itms)
+}
+
+// Generates the list item for the given channel ID.
+func (c *channelTab) item(chID string) channelItem {
+	ci := channelItem{channelID: chID, channel: c.channels[chID]}
+	if c.pending[chID] {
+		ci.spinner = &c.spinner
+		ci.name = chID
+		ci.description = "loading..."
+		return ci
+	}
+	if ci.channel == nil {
+		ci.name = "[unknown]"
+		ci.description = "failed to retrieve channel information"
+		return ci
+	}
+	ci.name = ci.channel.Name
+	ci.description = ci.channel.Description
+	ci.nsfw = ci.channel.NSFW
+	// the user cannot send messages in locked channels; channels are not marked on a guess
+	ci.locked = !broker.MayHaveChannelPermission(chID, broker.PermSendMessage)
+	return ci
 }
 
 func (tc *channelTab) Update(msg tea.Msg) (tea.Cmd, tabConst) {
-	// window size updates are handled by the main server Update; only need to check for keymsg
-	if keyMsg, ok := msg.(tea.KeyMsg); ok && keyMsg.Type == tea.KeyEnter {
+	switch m := msg.(type) {
+	case tea.WindowSizeMsg:
+		tc.list.SetSize(m.Width, m.Height-1) // leave room for the selection error line
+		return nil, CHANNELS
+	case channelFetchedMsg:
+		if tc.server == nil || m.serverID != tc.server.ID { // arrived after the server was left
+			return nil, CHANNELS
+		}
+		delete(tc.pending, m.channelID)
+		tc.channels[m.channelID] = m.channel
+		tc.rebuild()
+		return nil, CHANNELS
+	case spinnerTickMsg:
+		if len(tc.pending) == 0 { // let the spinner die
+			return nil, CHANNELS
+		}
+		var cmd tea.Cmd
+		tc.spinner, cmd = tc.spinner.Update(m.tick)
+		return addressTick(CHANNELS, cmd), CHANNELS
+	}
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && keys.Matches(keyMsg, keys.ChannelsSelect) &&
+		tc.list.FilterState() != list.Filtering {
 		baseItm := tc.list.SelectedItem()
+		if baseItm == nil {
+			return nil, CHANNELS
+		}
+		if cat, ok := baseItm.(categoryItem); ok {
+			tc.collapsed[cat.categoryID] = !tc.collapsed[cat.categoryID]
+			tc.rebuild()
+			return nil, CHANNELS
+		}
 		itm, ok := baseItm.(channelItem)
 		if !ok {
 			log.Writer.Warn("Failed to set active channel: base list item failed cast", "base item", baseItm)
 			tc.selectionErr = changeChannelErrString + baseItm.FilterValue()
 			return nil, CHANNELS
 		}
+		if itm.spinner != nil {
+			tc.selectionErr = pendingString
+			return nil, CHANNELS
+		}
 		if itm.channel == nil {
 			log.Writer.Warn("Failed to set active channel: cast item.channel is nil", "item", itm)
 			tc.selectionErr = changeChannelErrString + baseItm.FilterValue()
 			return nil, CHANNELS
 		}
+		if itm.channel.ChannelType != revoltgo.ChannelTypeText {
+			tc.selectionErr = voiceUnsupportedString
+			return nil, CHANNELS
+		}
+		tc.selectionErr = ""
 		tc.activeChannel = itm.channel
 		// switch to chat channel
 		return textinput.Blink, CHAT
@@ -90,24 +203,97 @@ func (tc *channelTab) View() string {
 	return sb.String()
 }
 
+//#region list items
+
 // channel representation for the channelList list.Model
 type channelItem struct {
 	name        string
 	description string
 	channelID   string
 	channel     *revoltgo.Channel
+	nsfw        bool
+	locked      bool
+	spinner     *spinner.Model // set while the channel is being fetched
 }
 
 var _ list.Item = channelItem{} // check interface
 
+const (
+	draftMarker  string = "✎ "
+	nsfwMarker   string = "nsfw"
+	lockedMarker string = "locked"
+)
+
+// Returns the icon denoting the type of the channel.
+func (ci channelItem) icon() string {
+	if ci.channel == nil {
+		return "?"
+	}
+	switch ci.channel.ChannelType {
+	case revoltgo.ChannelTypeText:
+		return "#"
+	case revoltgo.ChannelTypeVoice:
+		return "♪"
+	}
+	return "?"
+}
+
 func (ci channelItem) Title() string {
-	return ci.name
+	icon := ci.icon()
+	if ci.spinner != nil {
+		icon = ci.spinner.View()
+	}
+	title := icon + " " + ci.name
+	if drafts.Has(ci.channelID) {
+		return draftMarker + title
+	}
+	return title
 }
 
 func (ci channelItem) Description() string {
-	return ci.description
+	var tags []string
+	if ci.nsfw {
+		tags = append(tags, nsfwMarker)
+	}
+	if ci.locked {
+		tags = append(tags, lockedMarker)
+	}
+	if tags == nil {
+		return ci.description
+	}
+	return "[" + strings.Join(tags, ", ") + "] " + ci.description
 }
 
 func (ci channelItem) FilterValue() string {
 	return ci.name
 }
+
+// category header for the channelList list.Model; selecting it toggles the category
+type categoryItem struct {
+	categoryID string
+	title      string
+	count      int // number of channels in the category
+	collapsed  bool
+}
+
+var _ list.Item = categoryItem{} // check interface
+
+func (ci categoryItem) Title() string {
+	if ci.collapsed {
+		return "▸ " + strings.ToUpper(ci.title)
+	}
+	return "▾ " + strings.ToUpper(ci.title)
+}
+
+func (ci categoryItem) Description() string {
+	if ci.count == 1 {
+		return "1 channel"
+	}
+	return strconv.Itoa(ci.count) + " channels"
+}
+
+func (ci categoryItem) FilterValue() string {
+	return ci.title
+}
+
+//#endregion list items
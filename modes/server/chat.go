@@ -1,9 +1,17 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"os/exec"
+	"revolt_tui/api"
 	"revolt_tui/broker"
+	"revolt_tui/drafts"
+	"revolt_tui/instance"
+	"revolt_tui/keys"
 	"revolt_tui/log"
+	"revolt_tui/outbox"
 	"revolt_tui/stylesheet"
 	"revolt_tui/stylesheet/colors"
 	"strings"
@@ -13,6 +21,7 @@ import (
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/oklog/ulid/v2"
 	"github.com/sentinelb51/revoltgo"
 )
 
@@ -20,6 +29,12 @@ const (
 	initialMessageFetchLimit int = 30
 	messageRefreshLimit      int = 75
 	viewportMessageLimit     int = 15
+	composeMaxHeight         int = 8 // compose area grows with its content, up to this many lines
+	composeBorderSize        int = 2 // rows, and columns, taken by the compose area's border
+	maxSendAttempts          int = 5 // automatic attempts before a message is marked failed
+	initialSendBackoff           = time.Second
+	maxSendBackoff               = 30 * time.Second
+	pollInterval                 = 15 * time.Second // between fetches of new messages
 )
 
 type chatTab struct {
@@ -28,9 +43,21 @@ type chatTab struct {
 	newMessageBox textarea.Model
 	err           error
 	msgs          messageStore
+	width, height int    // space available to the tab
+	channelID     string // channel the compose area currently holds the draft of
+	pollGen       int    // identifies the current poll loop; see pollMsg
+
+	// message selection, for bulk deletion (see selection.go)
+	selecting bool
+	cursorID  string          // message under the cursor
+	marked    map[string]bool // message ID -> is marked for deletion?
+	modal     *modal
 }
 
-var _ tab = &chatTab{}
+var (
+	_ tab         = &chatTab{}
+	_ modalHolder = &chatTab{}
+)
 
 // Create the empty chat chat skeleton, with reference to its "parent" channel tab.
 // Most initialization should go in Init, but this is required because it needs reference to the channel tab.
@@ -47,118 +74,438 @@ func (cht *chatTab) Enabled() bool {
 	return cht.channelTab.activeChannel != nil
 }
 
-func (cht *chatTab) Init(s *revoltgo.Server, width, height int) {
-	// spawn a thread to watch for updates for when a channel is selected
-	go func() {
-		for {
-			time.Sleep(time.Second * 15)
-			if cht.channelTab.activeChannel == nil {
-				continue
-			}
-			// TODO check for channel change; clear (or archive to SQLite) cache on channel change
-
-			// if we have yet to fetch any messages, fetch the most recent set
-			if cht.msgs.newestMessageID == "" {
-				msgs, err := broker.Session.ChannelMessages(cht.channelTab.activeChannel.ID,
-					revoltgo.ChannelMessagesParams{
-						Limit: initialMessageFetchLimit,
-						Sort:  revoltgo.ChannelMessagesParamsSortTypeLatest,
-					})
-				if err != nil {
-					log.Writer.Warn("failed to fetch base channel message set",
-						"channelID", cht.channelTab.activeChannel.ID,
-						"error", err)
-					continue
-				}
-				msgCount := len(msgs)
-				cht.msgs.newestMessageID = msgs[msgCount-1].ID
-				log.Writer.Debug("fetched base latest channel message set",
-					"requested", initialMessageFetchLimit,
-					"received", msgCount,
-					"newest ID", cht.msgs.newestMessageID,
-				)
-				// set these messages as our current set
-				cht.msgs.messages = msgs
-
-				cht.populateViewport()
-			} else { // fetch any new messages
-				msgs, err := broker.Session.ChannelMessages(cht.channelTab.activeChannel.ID,
-					revoltgo.ChannelMessagesParams{
-						Limit: messageRefreshLimit,
-						Sort:  revoltgo.ChannelMessagesParamsSortTypeLatest,
-						After: cht.msgs.newestMessageID,
-					})
-				if err != nil {
-					log.Writer.Warn("failed to refresh latest channel messages",
-						"channelID", cht.channelTab.activeChannel.ID,
-						"error", err)
-					continue
-				}
-				msgCount := len(msgs)
-				if msgCount == 0 { // no new messages
-					continue
-				}
-				afterMessageID := cht.msgs.newestMessageID
-				cht.msgs.newestMessageID = msgs[msgCount-1].ID
-				log.Writer.Debug("refreshed latest channel messages",
-					"requested", messageRefreshLimit,
-					"received", msgCount,
-					"previous newest ID", afterMessageID,
-					"newest ID", cht.msgs.newestMessageID,
-				)
-				// if we reached up to our limit, a shit load of messages arrived while sleeping
-				// we may need to query for older messages and insert that set into the middle of our array
-				// TODO
-
-				// prepend this new message set
-				cht.msgs.messages = append(msgs, cht.msgs.messages...)
-
-				cht.populateViewport()
-			}
-		}
-	}()
+func (cht *chatTab) modalOpen() bool {
+	return cht.modal != nil
+}
+
+func (cht *chatTab) Init(s *revoltgo.Server, width, height int) tea.Cmd {
+	// stash the draft from the last server visited
+	if cht.channelID != "" {
+		drafts.Set(cht.channelID, cht.newMessageBox.Value())
+		cht.channelID = ""
+	}
+
+	cht.selecting, cht.marked, cht.modal = false, nil, nil
 
 	cht.newMessageBox = textarea.New()
-	cht.newMessageBox.MaxHeight = 4
+	cht.newMessageBox.MaxHeight = composeMaxHeight
+	cht.newMessageBox.ShowLineNumbers = false
+	// the send key takes precedence over the default newline keys, so newlines need their own binding
+	cht.newMessageBox.KeyMap.InsertNewline = keys.Get(keys.ChatNewline)
 	cht.newMessageBox.Focus()
 
-	// include height margins in the viewport
-	cht.msgView = viewport.New(width, height-cht.newMessageBox.MaxHeight-1)
+	cht.msgView = viewport.New(width, height)
+	cht.width, cht.height = width, height
+	cht.resize()
 
+	// start polling for new messages, ending the poll loop of any previous visit
+	cht.pollGen++
+	return cht.poll()
+}
+
+// asks the chat tab to poll for new messages.
+// gen identifies the poll loop, so that loops started by previous visits end.
+type pollMsg struct {
+	gen int
+}
+
+func (pollMsg) recipient() tabConst { return CHAT }
+
+// returned when a fetch of a channel's latest messages completes
+type messagesFetchedMsg struct {
+	channelID string
+	after     string // ID the messages were fetched after; empty for the initial set
+	msgs      []*revoltgo.Message
+	err       error
+}
+
+func (messagesFetchedMsg) recipient() tabConst { return CHAT }
+
+// Schedules the next poll of the current loop.
+func (cht *chatTab) poll() tea.Cmd {
+	gen := cht.pollGen
+	return tea.Tick(pollInterval, func(time.Time) tea.Msg { return pollMsg{gen: gen} })
+}
+
+// Fetches the latest messages of the active channel: the most recent set if none have been fetched,
+// otherwise any that arrived after the newest known message.
+// Called by the poller, on selecting a channel, and after a reconnect, to backfill missed messages.
+func (cht *chatTab) fetchMessages() tea.Cmd {
+	if cht.channelID == "" {
+		return nil
+	}
+	var (
+		s         = broker.Session()
+		channelID = cht.channelID
+		after     = cht.msgs.newestMessageID
+	)
+	return func() tea.Msg {
+		params := revoltgo.ChannelMessagesParams{
+			Limit: initialMessageFetchLimit,
+			Sort:  revoltgo.ChannelMessagesParamsSortTypeLatest,
+		}
+		if after != "" {
+			params.Limit, params.After = messageRefreshLimit, after
+		}
+		msgs, err := s.ChannelMessages(channelID, params)
+		return messagesFetchedMsg{channelID: channelID, after: after, msgs: msgs, err: err}
+	}
+}
+
+// Adds fetched messages to the store, unless the channel has changed or another fetch has already
+// advanced the store since they were requested.
+func (cht *chatTab) onFetched(msg messagesFetchedMsg) {
+	if msg.err != nil {
+		log.Writer.Warn("failed to fetch channel messages",
+			"channelID", msg.channelID, "after", msg.after, "error", msg.err)
+		return
+	}
+	if msg.channelID != cht.channelID || msg.after != cht.msgs.newestMessageID || len(msg.msgs) == 0 {
+		return
+	}
+	cht.msgs.newestMessageID = msg.msgs[0].ID
+	log.Writer.Debug("fetched latest channel messages",
+		"received", len(msg.msgs),
+		"previous newest ID", msg.after,
+		"newest ID", cht.msgs.newestMessageID,
+	)
+	// if we reached up to our limit, a shit load of messages arrived while sleeping
+	// we may need to query for older messages and insert that set into the middle of our array
+	// TODO
+
+	// prepend the new messages (or set them, if they are the initial set)
+	cht.msgs.messages = append(msg.msgs, cht.msgs.messages...)
+	reconcileOutbox(msg.msgs)
+	cht.populateViewport()
+}
+
+// Fits the compose area to its content (within composeMaxHeight) and gives the remaining height to
+// the viewport.
+func (cht *chatTab) resize() {
+	cht.newMessageBox.SetWidth(cht.width - composeBorderSize)
+	cht.newMessageBox.SetHeight(min(composeRows(cht.newMessageBox.Value(), cht.newMessageBox.Width()), composeMaxHeight))
+
+	cht.msgView.Width = cht.width
+	// include height margins (compose border and error line) in the viewport
+	cht.msgView.Height = max(cht.height-cht.newMessageBox.Height()-composeBorderSize-1, 0)
+}
+
+// Returns the number of rows the given text occupies in a compose area of the given text width,
+// counting soft-wrapped rows. A row is reserved after the text of each line for the cursor.
+func composeRows(text string, width int) int {
+	if width < 1 {
+		width = 1
+	}
+	var rows int
+	for _, line := range strings.Split(text, "\n") {
+		rows += lipgloss.Width(line)/width + 1
+	}
+	return rows
 }
 
 func (cht *chatTab) Update(msg tea.Msg) (tea.Cmd, tabConst) {
+	if cht.syncChannel() {
+		return tea.Batch(cht.resumePending(), cht.fetchMessages(), cht.update(msg)), CHAT
+	}
+	return cht.update(msg), CHAT
+}
+
+// helper function for Update, run after the active channel has been synchronized.
+func (cht *chatTab) update(msg tea.Msg) tea.Cmd {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		cht.width, cht.height = msg.Width, msg.Height
+		cht.resize()
+		return nil
+	case editorFinishedMsg:
+		cht.err = msg.err
+		if msg.err == nil {
+			cht.newMessageBox.SetValue(strings.TrimRight(msg.text, "\n"))
+			drafts.Set(cht.channelID, cht.newMessageBox.Value())
+			cht.resize()
+		}
+		return textarea.Blink
+	case broker.ConfigChangedMsg: // redraw in the new theme and timestamp format, and pick up rebound newline keys
+		cht.newMessageBox.KeyMap.InsertNewline = keys.Get(keys.ChatNewline)
+		cht.populateViewport()
+		return nil
+	case broker.ConnectionStateMsg:
+		if msg.State == broker.Connected { // backfill anything missed while disconnected
+			return cht.fetchMessages()
+		}
+		return nil
+	case pollMsg:
+		if msg.gen != cht.pollGen {
+			return nil
+		}
+		return tea.Batch(cht.fetchMessages(), cht.poll())
+	case messagesFetchedMsg:
+		cht.onFetched(msg)
+		return nil
+	case deliveryMsg:
+		return cht.onDelivery(msg)
+	case retrySendMsg:
+		if e, ok := outbox.Get(msg.nonce); ok && e.Status == outbox.Pending {
+			return deliver(e)
+		}
+		return nil
+	case bulkDeletedMsg:
+		cht.onBulkDeleted(msg)
+		return nil
+	case tea.KeyMsg:
+		if cht.modal != nil {
+			cmd, dismissed := cht.modal.update(msg)
+			if dismissed {
+				cht.modal = nil
+			}
+			return cmd
+		}
+		if cht.selecting {
+			return cht.updateSelection(msg)
+		}
+		switch {
+		case keys.Matches(msg, keys.ChatSelect):
+			cht.startSelection()
+			return nil
+		case keys.Matches(msg, keys.ChatEditor):
+			return cht.openEditor()
+		case keys.Matches(msg, keys.ChatRetry):
+			return cht.retryFailed()
+		case keys.Matches(msg, keys.ChatDiscard):
+			cht.discardFailed()
+			return nil
+		}
+	}
 
-	// check for an enter key to submit the current state of the message compose area
-	if keyMsg, ok := msg.(tea.KeyMsg); ok && keyMsg.Type == tea.KeyEnter {
+	// check for the send key to submit the current state of the message compose area
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && keys.Matches(keyMsg, keys.ChatSend) {
 		msgText := cht.newMessageBox.Value()
 		if strings.TrimSpace(msgText) == "" {
 			log.Writer.Debug("refusing to send empty message")
-			return textarea.Blink, CHAT
+			return textarea.Blink
 		}
-		// attempt to submit the message
-		msg := revoltgo.MessageSend{Content: msgText}
-
-		newMsg, err := broker.Session.ChannelMessageSend(cht.channelTab.activeChannel.ID, msg)
-		if err != nil {
-			log.Writer.Warn("failed to send message", "error", err)
-			return textarea.Blink, CHAT
+		// when the permissions are unknown, Revolt refuses the message itself if need be
+		if !broker.MayHaveChannelPermission(cht.channelID, broker.PermSendMessage) {
+			broker.PostError(errors.New(noSendPermission))
+			return nil
 		}
-
-		cht.msgs.messages = append(cht.msgs.messages, newMsg) // attach the message to our list of displayed messages
-		cht.msgs.newestMessageID = newMsg.ID
+		// queue the message; it is displayed as pending until Revolt accepts it
+		entry := outbox.Add(cht.channelTab.activeChannel.ID, msgText)
 		cht.populateViewport()
 
 		cht.newMessageBox.SetValue("") // clear out the existing message
+		drafts.Set(cht.channelID, "")
+		cht.resize()
+		// do not pass the send key on to the compose area
+		return tea.Batch(textarea.Blink, deliver(entry))
 	}
 
 	cmds := make([]tea.Cmd, 2)
 	cht.msgView, cmds[0] = cht.msgView.Update(msg)
 	cht.newMessageBox, cmds[1] = cht.newMessageBox.Update(msg)
-	return tea.Batch(cmds...), CHAT
+	drafts.Set(cht.channelID, cht.newMessageBox.Value())
+	cht.resize()
+	return tea.Batch(cmds...)
+}
+
+// Checks if a different channel has been selected since the last update.
+// If so, the draft of the previous channel is stashed and that of the new channel is restored.
+// Returns whether the channel changed.
+func (cht *chatTab) syncChannel() bool {
+	active := cht.channelTab.activeChannel
+	if active == nil || active.ID == cht.channelID {
+		return false
+	}
+	if cht.channelID != "" {
+		drafts.Set(cht.channelID, cht.newMessageBox.Value())
+		if err := drafts.Save(); err != nil {
+			log.Writer.Warn("failed to save drafts", "error", err)
+		}
+	}
+	cht.channelID = active.ID
+	broker.SetCurrentChannel(active)
+	cht.endSelection()
+	cht.newMessageBox.SetValue(drafts.Get(active.ID))
+	cht.newMessageBox.Placeholder = ""
+	if !broker.MayHaveChannelPermission(active.ID, broker.PermSendMessage) {
+		cht.newMessageBox.Placeholder = noSendPermission
+	}
+	// drop the previous channel's messages; the new channel's are fetched by the caller
+	cht.msgs = messageStore{}
+	cht.populateViewport()
+	cht.resize()
+	return true
 }
 
+const noSendPermission string = "you do not have permission to send messages in this channel"
+
+//#region outbox
+
+const outboxSegment string = "outbox" // status bar segment key
+
+// the result of an attempt to deliver an outbox entry
+type deliveryMsg struct {
+	nonce string
+	msg   *revoltgo.Message
+	err   error
+}
+
+func (deliveryMsg) recipient() tabConst { return CHAT }
+
+// requests another attempt at delivering an outbox entry, after backing off
+type retrySendMsg struct {
+	nonce string
+}
+
+func (retrySendMsg) recipient() tabConst { return CHAT }
+
+// Attempts to send the given outbox entry.
+func deliver(e outbox.Entry) tea.Cmd {
+	session := broker.Session()
+	return func() tea.Msg {
+		m, err := api.SendMessage(session, e.ChannelID, e.Nonce, revoltgo.MessageSend{Content: e.Content})
+		return deliveryMsg{nonce: e.Nonce, msg: m, err: err}
+	}
+}
+
+// Handles the result of a delivery attempt, scheduling a retry with exponential backoff on failure.
+func (cht *chatTab) onDelivery(d deliveryMsg) tea.Cmd {
+	if d.err == nil {
+		outbox.Remove(d.nonce)
+		if d.msg != nil && d.msg.Channel == cht.channelID && !cht.msgs.contains(d.msg.ID) {
+			cht.msgs.messages = append([]*revoltgo.Message{d.msg}, cht.msgs.messages...)
+			cht.msgs.newestMessageID = d.msg.ID
+		}
+		cht.populateViewport()
+		return nil
+	}
+
+	log.Writer.Warn("failed to send message", "nonce", d.nonce, "error", d.err)
+	e, ok := outbox.Fail(d.nonce, d.err, maxSendAttempts)
+	cht.populateViewport()
+	if !ok {
+		return nil
+	}
+	if e.Status == outbox.Failed {
+		broker.PostError(fmt.Errorf("message failed to send: %v", d.err))
+		return nil
+	}
+	backoff := initialSendBackoff << (e.Attempts - 1)
+	if backoff > maxSendBackoff {
+		backoff = maxSendBackoff
+	}
+	return tea.Tick(backoff, func(time.Time) tea.Msg { return retrySendMsg{nonce: e.Nonce} })
+}
+
+// Resumes delivery of every failed message in the current channel.
+func (cht *chatTab) retryFailed() tea.Cmd {
+	var cmds []tea.Cmd
+	for _, e := range outbox.Channel(cht.channelID) {
+		if e.Status != outbox.Failed {
+			continue
+		}
+		if e, ok := outbox.Reset(e.Nonce); ok {
+			cmds = append(cmds, deliver(e))
+		}
+	}
+	cht.populateViewport()
+	return tea.Batch(cmds...)
+}
+
+// Drops the most recent failed message in the current channel, returning its content to the compose
+// area if the area is empty.
+func (cht *chatTab) discardFailed() {
+	es := outbox.Channel(cht.channelID)
+	for i := len(es) - 1; i >= 0; i-- {
+		if es[i].Status != outbox.Failed {
+			continue
+		}
+		outbox.Remove(es[i].Nonce)
+		if cht.newMessageBox.Value() == "" {
+			cht.newMessageBox.SetValue(es[i].Content)
+			cht.resize()
+		}
+		break
+	}
+	cht.populateViewport()
+}
+
+// Resumes delivery of pending messages left over from a previous run (or a previous visit) in the
+// current channel.
+func (cht *chatTab) resumePending() tea.Cmd {
+	var cmds []tea.Cmd
+	for _, e := range outbox.Channel(cht.channelID) {
+		if e.Status == outbox.Pending {
+			cmds = append(cmds, deliver(e))
+		}
+	}
+	return tea.Batch(cmds...)
+}
+
+// Removes outbox entries that the given (fetched) messages show were already delivered.
+func reconcileOutbox(msgs []*revoltgo.Message) {
+	for _, m := range msgs {
+		if m != nil && m.Nonce != "" {
+			outbox.Remove(m.Nonce)
+		}
+	}
+}
+
+//#endregion outbox
+
+//#region external editor
+
+// returned once the external editor exits
+type editorFinishedMsg struct {
+	text string
+	err  error
+}
+
+// Writes the current draft to a temporary file and suspends the TUI to open it in the user's editor.
+// The edited file is loaded back into the compose area via editorFinishedMsg.
+func (cht *chatTab) openEditor() tea.Cmd {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		cht.err = errors.New("neither $VISUAL nor $EDITOR is set")
+		return nil
+	}
+
+	f, err := os.CreateTemp("", "revolttui-*.md")
+	if err != nil {
+		log.Writer.Warn("failed to create draft file", "error", err)
+		cht.err = err
+		return nil
+	}
+	_, err = f.WriteString(cht.newMessageBox.Value())
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		cht.err = err
+		return nil
+	}
+
+	// $EDITOR may contain arguments (ex: "code --wait"), so let the shell split it
+	c := exec.Command("sh", "-c", editor+` "$1"`, "sh", f.Name())
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		defer os.Remove(f.Name())
+		if err != nil {
+			log.Writer.Warn("editor exited with an error", "editor", editor, "error", err)
+			return editorFinishedMsg{err: err}
+		}
+		text, err := os.ReadFile(f.Name())
+		return editorFinishedMsg{text: string(text), err: err}
+	})
+}
+
+//#endregion external editor
+
 func (cht *chatTab) View() string {
+	if cht.modal != nil {
+		return cht.modal.View(cht.width, cht.height)
+	}
 	// draw a border around the message box to represent that it is highlighted
 
 	existingMsgs := cht.msgView.View()
@@ -177,35 +524,103 @@ type messageStore struct {
 	messages        []*revoltgo.Message // local message cache, sorted newest [0] -> oldest [len]
 }
 
-var (
-	timestampStyle lipgloss.Style = lipgloss.NewStyle().Foreground(colors.MessageTimestamp).Italic(true)
-	authorStyle    lipgloss.Style = lipgloss.NewStyle().Foreground(colors.MessageAuthor)
-)
+// is the message with the given ID in the store?
+func (ms *messageStore) contains(id string) bool {
+	for _, m := range ms.messages {
+		if m != nil && m.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+var timestampStyle, authorStyle, pendingStyle, failedStyle lipgloss.Style
+
+func init() {
+	colors.OnChange(func() {
+		timestampStyle = lipgloss.NewStyle().Foreground(colors.MessageTimestamp).Italic(true)
+		authorStyle = lipgloss.NewStyle().Foreground(colors.MessageAuthor)
+		pendingStyle = lipgloss.NewStyle().Foreground(colors.MessagePending)
+		failedStyle = lipgloss.NewStyle().Foreground(colors.Error)
+	})
+}
 
-// sets the content in chat's viewport, automatically jumping to the newest message (end of the VP) whenever called
+// sets the content in chat's viewport, automatically jumping to the newest message (end of the VP) whenever called.
+// Messages still in the outbox are displayed after (below) the delivered messages.
 func (cht *chatTab) populateViewport() {
 	var sb strings.Builder
-	totalMsgCount := len(cht.msgs.messages)
-	for i := 0; i < viewportMessageLimit && i < totalMsgCount; i++ {
-		if cht.msgs.messages[i] == nil {
-			continue
+	cursorLine := -1
+	visible := cht.visibleMessages()
+	// draw oldest to newest, so the newest message is at the bottom
+	for i := len(visible) - 1; i >= 0; i-- {
+		line := displayMessage(visible[i])
+		if cht.selecting {
+			if visible[i].ID == cht.cursorID {
+				cursorLine = strings.Count(sb.String(), "\n")
+			}
+			line = cht.selectionPrefix(visible[i].ID) + line
+		}
+		sb.WriteString(line + "\n")
+	}
+	pending := outbox.Channel(cht.channelID)
+	for _, e := range pending {
+		sb.WriteString(displayOutboxEntry(e) + "\n")
+	}
+	if len(pending) > 0 {
+		broker.SetStatusSegment(outboxSegment, fmt.Sprintf("%d unsent", len(pending)))
+	} else {
+		broker.ClearStatusSegment(outboxSegment)
+	}
+
+	cht.msgView.SetContent(sb.String())
+	if cursorLine < 0 {
+		cht.msgView.GotoBottom()
+		return
+	}
+	// keep the cursor in view
+	if cursorLine < cht.msgView.YOffset {
+		cht.msgView.SetYOffset(cursorLine)
+	} else if cursorLine >= cht.msgView.YOffset+cht.msgView.Height {
+		cht.msgView.SetYOffset(cursorLine - cht.msgView.Height + 1)
+	}
+}
+
+// Returns the messages displayed in the viewport, newest first.
+func (cht *chatTab) visibleMessages() []*revoltgo.Message {
+	var visible []*revoltgo.Message
+	for _, m := range cht.msgs.messages[:min(viewportMessageLimit, len(cht.msgs.messages))] {
+		if m != nil {
+			visible = append(visible, m)
 		}
-		sb.WriteString(displayMessage(cht.msgs.messages[i]) + "\n")
 	}
+	return visible
+}
 
-	cht.msgView.GotoBottom()
+// helper function for populateViewport(). Given an outbox entry, returns it formatted per its status.
+func displayOutboxEntry(e outbox.Entry) string {
+	line := fmt.Sprintf("%s%s: %s", e.Created.Format(broker.Settings().TimestampFormat), "you", e.Content)
+	if e.Status == outbox.Failed {
+		return failedStyle.Render(line) + "\n" + failedStyle.Render(fmt.Sprintf(
+			"  ✗ failed to send (%s). %s to retry, %s to discard",
+			e.LastErr, keys.Get(keys.ChatRetry).Help().Key, keys.Get(keys.ChatDiscard).Help().Key))
+	}
+	return pendingStyle.Render(line + " (sending...)")
 }
 
 // helper function for populateViewport(). Given a singular message, it returns a formatted string corresponding to its type.
 // Note the lack of suffixed newlines.
 func displayMessage(msg *revoltgo.Message) string {
-	if msg == nil || msg.System == nil {
+	if msg == nil {
 		return "undefined message"
 	}
+	if msg.System == nil { // standard, user-authored message
+		return fmt.Sprintf("%s%s: %s", timestampStyle.Render(sentAt(msg).Format(broker.Settings().TimestampFormat)), authorStyle.Render(msg.Author), msg.Content) +
+			displayMedia(msg)
+	}
 
 	switch msg.System.Type {
 	case revoltgo.MessageSystemTypeText:
-		return fmt.Sprintf("%s%s: %s", timestampStyle.Render(msg.Edited.Format(time.Stamp)), authorStyle.Render(msg.Author), msg.Content)
+		return fmt.Sprintf("%s%s: %s", timestampStyle.Render(sentAt(msg).Format(broker.Settings().TimestampFormat)), authorStyle.Render(msg.Author), msg.Content)
 	case revoltgo.MessageSystemTypeChannelIconChanged:
 		return fmt.Sprintf("%s changed their icon. Content: %s", msg.Author, msg.Content)
 	default:
@@ -215,3 +630,33 @@ func displayMessage(msg *revoltgo.Message) string {
 	}
 
 }
+
+// helper function for displayMessage(). Lists the message's attachments and embedded images as
+// links, one per line, each preceded by a newline.
+func displayMedia(msg *revoltgo.Message) string {
+	var sb strings.Builder
+	for _, a := range msg.Attachments {
+		if a == nil {
+			continue
+		}
+		sb.WriteString("\n  attachment: " + a.Filename)
+		if u := instance.AttachmentURL(a); u != "" {
+			sb.WriteString(" " + u)
+		}
+	}
+	for _, e := range msg.Embeds {
+		if e != nil && e.Image != nil && e.Image.URL != "" {
+			sb.WriteString("\n  image: " + instance.ProxyURL(e.Image.URL))
+		}
+	}
+	return sb.String()
+}
+
+// Returns the time the message was sent, as encoded in its ID.
+func sentAt(msg *revoltgo.Message) time.Time {
+	id, err := ulid.Parse(msg.ID)
+	if err != nil {
+		return msg.Edited
+	}
+	return ulid.Time(id.Time())
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"revolt_tui/broker"
+	"revolt_tui/log"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sentinelb51/revoltgo"
+)
+
+/**
+ * This file handles fetching data missing from the broker's cache without blocking the UI.
+ * Each fetch is returned as its own tea.Cmd (which Bubble Tea runs concurrently); a shared
+ * semaphore bounds how many requests are in flight at once so large servers do not trip the rate
+ * limiter.
+ * Results are addressed to the tab that requested them, as they may arrive after focus has moved.
+ */
+
+const maxConcurrentFetches int = 6
+
+var fetchSlots = make(chan struct{}, maxConcurrentFetches)
+
+// Runs f once a fetch slot is available.
+func bounded[T any](f func() (T, error)) (T, error) {
+	fetchSlots <- struct{}{}
+	defer func() { <-fetchSlots }()
+	return f()
+}
+
+//#region channels
+
+// returned when a channel missing from the cache has been fetched
+type channelFetchedMsg struct {
+	serverID  string
+	channelID string
+	channel   *revoltgo.Channel // nil on error
+}
+
+var _ tabMsg = channelFetchedMsg{}
+
+func (channelFetchedMsg) recipient() tabConst {
+	return CHANNELS
+}
+
+// Fetches the channel with the given ID from the API, caching it in the broker.
+func fetchChannel(serverID, channelID string) tea.Cmd {
+	session := broker.Session()
+	return func() tea.Msg {
+		ch, err := bounded(func() (*revoltgo.Channel, error) { return session.Channel(channelID) })
+		if err != nil {
+			log.Writer.Warn("failed to fetch channel", "id", channelID, "error", err)
+			ch = nil
+		}
+		broker.AddChannels(ch)
+		return channelFetchedMsg{serverID: serverID, channelID: channelID, channel: ch}
+	}
+}
+
+//#endregion channels
+
+//#region users
+
+// returned when a user missing from the cache has been fetched
+type userFetchedMsg struct {
+	to     tabConst
+	userID string
+	user   *revoltgo.User // nil on error
+}
+
+var _ tabMsg = userFetchedMsg{}
+
+func (m userFetchedMsg) recipient() tabConst {
+	return m.to
+}
+
+// Fetches the user with the given ID from the API, addressing the result to the given tab.
+func fetchUser(to tabConst, userID string) tea.Cmd {
+	session := broker.Session()
+	return func() tea.Msg {
+		u, err := bounded(func() (*revoltgo.User, error) { return session.User(userID) })
+		if err != nil {
+			log.Writer.Warn("failed to fetch user", "id", userID, "error", err)
+			u = nil
+		}
+		return userFetchedMsg{to: to, userID: userID, user: u}
+	}
+}
+
+//#endregion users
+
+//#region spinners
+
+// a spinner tick addressed to the tab that owns the spinner, so it keeps spinning while unfocused
+type spinnerTickMsg struct {
+	to   tabConst
+	tick spinner.TickMsg
+}
+
+var _ tabMsg = spinnerTickMsg{}
+
+func (m spinnerTickMsg) recipient() tabConst {
+	return m.to
+}
+
+// Returns a spinner in the style used for pending items.
+func newSpinner() spinner.Model {
+	return spinner.New(spinner.WithSpinner(spinner.MiniDot))
+}
+
+// Wraps the given spinner command such that its tick is delivered to the given tab.
+func addressTick(to tabConst, cmd tea.Cmd) tea.Cmd {
+	if cmd == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		if tick, ok := cmd().(spinner.TickMsg); ok {
+			return spinnerTickMsg{to: to, tick: tick}
+		}
+		return nil
+	}
+}
+
+//#endregion spinners
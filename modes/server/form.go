@@ -0,0 +1,340 @@
+package server
+
+import (
+	"fmt"
+	"revolt_tui/keys"
+	"revolt_tui/stylesheet/colors"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+/**
+ * This file implements the vertical form used by the administrative tabs.
+ * A form is a list of rows (text fields, toggles, and reorderable items) navigated with the
+ * settings.nextField/previousField keys; all other input is given to the focused row.
+ * Rows that do not fit in the available height are scrolled.
+ */
+
+const formLabelWidth int = 22
+
+var (
+	formLabelSty, formFocusSty, formErrSty, settingsOKSty, settingsConfirmSty lipgloss.Style
+
+	formSectionSty = lipgloss.NewStyle().Bold(true).Underline(true)
+)
+
+func init() {
+	colors.OnChange(func() {
+		formLabelSty = lipgloss.NewStyle().Width(formLabelWidth).Foreground(colors.LeftField)
+		formFocusSty = lipgloss.NewStyle().Bold(true).Foreground(colors.TabBorderForeground)
+		formErrSty = lipgloss.NewStyle().Foreground(colors.Error)
+		settingsOKSty = lipgloss.NewStyle().Foreground(colors.Connected)
+		settingsConfirmSty = lipgloss.NewStyle().Bold(true).Foreground(colors.Warning)
+	})
+}
+
+// a single line of a form
+type formRow interface {
+	view(focused bool) string
+	update(msg tea.KeyMsg) tea.Cmd // only called while focused
+	focus() tea.Cmd
+	blur()
+}
+
+type form struct {
+	rows   []formRow
+	cursor int
+	offset int // index of the first drawn row
+}
+
+// Moves focus between rows or passes the key to the focused row.
+func (f *form) Update(msg tea.Msg) tea.Cmd {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok || len(f.rows) == 0 {
+		return nil
+	}
+	switch {
+	case keys.Matches(keyMsg, keys.SettingsNextField):
+		return f.setCursor(f.cursor + 1)
+	case keys.Matches(keyMsg, keys.SettingsPreviousField):
+		return f.setCursor(f.cursor - 1)
+	}
+	return f.rows[f.cursor].update(keyMsg)
+}
+
+// Focuses the row at index i, skipping section headers in the direction of travel.
+func (f *form) setCursor(i int) tea.Cmd {
+	step := 1
+	if i < f.cursor {
+		step = -1
+	}
+	for ; i >= 0 && i < len(f.rows); i += step {
+		if _, isHeader := f.rows[i].(*sectionRow); !isHeader {
+			f.rows[f.cursor].blur()
+			f.cursor = i
+			return f.rows[i].focus()
+		}
+	}
+	return nil
+}
+
+// Returns the focused row.
+func (f *form) focused() formRow {
+	if f.cursor >= len(f.rows) {
+		return nil
+	}
+	return f.rows[f.cursor]
+}
+
+// Swaps the focused row with its neighbour delta rows away, if both are orderRows of the same group.
+// Returns true if the rows were swapped.
+func (f *form) swap(delta int) bool {
+	j := f.cursor + delta
+	if j < 0 || j >= len(f.rows) {
+		return false
+	}
+	a, aOK := f.rows[f.cursor].(*orderRow)
+	b, bOK := f.rows[j].(*orderRow)
+	if !aOK || !bOK || a.group != b.group {
+		return false
+	}
+	f.rows[f.cursor], f.rows[j] = f.rows[j], f.rows[f.cursor]
+	f.cursor = j
+	return true
+}
+
+// Draws as many rows as fit in the given height, keeping the focused row visible.
+func (f *form) View(height int) string {
+	if height < 1 {
+		height = 1
+	}
+	if f.cursor < f.offset {
+		f.offset = f.cursor
+	} else if f.cursor >= f.offset+height {
+		f.offset = f.cursor - height + 1
+	}
+	end := min(f.offset+height, len(f.rows))
+
+	var sb strings.Builder
+	for i := f.offset; i < end; i++ {
+		sb.WriteString(f.rows[i].view(i == f.cursor) + "\n")
+	}
+	return sb.String()
+}
+
+// Renders the label of a row, highlighting it if focused.
+func rowLabel(label string, focused bool) string {
+	if focused {
+		return formFocusSty.Render("> ") + formLabelSty.Render(label)
+	}
+	return "  " + formLabelSty.Render(label)
+}
+
+//#region rows
+
+// an unfocusable heading
+type sectionRow struct {
+	title string
+}
+
+var _ formRow = &sectionRow{}
+
+func newSection(title string) *sectionRow { return &sectionRow{title: title} }
+
+func (r *sectionRow) view(bool) string          { return formSectionSty.Render(r.title) }
+func (r *sectionRow) update(tea.KeyMsg) tea.Cmd { return nil }
+func (r *sectionRow) focus() tea.Cmd            { return nil }
+func (r *sectionRow) blur()                     {}
+
+// a single-line text field, with an optional validator
+type textRow struct {
+	label    string
+	input    textinput.Model
+	initial  string
+	err      string
+	validate func(string) string // returns an error description, or ""
+}
+
+var _ formRow = &textRow{}
+
+func newTextRow(label, value string, charLimit int, validate func(string) string) *textRow {
+	ti := textinput.New()
+	ti.Prompt = ""
+	ti.CharLimit = charLimit
+	ti.SetValue(value)
+	return &textRow{label: label, input: ti, initial: value, validate: validate}
+}
+
+func (r *textRow) view(focused bool) string {
+	s := rowLabel(r.label, focused) + r.input.View()
+	if r.err != "" {
+		s += " " + formErrSty.Render(r.err)
+	}
+	return s
+}
+
+func (r *textRow) update(msg tea.KeyMsg) tea.Cmd {
+	var cmd tea.Cmd
+	r.input, cmd = r.input.Update(msg)
+	r.err = ""
+	return cmd
+}
+
+func (r *textRow) focus() tea.Cmd { return r.input.Focus() }
+func (r *textRow) blur()          { r.input.Blur() }
+
+// Replaces the value, treating it as the initial value.
+func (r *textRow) SetValue(v string) {
+	r.input.SetValue(v)
+	r.initial = v
+}
+
+// Returns the current, whitespace-trimmed value.
+func (r *textRow) value() string { return strings.TrimSpace(r.input.Value()) }
+
+// Has the value changed since the row was created?
+func (r *textRow) changed() bool { return r.value() != r.initial }
+
+// Runs the validator, recording and returning its result.
+func (r *textRow) check() bool {
+	if r.validate != nil {
+		r.err = r.validate(r.value())
+	}
+	return r.err == ""
+}
+
+// a boolean option, toggled by settings.toggle
+type toggleRow struct {
+	label   string
+	on      bool
+	initial bool
+}
+
+var _ formRow = &toggleRow{}
+
+func newToggleRow(label string, on bool) *toggleRow {
+	return &toggleRow{label: label, on: on, initial: on}
+}
+
+func (r *toggleRow) view(focused bool) string {
+	box := "[ ]"
+	if r.on {
+		box = "[x]"
+	}
+	return rowLabel(r.label, focused) + box
+}
+
+func (r *toggleRow) update(msg tea.KeyMsg) tea.Cmd {
+	if keys.Matches(msg, keys.SettingsToggle) {
+		r.on = !r.on
+	}
+	return nil
+}
+
+func (r *toggleRow) focus() tea.Cmd { return nil }
+func (r *toggleRow) blur()          {}
+
+// A permission override: inherited, allowed, or denied; cycled by settings.toggle.
+// If noDeny is set, the row only cycles between inherited (not granted) and allowed.
+type triRow struct {
+	label   string
+	state   triState
+	initial triState
+	noDeny  bool
+}
+
+type triState uint8
+
+const (
+	triInherit triState = iota
+	triAllow
+	triDeny
+)
+
+var _ formRow = &triRow{}
+
+func newTriRow(label string, state triState, noDeny bool) *triRow {
+	return &triRow{label: label, state: state, initial: state, noDeny: noDeny}
+}
+
+func (r *triRow) view(focused bool) string {
+	var mark string
+	switch r.state {
+	case triAllow:
+		mark = settingsOKSty.Render("[✓]")
+	case triDeny:
+		mark = formErrSty.Render("[✗]")
+	default:
+		mark = "[·]"
+	}
+	return rowLabel(r.label, focused) + mark
+}
+
+func (r *triRow) update(msg tea.KeyMsg) tea.Cmd {
+	if keys.Matches(msg, keys.SettingsToggle) {
+		r.state = (r.state + 1) % 3
+		if r.noDeny && r.state == triDeny {
+			r.state = triInherit
+		}
+	}
+	return nil
+}
+
+func (r *triRow) focus() tea.Cmd { return nil }
+func (r *triRow) blur()          {}
+
+// an item that can be reordered among the other items of its group via settings.moveUp/moveDown
+type orderRow struct {
+	group string
+	id    string
+	text  string
+}
+
+var _ formRow = &orderRow{}
+
+func (r *orderRow) view(focused bool) string {
+	return rowLabel("", focused) + "≡ " + r.text
+}
+
+func (r *orderRow) update(tea.KeyMsg) tea.Cmd { return nil }
+func (r *orderRow) focus() tea.Cmd            { return nil }
+func (r *orderRow) blur()                     {}
+
+//#endregion rows
+
+//#region status line
+
+// the line beneath a form, reporting errors, progress and confirmation prompts
+type statusLine struct {
+	text     string
+	isErr    bool
+	isPrompt bool
+}
+
+func (sl *statusLine) set(text string, isErr bool) {
+	sl.text, sl.isErr, sl.isPrompt = text, isErr, false
+}
+
+// Displays a yes/no question.
+func (sl *statusLine) ask(question string) {
+	sl.text, sl.isErr, sl.isPrompt = fmt.Sprintf("%s (%s/%s)", question,
+		keys.Get(keys.SettingsConfirm).Help().Key, keys.Get(keys.SettingsCancel).Help().Key), false, true
+}
+
+// Draws the status, or the given hint if there is none.
+func (sl statusLine) view(hint string) string {
+	switch {
+	case sl.text == "":
+		return hint
+	case sl.isPrompt:
+		return settingsConfirmSty.Render(sl.text)
+	case sl.isErr:
+		return formErrSty.Render(sl.text)
+	}
+	return settingsOKSty.Render(sl.text)
+}
+
+//#endregion status line
@@ -0,0 +1,310 @@
+package server
+
+import (
+	"errors"
+	"revolt_tui/api"
+	"revolt_tui/broker"
+	"revolt_tui/keys"
+	"revolt_tui/log"
+	"slices"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sentinelb51/revoltgo"
+)
+
+/**
+ * This file handles the invites tab, where permitted users create invites to a channel and list and
+ * revoke the server's invites.
+ * Listing every invite requires Manage Server; those who may only invite others see the invites they
+ * create this session. Creation and revocation are confirmed in a modal.
+ */
+
+type invitesTab struct {
+	server        *revoltgo.Server
+	width, height int
+	list          list.Model
+
+	invites  []*revoltgo.InviteCreate
+	revoking string // code of the invite the open modal revokes
+	loading  bool
+	err      error
+	modal    *modal
+}
+
+var (
+	_ tab         = &invitesTab{}
+	_ modalHolder = &invitesTab{}
+)
+
+func (*invitesTab) Name() string {
+	return "invites"
+}
+
+// Enabled for those who may list invites or create one in any channel.
+func (it *invitesTab) Enabled() bool {
+	if it.server == nil {
+		return false
+	}
+	return broker.HasServerPermission(it.server.ID, broker.PermManageServer) || it.inviteChannel() != ""
+}
+
+func (it *invitesTab) Init(s *revoltgo.Server, width, height int) tea.Cmd {
+	it.server = s
+	it.width, it.height = width, height
+	it.invites, it.modal, it.err = nil, nil, nil
+	it.list = list.New(nil, list.NewDefaultDelegate(), width, height-1)
+	it.list.Title = "Invites"
+	it.loading = broker.HasServerPermission(s.ID, broker.PermManageServer)
+	if !it.loading {
+		return nil
+	}
+	return fetchInvites(s.ID)
+}
+
+func (it *invitesTab) modalOpen() bool {
+	return it.modal != nil
+}
+
+func (it *invitesTab) Update(msg tea.Msg) (tea.Cmd, tabConst) {
+	switch m := msg.(type) {
+	case tea.WindowSizeMsg:
+		it.width, it.height = m.Width, m.Height
+		it.list.SetSize(m.Width, m.Height-1)
+		return nil, INVITES
+	case invitesMsg:
+		it.loading, it.err = false, m.err
+		if m.err == nil {
+			it.invites = m.invites
+		}
+		return it.rebuild(), INVITES
+	case userFetchedMsg:
+		if m.user == nil { // keep displaying the ID
+			return nil, INVITES
+		}
+		broker.AddUsers(m.user)
+		return it.rebuild(), INVITES
+	case inviteCreatedMsg:
+		it.modal = nil
+		if m.err != nil {
+			broker.PostError(m.err)
+			return nil, INVITES
+		}
+		broker.PostNotice("created invite " + api.InviteLink(m.invite.ID))
+		it.invites = append(it.invites, m.invite)
+		return it.rebuild(), INVITES
+	case actionDoneMsg: // revocation
+		it.modal = nil
+		m.report()
+		if m.err == nil {
+			it.invites = slices.DeleteFunc(it.invites, func(inv *revoltgo.InviteCreate) bool {
+				return inv.ID == it.revoking
+			})
+		}
+		return it.rebuild(), INVITES
+	case tea.KeyMsg:
+		if it.modal != nil {
+			cmd, dismissed := it.modal.update(m)
+			if dismissed {
+				it.modal = nil
+			}
+			return cmd, INVITES
+		}
+		if it.list.FilterState() == list.Filtering {
+			break
+		}
+		switch {
+		case keys.Matches(m, keys.InvitesCreate):
+			it.openCreate()
+			return nil, INVITES
+		case keys.Matches(m, keys.InvitesRevoke):
+			it.openRevoke()
+			return nil, INVITES
+		}
+	}
+
+	var cmd tea.Cmd
+	it.list, cmd = it.list.Update(msg)
+	return cmd, INVITES
+}
+
+func (it *invitesTab) View() string {
+	if it.modal != nil {
+		return it.modal.View(it.width, it.height)
+	}
+	var status string
+	switch {
+	case it.err != nil:
+		status = formErrSty.Render("failed to fetch invites: " + it.err.Error())
+	case it.loading:
+		status = "loading..."
+	case !broker.HasServerPermission(it.server.ID, broker.PermManageServer):
+		status = "only invites you create are listed; " + keys.Get(keys.InvitesCreate).Help().Key + " to create one"
+	default:
+		status = keys.Get(keys.InvitesCreate).Help().Key + " to create, " +
+			keys.Get(keys.InvitesRevoke).Help().Key + " to revoke"
+	}
+	return status + "\n" + it.list.View()
+}
+
+// Regenerates the list items, fetching any creators missing from the broker.
+func (it *invitesTab) rebuild() tea.Cmd {
+	var (
+		itms    []list.Item
+		cmds    []tea.Cmd
+		fetched = make(map[string]bool)
+	)
+	for _, inv := range it.invites {
+		ii := inviteItem{code: inv.ID, creatorID: inv.Creator, creator: inv.Creator, channel: inv.Channel}
+		if u := broker.User(inv.Creator); u != nil {
+			ii.creator = u.Username
+		} else if !fetched[inv.Creator] {
+			fetched[inv.Creator] = true
+			cmds = append(cmds, fetchUser(INVITES, inv.Creator))
+		}
+		if ch := broker.Channel(inv.Channel); ch != nil {
+			ii.channel = "#" + ch.Name
+		}
+		itms = append(itms, ii)
+	}
+	it.list.SetItems(itms)
+	return tea.Batch(cmds...)
+}
+
+// Returns the channel invites are created for by default: the open channel if the user may invite
+// others to it, otherwise the first such text channel. Returns "" if there is none.
+func (it *invitesTab) inviteChannel() string {
+	if ch := broker.GetCurrentChannel(); ch != nil && ch.Server == it.server.ID &&
+		broker.HasChannelPermission(ch.ID, broker.PermInviteOthers) {
+		return ch.ID
+	}
+	for _, chID := range it.server.Channels {
+		ch := broker.Channel(chID)
+		if ch != nil && ch.ChannelType == revoltgo.ChannelTypeText &&
+			broker.HasChannelPermission(chID, broker.PermInviteOthers) {
+			return chID
+		}
+	}
+	return ""
+}
+
+//#region actions
+
+// returned when an attempt to create an invite completes
+type inviteCreatedMsg struct {
+	invite *revoltgo.InviteCreate
+	err    error
+}
+
+var _ tabMsg = inviteCreatedMsg{}
+
+func (inviteCreatedMsg) recipient() tabConst {
+	return INVITES
+}
+
+// Opens the modal for creating an invite, prefilled with the default channel.
+func (it *invitesTab) openCreate() {
+	var current string
+	if ch := broker.Channel(it.inviteChannel()); ch != nil {
+		current = "#" + ch.Name
+	}
+	s := it.server
+	channel := newTextRow("Channel", current, 64, func(v string) string {
+		if v == "" {
+			return "a channel is required"
+		}
+		id, errDesc := resolveChannel(s, v, true)
+		if errDesc == "" && !broker.HasChannelPermission(id, broker.PermInviteOthers) {
+			return "you cannot invite others to " + v
+		}
+		return errDesc
+	})
+	it.modal = newModal("Create an invite?", func() (tea.Cmd, string) {
+		if !channel.check() {
+			return nil, "please correct the highlighted fields"
+		}
+		chID, _ := resolveChannel(s, channel.value(), true)
+		session := broker.Session()
+		return func() tea.Msg {
+			inv, err := session.ChannelInviteCreate(chID)
+			if err != nil {
+				log.Writer.Warn("failed to create invite", "channel ID", chID, "error", err)
+				return inviteCreatedMsg{err: errors.New("failed to create invite: " + err.Error())}
+			}
+			return inviteCreatedMsg{invite: inv}
+		}, ""
+	}, channel)
+}
+
+// Opens the modal for revoking the selected invite, if permitted.
+// Invites may be revoked by their creator or anyone with Manage Server.
+func (it *invitesTab) openRevoke() {
+	itm, ok := it.list.SelectedItem().(inviteItem)
+	if !ok {
+		return
+	}
+	self := broker.Self()
+	if !broker.HasServerPermission(it.server.ID, broker.PermManageServer) && (self == nil || self.ID != itm.creatorID) {
+		broker.PostError(errors.New("you cannot revoke invites created by others"))
+		return
+	}
+	code := itm.code
+	it.revoking = code
+	it.modal = newModal("Revoke invite "+code+" to "+itm.channel+"?", func() (tea.Cmd, string) {
+		session := broker.Session()
+		return func() tea.Msg {
+			if err := session.InviteDelete(code); err != nil {
+				log.Writer.Warn("failed to revoke invite", "invite", code, "error", err)
+				return actionDoneMsg{to: INVITES, err: errors.New("failed to revoke invite: " + err.Error())}
+			}
+			return actionDoneMsg{to: INVITES, summary: "revoked invite " + code}
+		}, ""
+	})
+}
+
+//#endregion actions
+
+// returned when the invites of a server have been fetched
+type invitesMsg struct {
+	invites []*revoltgo.InviteCreate
+	err     error
+}
+
+var _ tabMsg = invitesMsg{}
+
+func (invitesMsg) recipient() tabConst {
+	return INVITES
+}
+
+func fetchInvites(serverID string) tea.Cmd {
+	session := broker.Session()
+	return func() tea.Msg {
+		invites, err := api.ServerInvites(session, serverID)
+		if err != nil {
+			log.Writer.Warn("failed to fetch invites", "server ID", serverID, "error", err)
+		}
+		return invitesMsg{invites: invites, err: err}
+	}
+}
+
+// invite representation for the invites list.Model
+type inviteItem struct {
+	code      string
+	creatorID string
+	creator   string // name, if known
+	channel   string // name, if known
+}
+
+var _ list.Item = inviteItem{} // check interface
+
+func (ii inviteItem) Title() string {
+	return api.InviteLink(ii.code)
+}
+
+func (ii inviteItem) Description() string {
+	return ii.channel + ", created by " + ii.creator
+}
+
+func (ii inviteItem) FilterValue() string {
+	return ii.code
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"revolt_tui/broker"
+	"revolt_tui/keys"
+	"revolt_tui/log"
+	"revolt_tui/stylesheet/colors"
+	"slices"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sentinelb51/revoltgo"
+)
+
+/**
+ * This file handles the responsive layout of server mode.
+ * On terminals at least splitMinWidth wide, the channels and chat tabs are drawn side by side as
+ * panes (optionally alongside a member list); the pane keys cycle focus between the visible panes,
+ * while the tab keys still switch tabs.
+ * Narrower terminals fall back to the standard, one-tab-at-a-time layout.
+ */
+
+const (
+	splitMinWidth     int = 100 // terminal width at which the split layout is used
+	channelPaneWidth  int = 32
+	memberPaneWidth   int = 26
+	paneBorderSize    int = 2
+	memberLoadingText     = "loading members..."
+	memberPaneFocus   int = -1 // stands in for the member pane among the tabs when cycling panes
+)
+
+var paneStyle, focusedPaneStyle, memberTitleSty lipgloss.Style
+
+func init() {
+	colors.OnChange(func() {
+		paneStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(colors.PaneBorder)
+		focusedPaneStyle = paneStyle.Copy().BorderForeground(colors.TabBorderForeground)
+		memberTitleSty = lipgloss.NewStyle().Bold(true).Foreground(colors.LeftField)
+	})
+}
+
+// Is the terminal wide enough for the split layout?
+func wide(width int) bool {
+	return width >= splitMinWidth
+}
+
+// Should the panes be drawn side by side?
+// The overview tab is always drawn alone.
+func (a *Action) split() bool {
+	return wide(broker.Width()) && (a.activeTab == CHANNELS || a.activeTab == CHAT)
+}
+
+// Does the member pane have focus?
+// Focus falls back to the active tab whenever the member pane is hidden.
+func (a *Action) memberFocused() bool {
+	return a.memberFocus && a.showMembers && a.split()
+}
+
+// Moves focus step panes along the visible panes (channels, chat, then members), wrapping around
+// and skipping disabled tabs.
+func (a *Action) cyclePane(step int) {
+	panes := []int{int(CHANNELS), int(CHAT)}
+	if a.showMembers {
+		panes = append(panes, memberPaneFocus)
+	}
+	cur := int(a.activeTab)
+	if a.memberFocused() {
+		cur = memberPaneFocus
+	}
+	i := slices.Index(panes, cur)
+	if i < 0 {
+		return
+	}
+	for range panes {
+		i = (i + step + len(panes)) % len(panes)
+		if panes[i] == memberPaneFocus {
+			a.memberFocus = true
+			return
+		}
+		if a.tabs[panes[i]].Enabled() {
+			a.memberFocus = false
+			a.activeTab = tabConst(panes[i])
+			return
+		}
+	}
+}
+
+// Returns the dimensions given to the given tab, from the space available to the tab content.
+func (a *Action) tabSize(t tabConst, w, h int) (int, int) {
+	if !wide(w) {
+		return w, h
+	}
+	switch t {
+	case CHANNELS:
+		return channelPaneWidth - paneBorderSize, h - paneBorderSize
+	case CHAT:
+		cw := w - channelPaneWidth
+		if a.showMembers {
+			cw -= memberPaneWidth
+		}
+		return cw - paneBorderSize, h - paneBorderSize
+	}
+	return w, h
+}
+
+// Sends each tab its share of the given content area.
+// Tab changes are respected only from the active tab.
+func (a *Action) resize(w, h int) tea.Cmd {
+	a.contentWidth, a.contentHeight = w, h
+	var cmds []tea.Cmd
+	for i, tb := range a.tabs {
+		tw, th := a.tabSize(tabConst(i), w, h)
+		c, t := tb.Update(tea.WindowSizeMsg{Width: tw, Height: th})
+		cmds = append(cmds, c)
+		if i == int(a.activeTab) {
+			a.activeTab = t
+		}
+	}
+	return tea.Batch(cmds...)
+}
+
+// Draws the channels and chat tabs (and member list, if toggled) side by side, highlighting the
+// focused pane.
+func (a *Action) viewSplit() string {
+	_, h := a.tabSize(CHANNELS, a.contentWidth, a.contentHeight)
+	pane := func(t tabConst) string {
+		w, _ := a.tabSize(t, a.contentWidth, a.contentHeight)
+		sty := paneStyle
+		if a.activeTab == t && !a.memberFocused() {
+			sty = focusedPaneStyle
+		}
+		var content string
+		if a.tabs[t].Enabled() {
+			content = a.tabs[t].View()
+		}
+		return sty.Width(w).Height(h).MaxHeight(h + paneBorderSize).Render(content)
+	}
+
+	panes := []string{pane(CHANNELS), pane(CHAT)}
+	if a.showMembers {
+		sty := paneStyle
+		if a.memberFocused() {
+			sty = focusedPaneStyle
+		}
+		panes = append(panes, sty.Width(memberPaneWidth-paneBorderSize).Height(h).
+			MaxHeight(h+paneBorderSize).Render(a.members.View(h)))
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, panes...)
+}
+
+//#region member pane
+
+// the read-only member list drawn beside chat in the split layout; scrollable once focused
+type memberPane struct {
+	loaded bool
+	err    error
+	names  []string
+	offset int // index of the first name drawn
+}
+
+// returned when the member list has been fetched
+type membersLoadedMsg struct {
+	serverID string
+	names    []string
+	err      error
+}
+
+// Fetches the members of the given server, resolving their display names.
+func loadMembers(s *revoltgo.Server) tea.Cmd {
+	session := broker.Session()
+	return func() tea.Msg {
+		members, err := session.ServerMembers(s.ID)
+		if err != nil {
+			log.Writer.Warn("failed to fetch server members", "server ID", s.ID, "error", err)
+			return membersLoadedMsg{serverID: s.ID, err: err}
+		}
+		broker.AddUsers(members.Users...)
+		broker.AddAllMembers(s.ID, members.Members...)
+		users := make(map[string]*revoltgo.User, len(members.Users))
+		for _, u := range members.Users {
+			users[u.ID] = u
+		}
+		names := make([]string, 0, len(members.Members))
+		for _, m := range members.Members {
+			names = append(names, memberName(m, users[m.ID.User]))
+		}
+		sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+		return membersLoadedMsg{serverID: s.ID, names: names}
+	}
+}
+
+// Returns the name a member should be displayed as: their nickname, display name, or username
+func memberName(m *revoltgo.ServerMember, u *revoltgo.User) string {
+	if m.Nickname != nil && *m.Nickname != "" {
+		return *m.Nickname
+	}
+	if u == nil {
+		return m.ID.User
+	}
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Username
+}
+
+// Scrolls the member list.
+func (mp *memberPane) Update(msg tea.KeyMsg) {
+	switch {
+	case keys.Matches(msg, keys.MemberListUp):
+		if mp.offset > 0 {
+			mp.offset--
+		}
+	case keys.Matches(msg, keys.MemberListDown):
+		if mp.offset < len(mp.names)-1 {
+			mp.offset++
+		}
+	}
+}
+
+// Draws as many members as fit in the given height, from the scroll offset.
+func (mp *memberPane) View(height int) string {
+	var sb strings.Builder
+	sb.WriteString(memberTitleSty.Render("Members") + "\n")
+	switch {
+	case mp.err != nil:
+		sb.WriteString("failed to load members")
+	case !mp.loaded:
+		sb.WriteString(memberLoadingText)
+	default:
+		for i, n := range mp.names[mp.offset:] {
+			if i >= height-1 {
+				break
+			}
+			sb.WriteString(n + "\n")
+		}
+	}
+	return sb.String()
+}
+
+//#endregion member pane
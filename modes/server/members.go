@@ -0,0 +1,482 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"revolt_tui/api"
+	"revolt_tui/broker"
+	"revolt_tui/keys"
+	"revolt_tui/log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/oklog/ulid/v2"
+	"github.com/sentinelb51/revoltgo"
+)
+
+/**
+ * This file handles the members tab, where moderators kick, ban, and time out members and lift bans.
+ * The tab is only enabled for users holding at least one of the Kick, Ban, or Timeout Members
+ * permissions; each action is further gated on the target ranking below the user.
+ * Every action is confirmed in a modal and reported in the status bar.
+ */
+
+const (
+	banReasonMaxLength int = 1024
+	maxPurgeWindow         = api.BulkDeleteMaxAge
+	purgeFetchLimit    int = 100
+	purgeAgeMargin         = 10 * time.Minute // messages this close to BulkDeleteMaxAge may age out mid-purge
+)
+
+type membersTab struct {
+	server        *revoltgo.Server
+	width, height int
+	list          list.Model
+
+	showBans bool
+	loading  bool
+	err      error
+	bans     *revoltgo.ServerBans // nil until fetched
+	modal    *modal
+}
+
+var (
+	_ tab         = &membersTab{}
+	_ modalHolder = &membersTab{}
+)
+
+func (*membersTab) Name() string {
+	return "members"
+}
+
+func (mt *membersTab) Enabled() bool {
+	if mt.server == nil {
+		return false
+	}
+	perms := broker.ServerPermissions(mt.server.ID)
+	return perms&(broker.PermKickMembers|broker.PermBanMembers|broker.PermTimeoutMembers) != 0
+}
+
+func (mt *membersTab) Init(s *revoltgo.Server, width, height int) tea.Cmd {
+	mt.server = s
+	mt.width, mt.height = width, height
+	mt.showBans, mt.bans, mt.modal, mt.err = false, nil, nil, nil
+	mt.list = list.New(nil, list.NewDefaultDelegate(), width, height-1)
+	mt.list.Title = "Members"
+	mt.rebuild()
+	if !mt.Enabled() {
+		return nil
+	}
+	mt.loading = true
+	return fetchMembers(s.ID)
+}
+
+func (mt *membersTab) modalOpen() bool {
+	return mt.modal != nil
+}
+
+func (mt *membersTab) Update(msg tea.Msg) (tea.Cmd, tabConst) {
+	switch m := msg.(type) {
+	case tea.WindowSizeMsg:
+		mt.width, mt.height = m.Width, m.Height
+		mt.list.SetSize(m.Width, m.Height-1)
+		return nil, MEMBERS
+	case memberListMsg:
+		mt.loading, mt.err = false, m.err
+		mt.rebuild()
+		return nil, MEMBERS
+	case bansMsg:
+		mt.loading, mt.err = false, m.err
+		if m.err == nil {
+			mt.bans = m.bans
+		}
+		mt.rebuild()
+		return nil, MEMBERS
+	case broker.StoreChangedMsg:
+		if m.Kind == broker.KindMember && m.ServerID == mt.server.ID && !mt.showBans {
+			mt.rebuild()
+		}
+		return nil, MEMBERS
+	case actionDoneMsg:
+		mt.modal = nil
+		m.report()
+		if mt.showBans { // bans do not arrive as events
+			mt.loading = true
+			return fetchBans(mt.server.ID), MEMBERS
+		}
+		return nil, MEMBERS
+	case tea.KeyMsg:
+		if mt.modal != nil {
+			cmd, dismissed := mt.modal.update(m)
+			if dismissed {
+				mt.modal = nil
+			}
+			return cmd, MEMBERS
+		}
+		if mt.list.FilterState() == list.Filtering {
+			break
+		}
+		switch {
+		case keys.Matches(m, keys.MembersBans):
+			return mt.toggleBans(), MEMBERS
+		case keys.Matches(m, keys.MembersKick, keys.MembersBan, keys.MembersTimeout, keys.MembersUnban):
+			mt.openModal(m)
+			return nil, MEMBERS
+		}
+	}
+
+	var cmd tea.Cmd
+	mt.list, cmd = mt.list.Update(msg)
+	return cmd, MEMBERS
+}
+
+func (mt *membersTab) View() string {
+	if mt.modal != nil {
+		return mt.modal.View(mt.width, mt.height)
+	}
+	var status string
+	switch {
+	case mt.err != nil:
+		status = formErrSty.Render(mt.err.Error())
+	case mt.loading:
+		status = "loading..."
+	case mt.showBans:
+		status = keys.Get(keys.MembersUnban).Help().Key + " to unban, " +
+			keys.Get(keys.MembersBans).Help().Key + " to return to members"
+	default:
+		status = keys.Get(keys.MembersBans).Help().Key + " to view bans"
+	}
+	return status + "\n" + mt.list.View()
+}
+
+// Switches between the member and ban lists, fetching bans on first view.
+func (mt *membersTab) toggleBans() tea.Cmd {
+	mt.showBans = !mt.showBans
+	mt.list.ResetFilter()
+	mt.err = nil
+	if mt.showBans {
+		mt.list.Title = "Bans"
+		if !broker.HasServerPermission(mt.server.ID, broker.PermBanMembers) {
+			mt.err = errors.New("you do not have permission to view bans")
+			mt.list.SetItems(nil)
+			return nil
+		}
+		mt.rebuild()
+		mt.loading = true
+		return fetchBans(mt.server.ID)
+	}
+	mt.list.Title = "Members"
+	mt.rebuild()
+	return nil
+}
+
+// Regenerates the list items from the broker's members or the fetched bans.
+func (mt *membersTab) rebuild() {
+	var itms []list.Item
+	if mt.showBans {
+		if mt.bans != nil {
+			users := make(map[string]*revoltgo.User, len(mt.bans.Users))
+			for _, u := range mt.bans.Users {
+				users[u.ID] = u
+			}
+			for _, b := range mt.bans.Bans {
+				name := b.ID.User
+				if u := users[b.ID.User]; u != nil {
+					name = u.Username
+				}
+				itms = append(itms, memberItem{userID: b.ID.User, name: name, banReason: b.Reason, banned: true})
+			}
+		}
+	} else {
+		roles := broker.Roles(mt.server.ID)
+		for _, m := range broker.Members(mt.server.ID) {
+			mi := memberItem{userID: m.ID.User, name: memberName(m, broker.User(m.ID.User))}
+			if m.Timeout != nil && time.Now().Before(*m.Timeout) {
+				mi.timeout = *m.Timeout
+			}
+			for _, id := range m.Roles {
+				if r := roles[id]; r != nil {
+					mi.roles = append(mi.roles, r.Name)
+				}
+			}
+			itms = append(itms, mi)
+		}
+	}
+	sort.Slice(itms, func(i, j int) bool {
+		return strings.ToLower(itms[i].FilterValue()) < strings.ToLower(itms[j].FilterValue())
+	})
+	mt.list.SetItems(itms)
+}
+
+//#region actions
+
+// Opens the modal for the action bound to the given key against the selected item, if permitted.
+func (mt *membersTab) openModal(msg tea.KeyMsg) {
+	itm, ok := mt.list.SelectedItem().(memberItem)
+	if !ok {
+		return
+	}
+	serverID, userID, name := mt.server.ID, itm.userID, itm.name
+	deny := func(action string) {
+		broker.PostError(fmt.Errorf("you cannot %s %s", action, name))
+	}
+
+	switch {
+	case keys.Matches(msg, keys.MembersUnban):
+		if !itm.banned {
+			return
+		}
+		if !broker.HasServerPermission(serverID, broker.PermBanMembers) {
+			deny("unban")
+			return
+		}
+		mt.modal = newModal("Unban "+name+"?", func() (tea.Cmd, string) {
+			return moderate(serverID, "unbanned "+name, func(session *revoltgo.Session) error {
+				return session.ServerMemberUnban(serverID, userID)
+			}), ""
+		})
+	case itm.banned: // remaining actions apply to members
+		return
+	case keys.Matches(msg, keys.MembersKick):
+		if !broker.CanModerate(serverID, userID, broker.PermKickMembers) {
+			deny("kick")
+			return
+		}
+		mt.modal = newModal("Kick "+name+" from "+mt.server.Name+"?", func() (tea.Cmd, string) {
+			return moderate(serverID, "kicked "+name, func(session *revoltgo.Session) error {
+				return session.ServerMemberDelete(serverID, userID)
+			}), ""
+		})
+	case keys.Matches(msg, keys.MembersBan):
+		if !broker.CanModerate(serverID, userID, broker.PermBanMembers) {
+			deny("ban")
+			return
+		}
+		reason := newTextRow("Reason", "", banReasonMaxLength, nil)
+		window := newTextRow("Delete messages from", "0", 8, func(v string) string {
+			d, err := parseDuration(v)
+			if err != nil {
+				return err.Error()
+			} else if d > maxPurgeWindow {
+				return "at most 7d"
+			}
+			return ""
+		})
+		mt.modal = newModal("Ban "+name+" from "+mt.server.Name+"?", func() (tea.Cmd, string) {
+			if !window.check() {
+				return nil, "please correct the highlighted fields"
+			}
+			d, _ := parseDuration(window.value())
+			r := reason.value()
+			return moderate(serverID, "banned "+name, func(session *revoltgo.Session) error {
+				if err := api.Ban(session, serverID, userID, r); err != nil {
+					return err
+				}
+				if d > 0 {
+					return purge(session, serverID, userID, time.Now().Add(-d))
+				}
+				return nil
+			}), ""
+		}, reason, window)
+	case keys.Matches(msg, keys.MembersTimeout):
+		if !broker.CanModerate(serverID, userID, broker.PermTimeoutMembers) {
+			deny("time out")
+			return
+		}
+		duration := newTextRow("Duration", "1h", 8, func(v string) string {
+			if _, err := parseDuration(v); err != nil {
+				return err.Error()
+			}
+			return ""
+		})
+		mt.modal = newModal("Time out "+name+"? (0 lifts a timeout)", func() (tea.Cmd, string) {
+			if !duration.check() {
+				return nil, "please correct the highlighted fields"
+			}
+			d, _ := parseDuration(duration.value())
+			var until time.Time
+			summary := "lifted the timeout of " + name
+			if d > 0 {
+				until = time.Now().Add(d)
+				summary = "timed out " + name + " until " + until.Format(time.Stamp)
+			}
+			return moderate(serverID, summary, func(session *revoltgo.Session) error {
+				return api.Timeout(session, serverID, userID, until)
+			}), ""
+		}, duration)
+	}
+}
+
+// Returns a command performing the given moderation action with the current session, reporting the
+// summary on success.
+func moderate(serverID, summary string, action func(*revoltgo.Session) error) tea.Cmd {
+	session := broker.Session()
+	return func() tea.Msg {
+		if err := action(session); err != nil {
+			log.Writer.Warn("moderation action failed", "server ID", serverID, "action", summary, "error", err)
+			return actionDoneMsg{to: MEMBERS, err: fmt.Errorf("failed to complete action (%s): %v", summary, err)}
+		}
+		return actionDoneMsg{to: MEMBERS, summary: summary}
+	}
+}
+
+// Deletes the messages the given user sent in the given server since the given time, in every
+// channel the user may manage messages in.
+func purge(session *revoltgo.Session, serverID, userID string, since time.Time) error {
+	s := broker.Server(serverID)
+	if s == nil {
+		return errors.New("unknown server")
+	}
+	var start ulid.ULID
+	if err := start.SetTime(ulid.Timestamp(since)); err != nil {
+		return err
+	}
+	for _, chID := range s.Channels {
+		ch := broker.Channel(chID)
+		if ch == nil || ch.ChannelType != revoltgo.ChannelTypeText ||
+			!broker.HasChannelPermission(chID, broker.PermManageMessages) {
+			continue
+		}
+		var found []*revoltgo.Message
+		for after := start.String(); ; {
+			msgs, err := session.ChannelMessages(chID, revoltgo.ChannelMessagesParams{
+				Limit: purgeFetchLimit, After: after, Sort: revoltgo.ChannelMessagesParamsSortTypeOldest})
+			if err != nil {
+				return fmt.Errorf("banned, but failed to fetch messages of #%s: %v", ch.Name, err)
+			}
+			for _, m := range msgs {
+				if m.Author == userID {
+					found = append(found, m)
+				}
+			}
+			if len(msgs) < purgeFetchLimit {
+				break
+			}
+			after = msgs[len(msgs)-1].ID
+		}
+		// Revolt refuses the whole batch if any message is too old to bulk-delete, and fetching may
+		// have taken a while
+		var ids []string
+		for _, m := range found {
+			if time.Since(sentAt(m)) < api.BulkDeleteMaxAge-purgeAgeMargin {
+				ids = append(ids, m.ID)
+			}
+		}
+		if _, err := api.BulkDelete(session, chID, ids); err != nil {
+			return fmt.Errorf("banned, but failed to delete messages in #%s: %v", ch.Name, err)
+		}
+	}
+	return nil
+}
+
+// Parses a duration of the form accepted by time.ParseDuration, additionally accepting days ("7d").
+// "0" and "" are zero.
+func parseDuration(v string) (time.Duration, error) {
+	v = strings.TrimSpace(v)
+	if v == "" || v == "0" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, errors.New("expected a duration such as 30m, 12h or 7d")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, errors.New("expected a duration such as 30m, 12h or 7d")
+	}
+	return d, nil
+}
+
+//#endregion actions
+
+//#region members
+
+// returned when the members of a server have been fetched into the broker
+type memberListMsg struct {
+	err error
+}
+
+var _ tabMsg = memberListMsg{}
+
+func (memberListMsg) recipient() tabConst {
+	return MEMBERS
+}
+
+// Fetches the members of the given server into the broker.
+func fetchMembers(serverID string) tea.Cmd {
+	session := broker.Session()
+	return func() tea.Msg {
+		members, err := session.ServerMembers(serverID)
+		if err != nil {
+			log.Writer.Warn("failed to fetch server members", "server ID", serverID, "error", err)
+			return memberListMsg{err: err}
+		}
+		broker.AddUsers(members.Users...)
+		broker.AddAllMembers(serverID, members.Members...)
+		return memberListMsg{}
+	}
+}
+
+// returned when the bans of a server have been fetched
+type bansMsg struct {
+	bans *revoltgo.ServerBans
+	err  error
+}
+
+var _ tabMsg = bansMsg{}
+
+func (bansMsg) recipient() tabConst {
+	return MEMBERS
+}
+
+func fetchBans(serverID string) tea.Cmd {
+	session := broker.Session()
+	return func() tea.Msg {
+		bans, err := api.Bans(session, serverID)
+		if err != nil {
+			log.Writer.Warn("failed to fetch bans", "server ID", serverID, "error", err)
+		}
+		return bansMsg{bans: bans, err: err}
+	}
+}
+
+// member (or banned user) representation for the members list.Model
+type memberItem struct {
+	userID    string
+	name      string
+	roles     []string
+	timeout   time.Time // zero if not timed out
+	banned    bool
+	banReason string
+}
+
+var _ list.Item = memberItem{} // check interface
+
+func (mi memberItem) Title() string {
+	return mi.name
+}
+
+func (mi memberItem) Description() string {
+	switch {
+	case mi.banned && mi.banReason != "":
+		return "banned: " + mi.banReason
+	case mi.banned:
+		return "banned"
+	case !mi.timeout.IsZero():
+		return "timed out until " + mi.timeout.Format(time.Stamp)
+	}
+	return strings.Join(mi.roles, ", ")
+}
+
+func (mi memberItem) FilterValue() string {
+	return mi.name
+}
+
+//#endregion members
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"revolt_tui/broker"
+	"revolt_tui/keys"
+	"revolt_tui/stylesheet/colors"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+/**
+ * This file implements the confirmation modal used by moderation actions.
+ * A modal asks a question, optionally collects details through a form, and runs its action once the
+ * user confirms with settings.select. The owning tab closes the modal when the action's result
+ * arrives (as an actionDoneMsg) and reports it in the status bar.
+ */
+
+var modalStyle lipgloss.Style
+
+func init() {
+	colors.OnChange(func() {
+		modalStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).
+			BorderForeground(colors.Warning).Padding(0, 1)
+	})
+}
+
+type modal struct {
+	question string
+	form     form
+	status   statusLine
+	busy     bool // the action is in flight
+	// validates the form, returning the action to run or a description of why the form is invalid
+	submit func() (tea.Cmd, string)
+}
+
+// Creates a modal asking the given question above the given (optional) rows.
+func newModal(question string, submit func() (tea.Cmd, string), rows ...formRow) *modal {
+	m := &modal{question: question, form: form{rows: rows}, submit: submit}
+	m.form.setCursor(0)
+	return m
+}
+
+// Handles input while the modal is open.
+// Returns true if the modal was dismissed.
+func (m *modal) update(msg tea.KeyMsg) (tea.Cmd, bool) {
+	if m.busy {
+		return nil, false
+	}
+	switch {
+	case keys.Matches(msg, keys.SettingsBack):
+		return nil, true
+	case keys.Matches(msg, keys.SettingsSelect):
+		cmd, errDesc := m.submit()
+		if errDesc != "" {
+			m.status.set(errDesc, true)
+			return nil, false
+		}
+		m.busy = true
+		m.status.set("working...", false)
+		return cmd, false
+	}
+	return m.form.Update(msg), false
+}
+
+// Draws the modal centered in the given area.
+func (m *modal) View(width, height int) string {
+	hint := keys.Get(keys.SettingsSelect).Help().Key + " to confirm, " +
+		keys.Get(keys.SettingsBack).Help().Key + " to cancel"
+	content := settingsConfirmSty.Render(m.question) + "\n"
+	if len(m.form.rows) > 0 {
+		content += "\n" + m.form.View(len(m.form.rows))
+	}
+	content += "\n" + m.status.view(hint)
+	return lipgloss.Place(width, height, lipgloss.Center, lipgloss.Center, modalStyle.Render(content))
+}
+
+// Tabs that may display a modal.
+// While one is open, its tab's own bindings are replaced by the settings scope.
+type modalHolder interface {
+	modalOpen() bool
+}
+
+// the result of a modal's action
+type actionDoneMsg struct {
+	to      tabConst
+	summary string // reported on success
+	err     error
+}
+
+var _ tabMsg = actionDoneMsg{}
+
+func (m actionDoneMsg) recipient() tabConst {
+	return m.to
+}
+
+// Reports the result of an action in the status bar.
+func (m actionDoneMsg) report() {
+	if m.err != nil {
+		broker.PostError(m.err)
+		return
+	}
+	broker.PostNotice(m.summary)
+}
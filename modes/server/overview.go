@@ -3,21 +3,37 @@ package server
 import (
 	"fmt"
 	"revolt_tui/broker"
+	"revolt_tui/instance"
+	"revolt_tui/log"
 	"revolt_tui/stylesheet/colors"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/charmbracelet/log"
+	"github.com/oklog/ulid/v2"
 	"github.com/sentinelb51/revoltgo"
 )
 
 type overviewTab struct {
+	server           *revoltgo.Server
+	owner            *revoltgo.User // nil until resolved
+	ownerPending     bool
+	memberCount      int // -1 until resolved, -2 on failure
+	spinner          spinner.Model
 	compiledOverview string
 }
 
 var _ tab = &overviewTab{}
 
+const (
+	memberCountPending = -1
+	memberCountFailed  = -2
+)
+
 // user-facing name of the tab
 func (*overviewTab) Name() string {
 	return "overview"
@@ -28,62 +44,312 @@ func (*overviewTab) Enabled() bool {
 	return true
 }
 
-func (o *overviewTab) Init(s *revoltgo.Server, _, _ int) {
+func (o *overviewTab) Init(s *revoltgo.Server, _, _ int) tea.Cmd {
 	// s is nil checked prior to call
+	o.server = s
+	o.spinner = newSpinner()
+
+	// the member count is cached once any tab has fetched the member list; otherwise fetch it
+	var cmds []tea.Cmd
+	if n, ok := broker.MemberCount(s.ID); ok {
+		o.memberCount = n
+	} else {
+		o.memberCount = memberCountPending
+		cmds = append(cmds, fetchMemberCount(s.ID))
+	}
+	// the owner is likely cached if we share other servers with them; otherwise fetch them
+	o.owner = broker.User(s.Owner)
+	o.ownerPending = o.owner == nil
+	if o.ownerPending {
+		cmds = append(cmds, fetchUser(OVERVIEW, s.Owner))
+	}
+	if len(cmds) > 0 {
+		cmds = append(cmds, addressTick(OVERVIEW, o.spinner.Tick))
+	}
 
-	o.compiledOverview = generateOverview(s)
+	o.compiledOverview = o.generateOverview()
 
-	// TODO send out a goroutine to poll for overview updates
+	// further changes arrive as store updates
+	return tea.Batch(cmds...)
 }
 
-// generates the overview display for the given server
-func generateOverview(s *revoltgo.Server) string {
+// generates the overview display for the current server
+func (o *overviewTab) generateOverview() string {
+	s := o.server
 	// pre-generate the server overview
 	var sb strings.Builder
 	sb.WriteString(titleSty.Render(s.Name) + "\n")
 	sb.WriteString(subtitleSty.Render(s.Description) + "\n")
 	sb.WriteRune('\n')
-	var notDiscover string
-	if s.Discoverable != nil && !(*s.Discoverable) {
-		notDiscover = "not "
-	}
 
-	// fetch data for the overview
 	var username string
-	if owner, err := broker.Session.User(s.Owner); err != nil || owner == nil {
-		log.Warn("failed to fetch server owner", "owner ID", s.Owner, "server ID", s.ID)
+	switch {
+	case o.ownerPending:
+		username = o.spinner.View()
+	case o.owner == nil:
 		username = "unknown (" + s.Owner + ")"
-	} else {
-		username = owner.DisplayName
+	case o.owner.DisplayName != "":
+		username = o.owner.DisplayName
+	default:
+		username = o.owner.Username
+	}
+
+	var members string
+	switch o.memberCount {
+	case memberCountPending:
+		members = o.spinner.View()
+	case memberCountFailed:
+		members = "unknown"
+	default:
+		members = strconv.Itoa(o.memberCount)
 	}
 
 	// generate and pair up fields+values
-	left := lipgloss.JoinVertical(lipgloss.Right, leftAlignerSty.Render("Owner:"), leftAlignerSty.Render("ID:"))
-	right := username + "\n" + s.ID
+	sb.WriteString(fields(
+		"Owner:", username,
+		"ID:", s.ID,
+		"Created:", created(s.ID),
+		"Members:", members,
+		"Channels:", o.channelCounts(),
+		"Icon:", attachmentName(s.Icon),
+		"Banner:", attachmentName(s.Banner),
+	))
+
+	sb.WriteString("\n\n" + headerSty.Render("Categories") + "\n")
+	if len(s.Categories) == 0 {
+		sb.WriteString("none\n")
+	}
+	for _, cat := range s.Categories {
+		if cat != nil {
+			sb.WriteString(fmt.Sprintf("%s (%d)\n", cat.Title, len(cat.Channels)))
+		}
+	}
 
-	sb.WriteString(lipgloss.JoinHorizontal(lipgloss.Center, left, right))
+	sb.WriteString("\n" + headerSty.Render("Roles") + "\n")
+	sb.WriteString(roleList(s.Roles) + "\n")
 
+	sb.WriteString("\n" + headerSty.Render("System Messages") + "\n")
+	sb.WriteString(fields(
+		"Joined:", o.channelName(s.SystemMessages.UserJoined),
+		"Left:", o.channelName(s.SystemMessages.UserLeft),
+		"Kicked:", o.channelName(s.SystemMessages.UserKicked),
+		"Banned:", o.channelName(s.SystemMessages.UserBanned),
+	))
+
+	var notDiscover string
+	if s.Discoverable == nil || !(*s.Discoverable) {
+		notDiscover = "not "
+	}
 	sb.WriteString(fmt.Sprintf("\n\nThis server is %sdiscoverable.", notDiscover))
 
 	return sb.String()
 }
 
-func (*overviewTab) Update(msg tea.Msg) (tea.Cmd, tabConst) {
-	// no work to be done until server changes
+func (o *overviewTab) Update(msg tea.Msg) (tea.Cmd, tabConst) {
+	switch m := msg.(type) {
+	case broker.StoreChangedMsg:
+		if o.server == nil || m.ServerID != o.server.ID {
+			return nil, OVERVIEW
+		}
+		switch m.Kind {
+		case broker.KindServer, broker.KindRole, broker.KindChannel:
+			if s := broker.Server(o.server.ID); s != nil {
+				o.server = s
+			}
+		case broker.KindMember:
+			if n, ok := broker.MemberCount(o.server.ID); ok {
+				o.memberCount = n
+			} else if o.memberCount >= 0 && m.Op == broker.OpCreate {
+				o.memberCount += 1
+			} else if o.memberCount > 0 && m.Op == broker.OpDelete {
+				o.memberCount -= 1
+			}
+		default:
+			return nil, OVERVIEW
+		}
+		// the owner may have changed hands
+		var cmd tea.Cmd
+		if o.owner == nil || o.owner.ID != o.server.Owner {
+			o.owner = broker.User(o.server.Owner)
+			if o.ownerPending = o.owner == nil; o.ownerPending {
+				cmd = tea.Batch(fetchUser(OVERVIEW, o.server.Owner), addressTick(OVERVIEW, o.spinner.Tick))
+			}
+		}
+		o.compiledOverview = o.generateOverview()
+		return cmd, OVERVIEW
+	case userFetchedMsg:
+		if o.server == nil || m.userID != o.server.Owner {
+			return nil, OVERVIEW
+		}
+		o.owner, o.ownerPending = m.user, false
+		o.compiledOverview = o.generateOverview()
+	case memberCountMsg:
+		if o.server == nil || m.serverID != o.server.ID {
+			return nil, OVERVIEW
+		}
+		o.memberCount = m.count
+		o.compiledOverview = o.generateOverview()
+	case spinnerTickMsg:
+		if !o.ownerPending && o.memberCount != memberCountPending { // let the spinner die
+			return nil, OVERVIEW
+		}
+		var cmd tea.Cmd
+		o.spinner, cmd = o.spinner.Update(m.tick)
+		o.compiledOverview = o.generateOverview()
+		return addressTick(OVERVIEW, cmd), OVERVIEW
+	case broker.ConfigChangedMsg: // redraw in the new theme
+		if o.server != nil {
+			o.compiledOverview = o.generateOverview()
+		}
+	}
 	return nil, OVERVIEW
 }
+
 func (o *overviewTab) View() string {
 	return o.compiledOverview
 }
 
+//#region helper functions
+
+// returned when the member count of a server has been fetched
+type memberCountMsg struct {
+	serverID string
+	count    int
+}
+
+var _ tabMsg = memberCountMsg{}
+
+func (memberCountMsg) recipient() tabConst {
+	return OVERVIEW
+}
+
+// Fetches the number of members in the given server.
+func fetchMemberCount(serverID string) tea.Cmd {
+	session := broker.Session()
+	return func() tea.Msg {
+		members, err := bounded(func() (*revoltgo.ServerMembers, error) {
+			return session.ServerMembers(serverID)
+		})
+		if err != nil || members == nil {
+			log.Writer.Warn("failed to fetch server members", "server ID", serverID, "error", err)
+			return memberCountMsg{serverID: serverID, count: memberCountFailed}
+		}
+		broker.AddUsers(members.Users...)
+		broker.AddAllMembers(serverID, members.Members...)
+		return memberCountMsg{serverID: serverID, count: len(members.Members)}
+	}
+}
+
+// Aligns the given field/value pairs into two columns.
+func fields(pairs ...string) string {
+	var left, right []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		left = append(left, leftAlignerSty.Render(pairs[i]))
+		right = append(right, pairs[i+1])
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top,
+		lipgloss.JoinVertical(lipgloss.Right, left...), strings.Join(right, "\n"))
+}
+
+// Returns the creation date encoded in the given (ULID) ID.
+func created(id string) string {
+	u, err := ulid.Parse(id)
+	if err != nil {
+		return "unknown"
+	}
+	return ulid.Time(u.Time()).Local().Format(time.DateOnly)
+}
+
+// Returns the number of channels of each type in the current server.
+func (o *overviewTab) channelCounts() string {
+	var text, voice, other int
+	for _, id := range o.server.Channels {
+		ch := broker.Channel(id)
+		switch {
+		case ch == nil:
+			other += 1
+		case ch.ChannelType == revoltgo.ChannelTypeText:
+			text += 1
+		case ch.ChannelType == revoltgo.ChannelTypeVoice:
+			voice += 1
+		default:
+			other += 1
+		}
+	}
+	counts := fmt.Sprintf("%d text, %d voice", text, voice)
+	if other > 0 {
+		counts += fmt.Sprintf(", %d other", other)
+	}
+	return counts
+}
+
+// Returns the name of the given channel, for system message settings.
+func (o *overviewTab) channelName(id string) string {
+	if id == "" {
+		return "disabled"
+	}
+	if ch := broker.Channel(id); ch != nil {
+		return "#" + ch.Name
+	}
+	return id
+}
+
+func attachmentName(a *revoltgo.Attachment) string {
+	if a == nil {
+		return "none"
+	}
+	if u := instance.AttachmentURL(a); u != "" {
+		return a.Filename + " (" + u + ")"
+	}
+	return a.Filename
+}
+
+// Lists the given roles, highest ranked (lowest rank value) first, in their colours.
+func roleList(roles map[string]*revoltgo.ServerRole) string {
+	if len(roles) == 0 {
+		return "none"
+	}
+	sorted := make([]*revoltgo.ServerRole, 0, len(roles))
+	for _, r := range roles {
+		if r != nil {
+			sorted = append(sorted, r)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Rank < sorted[j].Rank })
+	names := make([]string, len(sorted))
+	for i, r := range sorted {
+		names[i] = roleStyle(r).Render(r.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Returns the style of the given role's name, coloured if the role's colour is a plain hex value.
+// (Revolt also permits CSS gradients, which are drawn uncoloured.)
+func roleStyle(r *revoltgo.ServerRole) lipgloss.Style {
+	sty := lipgloss.NewStyle()
+	if strings.HasPrefix(r.Colour, "#") && (len(r.Colour) == 4 || len(r.Colour) == 7) {
+		sty = sty.Foreground(lipgloss.Color(r.Colour))
+	}
+	return sty
+}
+
+//#endregion helper functions
+
 // #region styles
 
 var (
 	titleSty       lipgloss.Style = lipgloss.NewStyle().Bold(true)
 	subtitleSty    lipgloss.Style = lipgloss.NewStyle().Italic(true)
-	leftAlignerSty lipgloss.Style = lipgloss.NewStyle().
-			AlignHorizontal(lipgloss.Right).
-			Width(7).PaddingRight(1).Foreground(colors.LeftField)
+	leftAlignerSty lipgloss.Style
+	headerSty      lipgloss.Style = lipgloss.NewStyle().Bold(true).Underline(true)
 )
 
+func init() {
+	colors.OnChange(func() {
+		leftAlignerSty = lipgloss.NewStyle().
+			AlignHorizontal(lipgloss.Right).
+			Width(10).PaddingRight(1).Foreground(colors.LeftField)
+	})
+}
+
 //#endregion styles
@@ -0,0 +1,600 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"revolt_tui/api"
+	"revolt_tui/broker"
+	"revolt_tui/keys"
+	"revolt_tui/log"
+	"slices"
+	"sort"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sentinelb51/revoltgo"
+)
+
+/**
+ * This file handles the roles tab, where admins create, reorder, recolour and edit roles, as well as
+ * the permission overrides of each role (and of @everyone) on individual channels.
+ * The tab has two pages: the role list and the editor for a single role.
+ * Every change is confirmed before it is sent; the resulting events refresh the tab via the store.
+ */
+
+const (
+	defaultRoleID  = "default" // stands in for @everyone, as in Revolt's permission endpoints
+	roleGroup      = "roles"
+	roleNameMaxLen = 32
+	// as Revolt permits; the colour may be any CSS colour (ex: a gradient), not only a hex colour
+	roleColourMaxLen = 128
+)
+
+var hexColour = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+type rolesTab struct {
+	server *revoltgo.Server
+	height int
+
+	list       form
+	newRole    *textRow
+	rankOrder  []string // role IDs in their saved order, highest ranked first
+	editor     *roleEditor
+	confirming func() tea.Cmd // the action awaiting confirmation, if any
+	saving     bool
+	status     statusLine
+}
+
+// the editor page for a single role
+type roleEditor struct {
+	roleID    string // defaultRoleID for @everyone
+	channelID string // the channel whose override is being edited; "" for server-wide permissions
+
+	form   form
+	name   *textRow
+	colour *textRow
+	hoist  *toggleRow
+	scope  *textRow
+	perms  []*triRow
+}
+
+var _ tab = &rolesTab{}
+
+func (*rolesTab) Name() string {
+	return "roles"
+}
+
+func (rt *rolesTab) Enabled() bool {
+	return rt.server != nil && (broker.HasServerPermission(rt.server.ID, broker.PermManageRole) ||
+		broker.HasServerPermission(rt.server.ID, broker.PermManagePermissions))
+}
+
+func (rt *rolesTab) Init(s *revoltgo.Server, _, height int) tea.Cmd {
+	rt.server = s
+	rt.height = height
+	rt.editor, rt.confirming, rt.saving = nil, nil, false
+	rt.status.set("", false)
+	rt.buildList()
+	return nil
+}
+
+func (rt *rolesTab) Update(msg tea.Msg) (tea.Cmd, tabConst) {
+	switch m := msg.(type) {
+	case tea.WindowSizeMsg:
+		rt.height = m.Height
+	case broker.StoreChangedMsg:
+		rt.onStoreChanged(m)
+	case rolesSavedMsg:
+		rt.saving = false
+		if m.err != nil {
+			rt.status.set("failed to save: "+m.err.Error(), true)
+			return nil, ROLES
+		}
+		rt.status.set(m.done, false)
+		rt.refresh(true)
+	case tea.KeyMsg:
+		return rt.updateKey(m), ROLES
+	}
+	return nil, ROLES
+}
+
+func (rt *rolesTab) updateKey(msg tea.KeyMsg) tea.Cmd {
+	if rt.saving {
+		return nil
+	}
+	if rt.confirming != nil {
+		switch {
+		case keys.Matches(msg, keys.SettingsConfirm):
+			action := rt.confirming
+			rt.confirming, rt.saving = nil, true
+			rt.status.set("saving...", false)
+			return action()
+		case keys.Matches(msg, keys.SettingsCancel, keys.SettingsBack):
+			rt.confirming = nil
+			rt.status.set("", false)
+		}
+		return nil
+	}
+
+	if rt.editor != nil {
+		return rt.updateEditor(msg)
+	}
+
+	switch {
+	case keys.Matches(msg, keys.SettingsSelect):
+		switch row := rt.list.focused().(type) {
+		case *orderRow:
+			rt.openEditor(row.id)
+		case *textRow: // the new role field
+			rt.requestCreate()
+		}
+		return nil
+	case keys.Matches(msg, keys.SettingsMoveUp):
+		rt.list.swap(-1)
+		return nil
+	case keys.Matches(msg, keys.SettingsMoveDown):
+		rt.list.swap(1)
+		return nil
+	case keys.Matches(msg, keys.SettingsSave):
+		rt.requestReorder()
+		return nil
+	case keys.Matches(msg, keys.SettingsReset):
+		rt.buildList()
+		rt.status.set("changes discarded", false)
+		return nil
+	}
+	return rt.list.Update(msg)
+}
+
+func (rt *rolesTab) updateEditor(msg tea.KeyMsg) tea.Cmd {
+	ed := rt.editor
+	switch {
+	case keys.Matches(msg, keys.SettingsBack):
+		rt.editor = nil
+		rt.status.set("", false)
+		return nil
+	case keys.Matches(msg, keys.SettingsSelect) && ed.form.focused() == ed.scope:
+		channelID, errDesc := resolveChannel(rt.server, ed.scope.value(), false)
+		if errDesc != "" {
+			ed.scope.err = errDesc
+			return nil
+		}
+		ed.channelID = channelID
+		ed.scope.initial = ed.scope.value()
+		rt.loadPermissions()
+		return nil
+	case keys.Matches(msg, keys.SettingsSave):
+		rt.requestEdit()
+		return nil
+	case keys.Matches(msg, keys.SettingsReset):
+		rt.openEditor(ed.roleID)
+		rt.status.set("changes discarded", false)
+		return nil
+	}
+	return ed.form.Update(msg)
+}
+
+func (rt *rolesTab) View() string {
+	if rt.editor != nil {
+		hint := fmt.Sprintf("%s to save, %s to return", keys.Get(keys.SettingsSave).Help().Key,
+			keys.Get(keys.SettingsBack).Help().Key)
+		return rt.editor.form.View(rt.height-2) + "\n" + rt.status.view(hint)
+	}
+	hint := fmt.Sprintf("%s to edit, %s/%s to reorder, %s to save order",
+		keys.Get(keys.SettingsSelect).Help().Key, keys.Get(keys.SettingsMoveUp).Help().Key,
+		keys.Get(keys.SettingsMoveDown).Help().Key, keys.Get(keys.SettingsSave).Help().Key)
+	return rt.list.View(rt.height-2) + "\n" + rt.status.view(hint)
+}
+
+//#region role list
+
+// (Re)builds the role list from the current server.
+func (rt *rolesTab) buildList() {
+	roles := broker.Roles(rt.server.ID)
+	rt.rankOrder = rankedRoleIDs(roles)
+
+	rows := []formRow{newSection("Roles (highest first)")}
+	for _, id := range rt.rankOrder {
+		r := roles[id]
+		text := roleStyle(r).Render(r.Name)
+		if r.Hoist {
+			text += " (hoisted)"
+		}
+		rows = append(rows, &orderRow{group: roleGroup, id: id, text: text})
+	}
+	rows = append(rows, &orderRow{group: defaultRoleID, id: defaultRoleID, text: "@everyone"})
+
+	rt.newRole = newTextRow("New role", "", roleNameMaxLen, validateRoleName)
+	rows = append(rows, newSection("Create"), rt.newRole)
+
+	cursor := rt.list.cursor
+	rt.list = form{rows: rows}
+	rt.list.setCursor(1)
+	if cursor > 1 && cursor < len(rows) {
+		rt.list.setCursor(cursor)
+	}
+}
+
+// Returns the IDs of the given roles, highest ranked (lowest rank value) first.
+func rankedRoleIDs(roles map[string]*revoltgo.ServerRole) []string {
+	ids := make([]string, 0, len(roles))
+	for id := range roles {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if roles[ids[i]].Rank == roles[ids[j]].Rank {
+			return ids[i] < ids[j]
+		}
+		return roles[ids[i]].Rank < roles[ids[j]].Rank
+	})
+	return ids
+}
+
+// Returns the role IDs in their current order in the list.
+func (rt *rolesTab) listOrder() []string {
+	var ids []string
+	for _, r := range rt.list.rows {
+		if or, ok := r.(*orderRow); ok && or.group == roleGroup {
+			ids = append(ids, or.id)
+		}
+	}
+	return ids
+}
+
+func validateRoleName(v string) string {
+	if v == "" {
+		return "a name is required"
+	}
+	return ""
+}
+
+// Asks the user to confirm creation of the role named in the new role field.
+func (rt *rolesTab) requestCreate() {
+	if !rt.newRole.check() {
+		return
+	}
+	if !broker.HasServerPermission(rt.server.ID, broker.PermManageRole) {
+		rt.status.set("you do not have permission to manage roles", true)
+		return
+	}
+	serverID, name := rt.server.ID, rt.newRole.value()
+	rt.confirming = func() tea.Cmd {
+		session := broker.Session()
+		return func() tea.Msg {
+			if _, err := api.CreateRole(session, serverID, name); err != nil {
+				log.Writer.Warn("failed to create role", "server ID", serverID, "error", err)
+				return rolesSavedMsg{err: err}
+			}
+			return rolesSavedMsg{done: "created " + name}
+		}
+	}
+	rt.status.ask("Create role " + name + "?")
+}
+
+// Asks the user to confirm the new role order.
+// The existing rank values are redistributed in the new order, so only moved roles are edited.
+func (rt *rolesTab) requestReorder() {
+	order := rt.listOrder()
+	if slices.Equal(order, rt.rankOrder) {
+		rt.status.set("nothing to save", false)
+		return
+	}
+	roles := broker.Roles(rt.server.ID)
+	ranks := make([]int, 0, len(rt.rankOrder))
+	for _, id := range rt.rankOrder {
+		ranks = append(ranks, roles[id].Rank)
+	}
+	top := broker.TopRank(rt.server.ID)
+	edits := make(map[string]int)
+	for i, id := range order {
+		if roles[id] != nil && roles[id].Rank != ranks[i] {
+			if roles[id].Rank <= top || ranks[i] <= top {
+				rt.status.set("you may only reorder roles ranked below your own", true)
+				return
+			}
+			edits[id] = ranks[i]
+		}
+	}
+
+	serverID := rt.server.ID
+	rt.confirming = func() tea.Cmd {
+		session := broker.Session()
+		return func() tea.Msg {
+			for id, rank := range edits {
+				rank := rank
+				if err := api.EditRole(session, serverID, id, api.RoleEdit{Rank: &rank}); err != nil {
+					log.Writer.Warn("failed to rerank role", "server ID", serverID, "role ID", id, "error", err)
+					return rolesSavedMsg{err: err}
+				}
+			}
+			return rolesSavedMsg{done: "role order saved"}
+		}
+	}
+	rt.status.ask(fmt.Sprintf("Save the new order (%d roles moved)?", len(edits)))
+}
+
+//#endregion role list
+
+//#region role editor
+
+// Opens the editor for the given role.
+func (rt *rolesTab) openEditor(roleID string) {
+	ed := &roleEditor{roleID: roleID}
+	rt.editor = ed
+	rt.status.set("", false)
+
+	rows := []formRow{}
+	if roleID == defaultRoleID {
+		rows = append(rows, newSection("@everyone"))
+	} else {
+		role := broker.Roles(rt.server.ID)[roleID]
+		if role == nil {
+			rt.editor = nil
+			rt.status.set("role no longer exists", true)
+			return
+		}
+		ed.name = newTextRow("Name", role.Name, roleNameMaxLen, validateRoleName)
+		ed.colour = newTextRow("Colour", role.Colour, roleColourMaxLen, func(v string) string {
+			// Revolt also permits CSS colours set by other clients; only new values must be hex
+			if v != "" && v != role.Colour && !hexColour.MatchString(v) {
+				return "use a hex colour such as #fd6671"
+			}
+			return ""
+		})
+		ed.hoist = newToggleRow("Display separately", role.Hoist)
+		rows = append(rows, newSection("Role: "+roleStyle(role).Render(role.Name)), ed.name, ed.colour, ed.hoist)
+	}
+	ed.scope = newTextRow("Channel", "", 64, nil)
+	rows = append(rows, newSection(fmt.Sprintf("Permissions (blank channel for server-wide; %s to apply)",
+		keys.Get(keys.SettingsSelect).Help().Key)), ed.scope)
+
+	ed.form = form{rows: rows}
+	ed.form.setCursor(1)
+	rt.loadPermissions()
+}
+
+// (Re)generates the editor's permission rows for the current role and scope.
+func (rt *rolesTab) loadPermissions() {
+	ed := rt.editor
+	current, noDeny := rt.currentOverride()
+
+	// drop any existing permission rows
+	rows := slices.DeleteFunc(ed.form.rows, func(r formRow) bool {
+		_, isTri := r.(*triRow)
+		return isTri
+	})
+	ed.perms = nil
+	for _, p := range broker.PermissionNames {
+		state := triInherit
+		if current.Allow&p.Bit != 0 {
+			state = triAllow
+		} else if current.Deny&p.Bit != 0 {
+			state = triDeny
+		}
+		r := newTriRow(p.Name, state, noDeny)
+		ed.perms = append(ed.perms, r)
+		rows = append(rows, r)
+	}
+	ed.form.rows = rows
+}
+
+// Returns the saved permissions of the role being edited in the current scope.
+// Server-wide defaults cannot deny, as there is nothing beneath them to override.
+func (rt *rolesTab) currentOverride() (p revoltgo.PermissionAD, noDeny bool) {
+	ed := rt.editor
+	if ed.channelID != "" {
+		ch := broker.Channel(ed.channelID)
+		if ch == nil {
+			return p, false
+		}
+		o := ch.DefaultPermissions
+		if ed.roleID != defaultRoleID {
+			o = ch.RolePermissions[ed.roleID]
+		}
+		if o != nil {
+			p = *o
+		}
+		return p, false
+	}
+	if ed.roleID == defaultRoleID {
+		if rt.server.DefaultPermissions != nil {
+			p.Allow = *rt.server.DefaultPermissions
+		}
+		return p, true
+	}
+	if r := broker.Roles(rt.server.ID)[ed.roleID]; r != nil && r.Permissions != nil {
+		p = *r.Permissions
+	}
+	return p, false
+}
+
+// Returns the given (saved) permissions with the rows changed in the editor applied.
+// Only changed rows are applied, so bits this client does not list are kept.
+func (ed *roleEditor) override(p revoltgo.PermissionAD) revoltgo.PermissionAD {
+	for i, r := range ed.perms {
+		if r.state == r.initial {
+			continue
+		}
+		bit := broker.PermissionNames[i].Bit
+		p.Allow &^= bit
+		p.Deny &^= bit
+		switch r.state {
+		case triAllow:
+			p.Allow |= bit
+		case triDeny:
+			p.Deny |= bit
+		}
+	}
+	return p
+}
+
+// Has the role's name, colour or display setting changed?
+func (ed *roleEditor) metaChanged() bool {
+	return ed.name != nil && (ed.name.changed() || ed.colour.changed() || ed.hoist.on != ed.hoist.initial)
+}
+
+// Have the permission rows changed?
+func (ed *roleEditor) permsChanged() bool {
+	for _, r := range ed.perms {
+		if r.state != r.initial {
+			return true
+		}
+	}
+	return false
+}
+
+// Validates the editor and asks the user to confirm the changes, if permitted.
+func (rt *rolesTab) requestEdit() {
+	ed := rt.editor
+	if ed.scope.changed() {
+		ed.scope.err = "press " + keys.Get(keys.SettingsSelect).Help().Key + " to apply"
+		rt.status.set("apply or clear the channel first", true)
+		return
+	}
+	if ed.name != nil && !(ed.name.check() && ed.colour.check()) {
+		rt.status.set("please correct the highlighted fields", true)
+		return
+	}
+	meta, perms := ed.metaChanged(), ed.permsChanged()
+	if !meta && !perms {
+		rt.status.set("nothing to save", false)
+		return
+	}
+
+	// gate on the permissions Revolt will require
+	if meta && !broker.HasServerPermission(rt.server.ID, broker.PermManageRole) {
+		rt.status.set("you do not have permission to manage roles", true)
+		return
+	}
+	if perms {
+		if ed.channelID != "" && !broker.HasChannelPermission(ed.channelID, broker.PermManagePermissions) {
+			rt.status.set("you do not have permission to manage this channel's permissions", true)
+			return
+		} else if ed.channelID == "" && !broker.HasServerPermission(rt.server.ID, broker.PermManagePermissions) {
+			rt.status.set("you do not have permission to manage permissions", true)
+			return
+		}
+	}
+	if ed.roleID != defaultRoleID {
+		if r := broker.Roles(rt.server.ID)[ed.roleID]; r != nil && r.Rank <= broker.TopRank(rt.server.ID) {
+			rt.status.set("you may only edit roles ranked below your own", true)
+			return
+		}
+	}
+
+	current, _ := rt.currentOverride()
+	var (
+		serverID, roleID, channelID = rt.server.ID, ed.roleID, ed.channelID
+		override                    = ed.override(current)
+		edit                        *api.RoleEdit
+	)
+	if meta {
+		name, colour, hoist := ed.name.value(), ed.colour.value(), ed.hoist.on
+		edit = &api.RoleEdit{Name: &name, Hoist: &hoist}
+		if colour == "" {
+			edit.Remove = []string{"Colour"}
+		} else {
+			edit.Colour = &colour
+		}
+	}
+	rt.confirming = func() tea.Cmd {
+		session := broker.Session()
+		return func() tea.Msg {
+			var err error
+			if edit != nil {
+				err = api.EditRole(session, serverID, roleID, *edit)
+			}
+			if err == nil && perms {
+				err = setPermissions(session, serverID, roleID, channelID, override)
+			}
+			if err != nil {
+				log.Writer.Warn("failed to edit role", "server ID", serverID, "role ID", roleID, "error", err)
+				return rolesSavedMsg{err: err}
+			}
+			return rolesSavedMsg{done: "saved"}
+		}
+	}
+	where := "server-wide"
+	if channelID != "" {
+		where = "on " + ed.scope.value()
+	}
+	switch {
+	case meta && perms:
+		rt.status.ask("Save role and its permissions " + where + "?")
+	case meta:
+		rt.status.ask("Save role?")
+	default:
+		rt.status.ask("Save permissions " + where + "?")
+	}
+}
+
+// Sends the given permissions to the appropriate endpoint for the role and scope.
+func setPermissions(session *revoltgo.Session, serverID, roleID, channelID string, p revoltgo.PermissionAD) error {
+	switch {
+	case channelID != "":
+		return api.SetChannelPermissions(session, channelID, roleID, p)
+	case roleID == defaultRoleID:
+		if p.Deny != 0 {
+			return errors.New("server-wide defaults cannot deny permissions")
+		}
+		return session.PermissionsSetDefault(serverID, revoltgo.PermissionsSetDefaultData{Permissions: p.Allow})
+	}
+	return api.SetRolePermissions(session, serverID, roleID, p)
+}
+
+//#endregion role editor
+
+//#region refreshing
+
+// returned when a change to roles completes
+type rolesSavedMsg struct {
+	done string // description of the completed change
+	err  error
+}
+
+var _ tabMsg = rolesSavedMsg{}
+
+func (rolesSavedMsg) recipient() tabConst {
+	return ROLES
+}
+
+// Follows role, channel and server changes made elsewhere, unless they would clobber unsaved edits.
+func (rt *rolesTab) onStoreChanged(m broker.StoreChangedMsg) {
+	if rt.server == nil || m.ServerID != rt.server.ID {
+		return
+	}
+	switch m.Kind {
+	case broker.KindRole, broker.KindServer, broker.KindChannel:
+	default:
+		return
+	}
+	if s := broker.Server(rt.server.ID); s != nil {
+		rt.server = s
+	}
+	rt.refresh(false)
+}
+
+// Rebuilds the current page from the store.
+// Unless force is set, pages with unsaved changes are left alone.
+func (rt *rolesTab) refresh(force bool) {
+	if s := broker.Server(rt.server.ID); s != nil {
+		rt.server = s
+	}
+	if ed := rt.editor; ed != nil {
+		if force || (!ed.metaChanged() && !ed.permsChanged()) {
+			scope, channelID := ed.scope.value(), ed.channelID
+			rt.openEditor(ed.roleID)
+			if rt.editor != nil && channelID != "" {
+				rt.editor.scope.SetValue(scope)
+				rt.editor.channelID = channelID
+				rt.loadPermissions()
+			}
+		}
+		return
+	}
+	if force || slices.Equal(rt.listOrder(), rt.rankOrder) {
+		rt.buildList()
+	}
+}
+
+//#endregion refreshing
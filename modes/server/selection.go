@@ -0,0 +1,202 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"revolt_tui/api"
+	"revolt_tui/broker"
+	"revolt_tui/keys"
+	"revolt_tui/log"
+	"revolt_tui/stylesheet/colors"
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sentinelb51/revoltgo"
+)
+
+/**
+ * This file handles message selection in the chat tab, used by moderators to bulk-delete messages.
+ * While selecting, the compose area is blurred and the chat keys move a cursor through the displayed
+ * messages, marking those to delete. Deletion is confirmed in a modal and reported in the status bar.
+ */
+
+const selectionSegment string = "selection" // status bar segment key
+
+var selectionCursorSty, selectionMarkSty lipgloss.Style
+
+func init() {
+	colors.OnChange(func() {
+		selectionCursorSty = lipgloss.NewStyle().Bold(true).Foreground(colors.TabBorderForeground)
+		selectionMarkSty = lipgloss.NewStyle().Foreground(colors.Warning)
+	})
+}
+
+// Enters selection mode with the cursor on the newest message, if the user may delete messages.
+func (cht *chatTab) startSelection() {
+	if !broker.HasChannelPermission(cht.channelID, broker.PermManageMessages) {
+		broker.PostError(errors.New("you do not have permission to delete messages in this channel"))
+		return
+	}
+	visible := cht.visibleMessages()
+	if len(visible) == 0 {
+		return
+	}
+	cht.selecting = true
+	cht.cursorID = visible[0].ID
+	cht.marked = make(map[string]bool)
+	cht.newMessageBox.Blur()
+	cht.publishSelection()
+	cht.populateViewport()
+}
+
+// Leaves selection mode, dropping any marks.
+func (cht *chatTab) endSelection() {
+	cht.selecting, cht.cursorID, cht.marked, cht.modal = false, "", nil, nil
+	broker.ClearStatusSegment(selectionSegment)
+	cht.newMessageBox.Focus()
+}
+
+// Handles input while selecting.
+func (cht *chatTab) updateSelection(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case keys.Matches(msg, keys.ChatSelect):
+		cht.endSelection()
+		cht.populateViewport()
+		return textarea.Blink
+	case keys.Matches(msg, keys.ChatSelectUp):
+		cht.moveCursor(1)
+	case keys.Matches(msg, keys.ChatSelectDown):
+		cht.moveCursor(-1)
+	case keys.Matches(msg, keys.ChatMark):
+		cht.toggleMark()
+	case keys.Matches(msg, keys.ChatDeleteMarked):
+		cht.confirmDelete()
+		return nil
+	default:
+		return nil
+	}
+	cht.publishSelection()
+	cht.populateViewport()
+	return nil
+}
+
+// Moves the cursor delta messages older (positive) or newer (negative).
+// If the message under the cursor is no longer displayed, the cursor returns to the newest message.
+func (cht *chatTab) moveCursor(delta int) {
+	visible := cht.visibleMessages()
+	if len(visible) == 0 {
+		return
+	}
+	i := slices.IndexFunc(visible, func(m *revoltgo.Message) bool { return m.ID == cht.cursorID })
+	if i < 0 {
+		cht.cursorID = visible[0].ID
+		return
+	}
+	i = max(0, min(len(visible)-1, i+delta))
+	cht.cursorID = visible[i].ID
+}
+
+// Marks or unmarks the message under the cursor.
+// Revolt cannot bulk-delete old messages, so they cannot be marked.
+func (cht *chatTab) toggleMark() {
+	i := slices.IndexFunc(cht.visibleMessages(), func(m *revoltgo.Message) bool { return m.ID == cht.cursorID })
+	if i < 0 {
+		return
+	}
+	if cht.marked[cht.cursorID] {
+		delete(cht.marked, cht.cursorID)
+		return
+	}
+	if time.Since(sentAt(cht.visibleMessages()[i])) > api.BulkDeleteMaxAge {
+		broker.PostError(errors.New("messages older than 7 days cannot be bulk-deleted"))
+		return
+	}
+	cht.marked[cht.cursorID] = true
+}
+
+// Publishes the number of marked messages to the status bar.
+func (cht *chatTab) publishSelection() {
+	broker.SetStatusSegment(selectionSegment, fmt.Sprintf("selecting: %d marked", len(cht.marked)))
+}
+
+// Returns the markers drawn before the given message while selecting.
+func (cht *chatTab) selectionPrefix(id string) string {
+	cursor, mark := "  ", "  "
+	if id == cht.cursorID {
+		cursor = selectionCursorSty.Render("> ")
+	}
+	if cht.marked[id] {
+		mark = selectionMarkSty.Render("✗ ")
+	}
+	return cursor + mark
+}
+
+// Asks the user to confirm deletion of the marked messages.
+func (cht *chatTab) confirmDelete() {
+	if len(cht.marked) == 0 {
+		broker.PostError(errors.New("no messages are marked; " +
+			keys.Get(keys.ChatMark).Help().Key + " marks the message under the cursor"))
+		return
+	}
+	var ids []string
+	for id := range cht.marked {
+		ids = append(ids, id)
+	}
+	chID := cht.channelID
+	cht.modal = newModal(fmt.Sprintf("Delete %s? This cannot be undone.", plural(len(ids), "message")),
+		func() (tea.Cmd, string) {
+			session := broker.Session()
+			return func() tea.Msg {
+				n, err := api.BulkDelete(session, chID, ids)
+				if err != nil {
+					log.Writer.Warn("failed to bulk-delete messages", "channel ID", chID, "error", err)
+				}
+				return bulkDeletedMsg{ids: ids[:n], requested: len(ids), err: err}
+			}, ""
+		})
+}
+
+// returned when an attempt to bulk-delete messages completes
+type bulkDeletedMsg struct {
+	ids       []string // those deleted
+	requested int
+	err       error
+}
+
+var _ tabMsg = bulkDeletedMsg{}
+
+func (bulkDeletedMsg) recipient() tabConst {
+	return CHAT
+}
+
+// Drops the deleted messages from the store and reports the result.
+func (cht *chatTab) onBulkDeleted(msg bulkDeletedMsg) {
+	cht.modal = nil
+	cht.msgs.messages = slices.DeleteFunc(cht.msgs.messages, func(m *revoltgo.Message) bool {
+		return m != nil && slices.Contains(msg.ids, m.ID)
+	})
+	for _, id := range msg.ids {
+		delete(cht.marked, id)
+	}
+	if msg.err != nil {
+		broker.PostError(fmt.Errorf("deleted %d of %d messages: %v", len(msg.ids), msg.requested, msg.err))
+		if cht.selecting {
+			cht.publishSelection()
+		}
+	} else {
+		broker.PostNotice("deleted " + plural(len(msg.ids), "message"))
+		cht.endSelection()
+	}
+	cht.populateViewport()
+}
+
+// Returns "<n> <noun>", pluralizing the noun as needed.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -6,18 +6,25 @@ package server
 
 /*
 Server mode is a tabbed implementation of the standard revolt server view.
+On wide terminals, the channels and chat tabs are drawn side by side (see layout.go), with focus
+cycled between the visible panes by server.nextPane and server.previousPane.
 Tabs:
 - Overview
 - Channels
 - Chat (empty if a channel has not been selected)
 - Settings
+- Roles
+- Members (moderation)
+- Invites
 
 
-NOTE: as tab is used as a primary navigation method, users cannot current insert tabs in chat messages.
+NOTE: as tab is the default navigation key, users cannot insert tabs in chat messages unless they
+rebind server.nextTab and server.previousTab (see the keys package).
 */
 
 import (
 	"revolt_tui/broker"
+	"revolt_tui/keys"
 	"revolt_tui/log"
 	"revolt_tui/modes"
 	"revolt_tui/stylesheet"
@@ -37,6 +44,12 @@ type Action struct {
 	activeTab tabConst
 	tabs      []tab
 	tabCount  uint8 // set on startup, as tab count (enabled & disabled) should not change
+
+	// layout
+	contentWidth, contentHeight int // space beneath the tabs
+	showMembers                 bool
+	memberFocus                 bool // the member pane has focus, rather than the active tab; see memberFocused
+	members                     memberPane
 }
 
 var _ modes.Action = &Action{}
@@ -48,6 +61,10 @@ func New() *Action {
 		&overviewTab{},
 		&chtb,
 		LinkedChatTab(&chtb),
+		&settingsTab{},
+		&rolesTab{},
+		&membersTab{},
+		&invitesTab{},
 	}
 	a.tabCount = uint8(len(a.tabs))
 	// check that we have an enumeration for each tab; this must be updated whenever a new tab enumeration is appended
@@ -77,50 +94,88 @@ func (a *Action) Enter() (success bool, init tea.Cmd) {
 
 	// determine the margins we need to reserve
 	var w, h int = broker.Width(), broker.Height() - (lipgloss.Height(a.drawTabs()) + 2)
+	a.contentWidth, a.contentHeight = w, h
 
 	// initialize each tab
-	for _, tb := range a.tabs {
-		tb.Init(a.server, w, h)
+	var cmds = []tea.Cmd{textinput.Blink}
+	for i, tb := range a.tabs {
+		tw, th := a.tabSize(tabConst(i), w, h)
+		cmds = append(cmds, tb.Init(a.server, tw, th))
 	}
 
 	// ensure we start on the always-enabled overview tab
 	a.activeTab = OVERVIEW
 
-	return true, textinput.Blink
+	a.members, a.memberFocus = memberPane{}, false
+	if a.showMembers {
+		cmds = append(cmds, loadMembers(a.server))
+	}
+
+	return true, tea.Batch(cmds...)
 }
 
 func (a *Action) Update(msg tea.Msg) tea.Cmd {
 	// consume tab cycle keys
 	if keyMsg, ok := msg.(tea.KeyMsg); ok {
-		switch keyMsg.Type {
-		case tea.KeyTab:
+		switch {
+		case keys.Matches(keyMsg, keys.ServerNextTab):
+			a.memberFocus = false
 			a.nextTab()
 			return textinput.Blink
-		case tea.KeyShiftTab:
+		case keys.Matches(keyMsg, keys.ServerPreviousTab):
+			a.memberFocus = false
 			a.previousTab()
 			return textinput.Blink
+		case keys.Matches(keyMsg, keys.ServerNextPane) && a.split():
+			a.cyclePane(1)
+			return textinput.Blink
+		case keys.Matches(keyMsg, keys.ServerPreviousPane) && a.split():
+			a.cyclePane(-1)
+			return textinput.Blink
+		case keys.Matches(keyMsg, keys.ServerMembers) && wide(broker.Width()):
+			a.showMembers = !a.showMembers
+			a.memberFocus = a.memberFocus && a.showMembers
+			cmd := a.resize(a.contentWidth, a.contentHeight)
+			if a.showMembers && !a.members.loaded {
+				cmd = tea.Batch(cmd, loadMembers(a.server))
+			}
+			return cmd
 		} // all other inputs are unhandled
+		if a.memberFocused() {
+			a.members.Update(keyMsg)
+			return nil
+		}
 	}
 
-	// window size messages must be passed to every tab, lest they lost if a tab is unfocused
-	if WSMsg, ok := msg.(tea.WindowSizeMsg); ok {
+	if ml, ok := msg.(membersLoadedMsg); ok {
+		if ml.serverID == a.server.ID {
+			a.members = memberPane{loaded: true, names: ml.names, err: ml.err}
+		}
+		return nil
+	}
+
+	// some messages are addressed to a specific tab, regardless of which is active
+	if tm, ok := msg.(tabMsg); ok {
+		cmd, _ := a.tabs[tm.recipient()].Update(msg)
+		return cmd
+	}
+
+	// window size, connection and store messages must be passed to every tab, lest they lost if a tab is unfocused
+	switch m := msg.(type) {
+	case tea.WindowSizeMsg:
 		// modify the height and width to fit within our content window beneath the tabs
-		WSMsg.Height -= (lipgloss.Height(a.drawTabs()) + 2) // TODO extract to save cycles
-
-		var (
-			cmd    tea.Cmd
-			newTab tabConst
-		)
-		for i, tb := range a.tabs {
-			// NOTE: results are thrown away for all but the active tab
-			c, t := tb.Update(WSMsg)
-			if i == int(a.activeTab) {
-				cmd = c
-				newTab = t
+		m.Height -= (lipgloss.Height(a.drawTabs()) + 2) // TODO extract to save cycles
+		return a.resize(m.Width, m.Height)
+	case broker.ConnectionStateMsg, broker.ConfigChangedMsg:
+		return a.broadcast(m)
+	case broker.StoreChangedMsg:
+		if m.Kind == broker.KindServer && m.ID == a.server.ID {
+			if s := broker.Server(a.server.ID); s != nil {
+				a.server = s
+				broker.SetCurrentServer(s)
 			}
 		}
-		a.activeTab = newTab
-		return cmd
+		return a.broadcast(m)
 	}
 
 	var cmd tea.Cmd
@@ -129,7 +184,49 @@ func (a *Action) Update(msg tea.Msg) tea.Cmd {
 	return cmd
 }
 
-var windowStyle = lipgloss.NewStyle().BorderForeground(colors.TabBorderForeground).Padding(2, 0).Align(lipgloss.Center).Border(lipgloss.NormalBorder()).UnsetBorderTop()
+// Passes the given message to every tab.
+// Tab changes are respected only from the active tab.
+func (a *Action) broadcast(msg tea.Msg) tea.Cmd {
+	var (
+		cmds   []tea.Cmd
+		newTab tabConst = a.activeTab
+	)
+	for i, tb := range a.tabs {
+		c, t := tb.Update(msg)
+		cmds = append(cmds, c)
+		if i == int(a.activeTab) {
+			newTab = t
+		}
+	}
+	a.activeTab = newTab
+	return tea.Batch(cmds...)
+}
+
+// The server scope is always active; the focused member pane or the active tab may contribute its own.
+// While a tab displays a modal, the modal's (settings) bindings replace the tab's.
+func (a *Action) KeyScopes() []keys.Scope {
+	if a.memberFocused() {
+		return []keys.Scope{keys.Server, keys.MemberList}
+	}
+	if mh, ok := a.tabs[a.activeTab].(modalHolder); ok && mh.modalOpen() {
+		return []keys.Scope{keys.Server, keys.Settings}
+	}
+	switch a.activeTab {
+	case CHANNELS:
+		return []keys.Scope{keys.Server, keys.Channels}
+	case CHAT:
+		return []keys.Scope{keys.Server, keys.Chat}
+	case SETTINGS, ROLES:
+		return []keys.Scope{keys.Server, keys.Settings}
+	case MEMBERS:
+		return []keys.Scope{keys.Server, keys.Members}
+	case INVITES:
+		return []keys.Scope{keys.Server, keys.Invites}
+	}
+	return []keys.Scope{keys.Server}
+}
+
+var windowStyle lipgloss.Style
 
 // Displays the current server, collapsing the channel column automatically if a channel has been
 // selected and the terminal is not wide enough.
@@ -137,6 +234,10 @@ func (a *Action) View() string {
 	var sb strings.Builder
 	tabs := a.drawTabs()
 	sb.WriteString(tabs + "\n")
+	if a.split() {
+		sb.WriteString(a.viewSplit())
+		return sb.String()
+	}
 	// box the entire display
 	content := a.tabs[a.activeTab].View()
 	sb.WriteString(content)
@@ -144,9 +245,17 @@ func (a *Action) View() string {
 }
 
 var (
-	inactiveTabStyle   = lipgloss.NewStyle().Border(stylesheet.TabBorders.Inactive, true).BorderForeground(colors.TabBorderForeground).Padding(0, 1)
-	activeTabStyle     = inactiveTabStyle.Border(stylesheet.TabBorders.Active, true)
+	inactiveTabStyle, activeTabStyle lipgloss.Style
+
 	activeTabTextStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#F00"))
 )
 
+func init() {
+	colors.OnChange(func() {
+		windowStyle = lipgloss.NewStyle().BorderForeground(colors.TabBorderForeground).Padding(2, 0).Align(lipgloss.Center).Border(lipgloss.NormalBorder()).UnsetBorderTop()
+		inactiveTabStyle = lipgloss.NewStyle().Border(stylesheet.TabBorders.Inactive, true).BorderForeground(colors.TabBorderForeground).Padding(0, 1)
+		activeTabStyle = inactiveTabStyle.Border(stylesheet.TabBorders.Active, true)
+	})
+}
+
 //#endregion
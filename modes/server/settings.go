@@ -0,0 +1,370 @@
+package server
+
+import (
+	"fmt"
+	"revolt_tui/broker"
+	"revolt_tui/keys"
+	"revolt_tui/log"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sentinelb51/revoltgo"
+)
+
+/**
+ * This file handles the settings tab, where owners and admins edit the server.
+ * The tab is only enabled for users holding the Manage Server permission; default permissions are
+ * only editable by those who also hold Manage Permissions.
+ * Edits are validated and confirmed before being sent; the resulting ServerUpdate event refreshes
+ * the form via the broker's store.
+ */
+
+const (
+	serverNameMaxLength        = 32
+	serverDescriptionMaxLength = 1024
+	categoryGroup              = "categories"
+)
+
+type settingsTab struct {
+	server *revoltgo.Server
+	height int
+
+	form        form
+	name        *textRow
+	description *textRow
+	system      [4]*textRow // joined, left, kicked, banned
+	permissions []*toggleRow
+	categoryIDs []string // initial category order
+
+	confirming bool
+	saving     bool
+	status     statusLine
+}
+
+var _ tab = &settingsTab{}
+
+func (*settingsTab) Name() string {
+	return "settings"
+}
+
+func (st *settingsTab) Enabled() bool {
+	return st.server != nil && broker.HasServerPermission(st.server.ID, broker.PermManageServer)
+}
+
+func (st *settingsTab) Init(s *revoltgo.Server, _, height int) tea.Cmd {
+	st.server = s
+	st.height = height
+	st.confirming, st.saving = false, false
+	st.status.set("", false)
+	st.reset()
+	return nil
+}
+
+// (Re)builds the form from the current server.
+func (st *settingsTab) reset() {
+	s := st.server
+	st.name = newTextRow("Name", s.Name, serverNameMaxLength, func(v string) string {
+		if v == "" {
+			return "a name is required"
+		}
+		return ""
+	})
+	st.description = newTextRow("Description", s.Description, serverDescriptionMaxLength, func(v string) string {
+		if utf8.RuneCountInString(v) > serverDescriptionMaxLength {
+			return fmt.Sprintf("at most %d characters", serverDescriptionMaxLength)
+		}
+		return ""
+	})
+	sm := s.SystemMessages
+	for i, f := range []struct{ label, id string }{
+		{"User joined", sm.UserJoined}, {"User left", sm.UserLeft},
+		{"User kicked", sm.UserKicked}, {"User banned", sm.UserBanned},
+	} {
+		var current string
+		if ch := broker.Channel(f.id); ch != nil {
+			current = "#" + ch.Name
+		}
+		st.system[i] = newTextRow(f.label, current, 64, func(v string) string {
+			_, err := resolveChannel(st.server, v, true)
+			return err
+		})
+	}
+
+	rows := []formRow{
+		newSection("General"), st.name, st.description,
+		newSection("System message channels (blank to disable)"),
+		st.system[0], st.system[1], st.system[2], st.system[3],
+		newSection("Categories (" + keys.Get(keys.SettingsMoveUp).Help().Key + "/" +
+			keys.Get(keys.SettingsMoveDown).Help().Key + " to reorder)"),
+	}
+	st.categoryIDs = nil
+	for _, cat := range s.Categories {
+		if cat != nil {
+			st.categoryIDs = append(st.categoryIDs, cat.ID)
+			rows = append(rows, &orderRow{group: categoryGroup, id: cat.ID, text: cat.Title})
+		}
+	}
+
+	st.permissions = nil
+	if broker.HasServerPermission(s.ID, broker.PermManagePermissions) {
+		rows = append(rows, newSection("Default permissions"))
+		var defaults broker.Permission
+		if s.DefaultPermissions != nil {
+			defaults = *s.DefaultPermissions
+		}
+		for _, p := range broker.PermissionNames {
+			r := newToggleRow(p.Name, defaults&p.Bit != 0)
+			st.permissions = append(st.permissions, r)
+			rows = append(rows, r)
+		}
+	}
+
+	st.form = form{rows: rows}
+	st.form.setCursor(1)
+}
+
+func (st *settingsTab) Update(msg tea.Msg) (tea.Cmd, tabConst) {
+	switch m := msg.(type) {
+	case tea.WindowSizeMsg:
+		st.height = m.Height
+		return nil, SETTINGS
+	case broker.StoreChangedMsg:
+		if st.server == nil || m.Kind != broker.KindServer || m.ID != st.server.ID {
+			return nil, SETTINGS
+		}
+		if s := broker.Server(st.server.ID); s != nil {
+			st.server = s
+			if !st.dirty() {
+				st.reset()
+			} else {
+				st.status.set("server was changed elsewhere; "+
+					keys.Get(keys.SettingsReset).Help().Key+" to discard your changes and reload", true)
+			}
+		}
+		return nil, SETTINGS
+	case settingsSavedMsg:
+		st.saving = false
+		if m.err != nil {
+			st.status.set("failed to save: "+m.err.Error(), true)
+			return nil, SETTINGS
+		}
+		st.status.set("saved", false)
+		if s := broker.Server(st.server.ID); s != nil {
+			st.server = s
+		}
+		st.reset()
+		return nil, SETTINGS
+	case tea.KeyMsg:
+		if st.saving {
+			return nil, SETTINGS
+		}
+		if st.confirming {
+			switch {
+			case keys.Matches(m, keys.SettingsConfirm):
+				st.confirming, st.saving = false, true
+				st.status.set("saving...", false)
+				return st.save(), SETTINGS
+			case keys.Matches(m, keys.SettingsCancel, keys.SettingsBack):
+				st.confirming = false
+				st.status.set("", false)
+			}
+			return nil, SETTINGS
+		}
+		switch {
+		case keys.Matches(m, keys.SettingsSave):
+			st.requestSave()
+			return nil, SETTINGS
+		case keys.Matches(m, keys.SettingsReset):
+			st.reset()
+			st.status.set("changes discarded", false)
+			return nil, SETTINGS
+		case keys.Matches(m, keys.SettingsMoveUp):
+			st.form.swap(-1)
+			return nil, SETTINGS
+		case keys.Matches(m, keys.SettingsMoveDown):
+			st.form.swap(1)
+			return nil, SETTINGS
+		}
+		return st.form.Update(m), SETTINGS
+	}
+	return nil, SETTINGS
+}
+
+func (st *settingsTab) View() string {
+	return st.form.View(st.height-2) + "\n" + st.status.view(keys.Get(keys.SettingsSave).Help().Key+" to save")
+}
+
+//#region saving
+
+// returned when an attempt to save the settings completes
+type settingsSavedMsg struct {
+	err error
+}
+
+var _ tabMsg = settingsSavedMsg{}
+
+func (settingsSavedMsg) recipient() tabConst {
+	return SETTINGS
+}
+
+// Have any fields been changed?
+func (st *settingsTab) dirty() bool {
+	return len(st.changes()) > 0
+}
+
+// Returns user-facing names of the changed settings.
+func (st *settingsTab) changes() []string {
+	var changed []string
+	if st.name.changed() {
+		changed = append(changed, "name")
+	}
+	if st.description.changed() {
+		changed = append(changed, "description")
+	}
+	for _, r := range st.system {
+		if r.changed() {
+			changed = append(changed, "system channels")
+			break
+		}
+	}
+	if !slices.Equal(st.categoryOrder(), st.categoryIDs) {
+		changed = append(changed, "category order")
+	}
+	for _, r := range st.permissions {
+		if r.on != r.initial {
+			changed = append(changed, "default permissions")
+			break
+		}
+	}
+	return changed
+}
+
+// Validates the form and, if it is valid and changed, asks the user to confirm the save.
+func (st *settingsTab) requestSave() {
+	valid := st.name.check()
+	valid = st.description.check() && valid
+	for _, r := range st.system {
+		valid = r.check() && valid
+	}
+	if !valid {
+		st.status.set("please correct the highlighted fields", true)
+		return
+	}
+	changed := st.changes()
+	if len(changed) == 0 {
+		st.status.set("nothing to save", false)
+		return
+	}
+	st.confirming = true
+	st.status.ask("Save changes to " + strings.Join(changed, ", ") + "?")
+}
+
+// Returns a command that sends the changed settings to Revolt.
+func (st *settingsTab) save() tea.Cmd {
+	serverID := st.server.ID
+	var (
+		edit     revoltgo.ServerEditData
+		editing  bool
+		defaults *broker.Permission
+	)
+	if st.name.changed() {
+		edit.Name, editing = st.name.value(), true
+	}
+	if st.description.changed() {
+		editing = true
+		if edit.Description = st.description.value(); edit.Description == "" {
+			edit.Remove = append(edit.Remove, revoltgo.ServerEditDataRemoveDescription)
+		}
+	}
+	if st.system[0].changed() || st.system[1].changed() || st.system[2].changed() || st.system[3].changed() {
+		var ids [4]string
+		for i, r := range st.system {
+			ids[i], _ = resolveChannel(st.server, r.value(), true)
+		}
+		edit.SystemMessages = &revoltgo.ServerSystemMessages{
+			UserJoined: ids[0], UserLeft: ids[1], UserKicked: ids[2], UserBanned: ids[3]}
+		editing = true
+	}
+	if order := st.categoryOrder(); !slices.Equal(order, st.categoryIDs) {
+		byID := make(map[string]*revoltgo.ServerCategory)
+		for _, cat := range st.server.Categories {
+			if cat != nil {
+				byID[cat.ID] = cat
+			}
+		}
+		for _, id := range order {
+			edit.Categories = append(edit.Categories, byID[id])
+		}
+		editing = true
+	}
+	// only toggled permissions are changed, so bits this client does not list are kept
+	var p broker.Permission
+	if st.server.DefaultPermissions != nil {
+		p = *st.server.DefaultPermissions
+	}
+	for i, r := range st.permissions {
+		if r.on == r.initial {
+			continue
+		}
+		if r.on {
+			p |= broker.PermissionNames[i].Bit
+		} else {
+			p &^= broker.PermissionNames[i].Bit
+		}
+		defaults = &p
+	}
+
+	session := broker.Session()
+	return func() tea.Msg {
+		if editing {
+			if _, err := session.ServerEdit(serverID, edit); err != nil {
+				log.Writer.Warn("failed to edit server", "server ID", serverID, "error", err)
+				return settingsSavedMsg{err: err}
+			}
+		}
+		if defaults != nil {
+			err := session.PermissionsSetDefault(serverID,
+				revoltgo.PermissionsSetDefaultData{Permissions: *defaults})
+			if err != nil {
+				log.Writer.Warn("failed to set default permissions", "server ID", serverID, "error", err)
+				return settingsSavedMsg{err: err}
+			}
+		}
+		return settingsSavedMsg{}
+	}
+}
+
+// Returns the category IDs in their current order in the form.
+func (st *settingsTab) categoryOrder() []string {
+	var ids []string
+	for _, r := range st.form.rows {
+		if or, ok := r.(*orderRow); ok && or.group == categoryGroup {
+			ids = append(ids, or.id)
+		}
+	}
+	return ids
+}
+
+//#endregion saving
+
+// Resolves a channel reference ("#name", "name", or an ID) to a channel of the given server.
+// An empty value resolves to no channel.
+func resolveChannel(s *revoltgo.Server, v string, textOnly bool) (id string, errDesc string) {
+	if v == "" {
+		return "", ""
+	}
+	name := strings.TrimPrefix(v, "#")
+	for _, chID := range s.Channels {
+		ch := broker.Channel(chID)
+		if ch == nil || (ch.ID != v && ch.Name != name) {
+			continue
+		}
+		if textOnly && ch.ChannelType != revoltgo.ChannelTypeText {
+			return "", "#" + ch.Name + " is not a text channel"
+		}
+		return ch.ID, ""
+	}
+	return "", "no channel named " + v
+}
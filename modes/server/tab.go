@@ -16,9 +16,13 @@ const (
 	OVERVIEW tabConst = iota
 	CHANNELS
 	CHAT
+	SETTINGS
+	ROLES
+	MEMBERS
+	INVITES
 )
 
-const lastTabConst = CHAT // used by new to validate tab struct count
+const lastTabConst = INVITES // used by new to validate tab struct count
 
 // represents a single tab
 type tab interface {
@@ -26,11 +30,18 @@ type tab interface {
 	Enabled() bool // is this tab currently accessible?
 	// called on every tab when *server* is first entered, NOT when the tab is swapped to
 	// provides the server so each enter does not have to nil check broker
-	Init(server *revoltgo.Server, width, height int)
+	// must not block; slow work (ex: fetching missing data) should be returned as a command
+	Init(server *revoltgo.Server, width, height int) tea.Cmd
 	Update(msg tea.Msg) (tea.Cmd, tabConst)
 	View() string
 }
 
+// A message addressed to a specific tab.
+// The server routes these to their recipient, whether or not it is the active tab.
+type tabMsg interface {
+	recipient() tabConst
+}
+
 // activate the next, enabled tab in index order
 func (a *Action) nextTab() {
 	// cycle through tabs until we find an enabled one
@@ -0,0 +1,48 @@
+package serverselection
+
+import (
+	"strings"
+
+	"revolt_tui/keys"
+	"revolt_tui/serverlist"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+/**
+ * This file handles the prompt for moving a server into a folder.
+ */
+
+// lines reserved beneath the list for the folder prompt
+const promptHeight int = 1
+
+// Opens the folder prompt for the given server, prefilled with its current folder.
+func (a *Action) openPrompt(itm serverItem) tea.Cmd {
+	a.prompt = textinput.New()
+	a.prompt.Prompt = "Folder for " + itm.title + " (empty to remove): "
+	a.prompt.SetValue(itm.folder)
+	a.prompting = true
+	return a.prompt.Focus()
+}
+
+// Handles input while the folder prompt is open.
+// Confirming files the selected server into the typed folder; cancelling closes the prompt.
+func (a *Action) updatePrompt(msg tea.Msg) tea.Cmd {
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch {
+		case keys.Matches(keyMsg, keys.PromptCancel):
+			a.prompting = false
+			return nil
+		case keys.Matches(keyMsg, keys.PromptConfirm):
+			a.prompting = false
+			if itm, ok := a.list.SelectedItem().(serverItem); ok {
+				serverlist.SetFolder(itm.id, strings.TrimSpace(a.prompt.Value()), a.topLevel())
+			}
+			return a.refresh()
+		}
+	}
+	var cmd tea.Cmd
+	a.prompt, cmd = a.prompt.Update(msg)
+	return cmd
+}
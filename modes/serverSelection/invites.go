@@ -0,0 +1,200 @@
+package serverselection
+
+import (
+	"fmt"
+	"revolt_tui/api"
+	"revolt_tui/broker"
+	"revolt_tui/keys"
+	"revolt_tui/log"
+	"revolt_tui/modes"
+	"revolt_tui/stylesheet/colors"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sentinelb51/revoltgo"
+)
+
+/**
+ * This file handles joining a server by invite.
+ * The user enters an invite code or link beneath the list; the invite is then previewed in place of
+ * the list and joined on confirmation, opening the joined server.
+ */
+
+var inviteFieldSty, inviteErrSty lipgloss.Style
+
+func init() {
+	colors.OnChange(func() {
+		inviteFieldSty = lipgloss.NewStyle().Foreground(colors.LeftField)
+		inviteErrSty = lipgloss.NewStyle().Foreground(colors.Error)
+	})
+}
+
+type inviteFlow struct {
+	active  bool
+	input   textinput.Model
+	code    string
+	preview *revoltgo.Invite // set once the entered invite has been fetched
+	busy    bool
+	err     string
+}
+
+// returned when an invite preview has been fetched
+type invitePreviewMsg struct {
+	code    string
+	preview *revoltgo.Invite
+	err     error
+}
+
+// returned when an attempt to join a server completes
+type inviteJoinedMsg struct {
+	server *revoltgo.Server
+	err    error
+}
+
+// Opens the invite prompt.
+func (a *Action) openInvite() tea.Cmd {
+	a.invite = inviteFlow{active: true, input: textinput.New()}
+	a.invite.input.Prompt = "Invite code or link: "
+	return a.invite.input.Focus()
+}
+
+// Handles input and results while the invite flow is open.
+// Confirming previews the typed invite, then joins it; cancelling backs out of the preview, then the prompt.
+func (a *Action) updateInvite(msg tea.Msg) tea.Cmd {
+	inv := &a.invite
+	switch m := msg.(type) {
+	case invitePreviewMsg:
+		if m.code != inv.code {
+			return nil
+		}
+		inv.busy = false
+		if m.err != nil {
+			inv.err = "could not find invite " + m.code + ": " + m.err.Error()
+			return inv.input.Focus()
+		}
+		inv.preview = m.preview
+		return nil
+	case inviteJoinedMsg:
+		inv.busy = false
+		if m.err != nil {
+			inv.err = "failed to join: " + m.err.Error()
+			return nil
+		}
+		a.invite = inviteFlow{}
+		if m.server == nil {
+			return a.refresh()
+		}
+		broker.PostNotice("joined " + m.server.Name)
+		broker.SetCurrentServer(m.server)
+		a.newMode = modes.Server
+		return nil
+	case tea.KeyMsg:
+		if inv.busy {
+			return nil
+		}
+		inv.err = ""
+		switch {
+		case keys.Matches(m, keys.PromptCancel):
+			if inv.preview != nil {
+				inv.preview, inv.err = nil, ""
+				return inv.input.Focus()
+			}
+			a.invite = inviteFlow{}
+			return nil
+		case keys.Matches(m, keys.PromptConfirm):
+			if inv.preview != nil {
+				return a.join(inv.preview)
+			}
+			inv.code = api.InviteCode(inv.input.Value())
+			if inv.code == "" {
+				return nil
+			}
+			inv.busy = true
+			inv.input.Blur()
+			return previewInvite(inv.code)
+		}
+	}
+	if inv.preview != nil {
+		return nil
+	}
+	var cmd tea.Cmd
+	inv.input, cmd = inv.input.Update(msg)
+	return cmd
+}
+
+// Joins the previewed server, or opens it if the user is already a member.
+func (a *Action) join(preview *revoltgo.Invite) tea.Cmd {
+	if s := broker.Server(preview.ServerID); s != nil {
+		a.invite = inviteFlow{}
+		broker.SetCurrentServer(s)
+		a.newMode = modes.Server
+		return nil
+	}
+	a.invite.busy = true
+	code, session := a.invite.code, broker.Session()
+	return func() tea.Msg {
+		joined, err := api.JoinInvite(session, code)
+		if err != nil {
+			log.Writer.Warn("failed to join server", "invite", code, "error", err)
+			return inviteJoinedMsg{err: err}
+		}
+		return inviteJoinedMsg{server: joined.Server}
+	}
+}
+
+func previewInvite(code string) tea.Cmd {
+	session := broker.Session()
+	return func() tea.Msg {
+		preview, err := session.Invite(code)
+		if err != nil {
+			log.Writer.Debug("failed to fetch invite", "invite", code, "error", err)
+		} else if preview.Type != revoltgo.InviteTypeServer {
+			preview, err = nil, fmt.Errorf("only server invites can be joined")
+		}
+		return invitePreviewMsg{code: code, preview: preview, err: err}
+	}
+}
+
+// Draws the preview of the entered invite.
+func (inv *inviteFlow) viewPreview() string {
+	p := inv.preview
+	var sb strings.Builder
+	field := func(name, value string) {
+		if value != "" {
+			sb.WriteString(inviteFieldSty.Render(name+": ") + value + "\n")
+		}
+	}
+	sb.WriteString("Invite " + inv.code + "\n\n")
+	field("Server", p.ServerName)
+	field("Members", fmt.Sprint(p.MemberCount))
+	if p.ChannelName != "" {
+		field("Channel", "#"+p.ChannelName)
+	}
+	field("Invited by", p.UserName)
+	sb.WriteString("\n")
+	confirm, cancel := keys.Get(keys.PromptConfirm).Help().Key, keys.Get(keys.PromptCancel).Help().Key
+	if inv.busy {
+		sb.WriteString("joining...")
+	} else if broker.Server(p.ServerID) != nil {
+		sb.WriteString("You are already a member. " + confirm + " to open it, " + cancel + " to go back.")
+	} else {
+		sb.WriteString(confirm + " to join, " + cancel + " to go back.")
+	}
+	if inv.err != "" {
+		sb.WriteString("\n" + inviteErrSty.Render(inv.err))
+	}
+	return sb.String()
+}
+
+// Draws the invite prompt line.
+func (inv *inviteFlow) viewPrompt() string {
+	switch {
+	case inv.err != "":
+		return inviteErrSty.Render(inv.err)
+	case inv.busy:
+		return "looking up invite " + inv.code + "..."
+	}
+	return inv.input.View()
+}
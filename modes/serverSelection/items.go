@@ -0,0 +1,171 @@
+package serverselection
+
+import (
+	"fmt"
+	"revolt_tui/broker"
+	"revolt_tui/serverlist"
+	"revolt_tui/stylesheet/colors"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sentinelb51/revoltgo"
+)
+
+/**
+ * This file generates the items of the server list from the broker and the user's arrangement.
+ */
+
+var initialsSty, unreadSty, mentionSty lipgloss.Style
+
+func init() {
+	colors.OnChange(func() {
+		initialsSty = lipgloss.NewStyle().Bold(true).Foreground(colors.StatusBarForeground).
+			Background(colors.StatusBarBackground).Width(4).Align(lipgloss.Center)
+		unreadSty = lipgloss.NewStyle().Foreground(colors.Warning)
+		mentionSty = lipgloss.NewStyle().Bold(true).Foreground(colors.Error)
+	})
+}
+
+// Generates the list items for every server, arranged per the user's order and folders.
+func items() []list.Item {
+	servers := broker.Servers()
+	byID := make(map[string]*revoltgo.Server, len(servers))
+	ids := make([]string, len(servers))
+	for i, s := range servers {
+		byID[s.ID] = s
+		ids[i] = s.ID
+	}
+
+	var itms []list.Item
+	for _, e := range serverlist.Arrange(ids) {
+		if e.Folder == nil {
+			itms = append(itms, newServerItem(byID[e.ServerID], ""))
+			continue
+		}
+		fi := folderItem{name: e.Folder.Name, collapsed: e.Folder.Collapsed, count: len(e.Folder.Servers)}
+		var children []list.Item
+		for _, id := range e.Folder.Servers {
+			si := newServerItem(byID[id], e.Folder.Name)
+			fi.unread += si.unread
+			fi.mentions += si.mentions
+			children = append(children, si)
+		}
+		itms = append(itms, fi)
+		if !fi.collapsed {
+			itms = append(itms, children...)
+		}
+	}
+
+	return itms
+}
+
+func newServerItem(s *revoltgo.Server, folder string) serverItem {
+	unread, mentions := broker.ServerUnread(s.ID)
+	return serverItem{
+		title:       s.Name,
+		description: s.Description,
+		id:          s.ID,
+		folder:      folder,
+		unread:      unread,
+		mentions:    mentions,
+	}
+}
+
+// Returns a stable identifier for the item, used to restore the cursor after a refresh.
+func key(itm list.Item) string {
+	switch i := itm.(type) {
+	case serverItem:
+		return i.id
+	case folderItem:
+		return "folder:" + i.name
+	}
+	return ""
+}
+
+// Returns up to two initials of the given name, standing in for the server's icon.
+func initials(name string) string {
+	var r []rune
+	for _, word := range strings.Fields(name) {
+		for _, c := range word {
+			if unicode.IsLetter(c) || unicode.IsDigit(c) {
+				r = append(r, unicode.ToUpper(c))
+				break
+			}
+		}
+		if len(r) == 2 {
+			break
+		}
+	}
+	if len(r) == 0 {
+		return "?"
+	}
+	return string(r)
+}
+
+// Returns the unread/mention badge for the given counts, if any.
+func badge(unread, mentions int) string {
+	switch {
+	case mentions > 0:
+		return " " + mentionSty.Render(fmt.Sprintf("@%d", mentions))
+	case unread > 0:
+		return " " + unreadSty.Render(fmt.Sprintf("•%d", unread))
+	}
+	return ""
+}
+
+//#region list item definitions
+
+type serverItem struct {
+	title       string
+	description string
+	id          string // server item for lookup upon selection
+	folder      string // name of the containing folder, if any
+	unread      int
+	mentions    int
+}
+
+func (li serverItem) Title() string {
+	var indent string
+	if li.folder != "" {
+		indent = "  "
+	}
+	return indent + initialsSty.Render(initials(li.title)) + " " + li.title + badge(li.unread, li.mentions)
+}
+func (li serverItem) Description() string {
+	if li.folder != "" {
+		return "  " + li.description
+	}
+	return li.description
+}
+func (li serverItem) FilterValue() string {
+	return li.title + li.description
+}
+
+type folderItem struct {
+	name      string
+	collapsed bool
+	count     int // number of servers in the folder
+	unread    int
+	mentions  int
+}
+
+func (fi folderItem) Title() string {
+	arrow := "▾ "
+	if fi.collapsed {
+		arrow = "▸ "
+	}
+	return arrow + fi.name + badge(fi.unread, fi.mentions)
+}
+func (fi folderItem) Description() string {
+	if fi.count == 1 {
+		return "1 server"
+	}
+	return fmt.Sprintf("%d servers", fi.count)
+}
+func (fi folderItem) FilterValue() string {
+	return fi.name
+}
+
+//#endregion list item definitions
@@ -2,12 +2,14 @@ package serverselection
 
 import (
 	"revolt_tui/broker"
+	"revolt_tui/keys"
 	"revolt_tui/log"
 	"revolt_tui/modes"
+	"revolt_tui/serverlist"
 
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/sentinelb51/revoltgo"
 )
 
 type Action struct {
@@ -15,6 +17,12 @@ type Action struct {
 	initialized  bool
 	selectionErr bool // an error occurred on last input
 	newMode      modes.Mode
+
+	// folder prompt
+	prompting bool
+	prompt    textinput.Model
+
+	invite inviteFlow
 }
 
 // Is this mode ready to change? If so, to what mode?
@@ -37,11 +45,7 @@ func (a *Action) Enter() (bool, tea.Cmd) {
 		a.list.SetHeight(broker.Height())
 
 		// regenerate servers list as []list.Item
-		// the server list should never become nil after being initialized, but you never know
-		if servers := broker.Servers(); servers != nil {
-			cmd = a.list.SetItems(castServersToItems(servers))
-		} // else, do nothing
-
+		cmd = a.refresh()
 	} else if !a.tryInitialize() {
 		log.Writer.Debug("not yet able to initialize")
 	}
@@ -55,26 +59,43 @@ func (a *Action) Update(msg tea.Msg) tea.Cmd {
 		}
 	}
 
-	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+	// refresh in place as servers change and messages arrive
+	switch m := msg.(type) {
+	case broker.CacheUpdatedMsg, broker.StatusChangedMsg, broker.ConfigChangedMsg:
+		return a.refresh()
+	case broker.StoreChangedMsg:
+		if m.Kind == broker.KindServer || m.Kind == broker.KindChannel {
+			return a.refresh()
+		}
+		return nil
+	case tea.WindowSizeMsg:
+		a.list.SetSize(m.Width, m.Height-promptHeight)
+		return nil
+	}
+
+	if a.prompting {
+		return a.updatePrompt(msg)
+	}
+	if a.invite.active {
+		return a.updateInvite(msg)
+	}
+
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && a.list.FilterState() != list.Filtering {
 		a.selectionErr = false
-		if keyMsg.Type == tea.KeyEnter { // check for enter key
-			// fetch the chosen server
-			if serverItm, ok := a.list.SelectedItem().(serverItem); ok {
-				server, err := broker.Session.Server(serverItm.id)
-				if err != nil {
-					log.Writer.Error("failed to fetch server", "error", err, "id", serverItm.id)
-					a.selectionErr = true
-					return nil
-				}
-				// pass the server to the app data broker
-				broker.SetCurrentServer(server)
-				// allow the server mode to take over
-				a.newMode = modes.Server
-			} else {
-				log.Writer.Warn("failed to cast item to server item", "item", a.list.SelectedItem())
-				a.selectionErr = true
-				return nil
+		switch {
+		case keys.Matches(keyMsg, keys.ServerSelectionSelect):
+			return a.selectItem()
+		case keys.Matches(keyMsg, keys.ServerSelectionUp):
+			return a.move(-1)
+		case keys.Matches(keyMsg, keys.ServerSelectionDown):
+			return a.move(1)
+		case keys.Matches(keyMsg, keys.ServerSelectionFolder):
+			if itm, ok := a.list.SelectedItem().(serverItem); ok {
+				return a.openPrompt(itm)
 			}
+			return nil
+		case keys.Matches(keyMsg, keys.ServerSelectionJoin):
+			return a.openInvite()
 		}
 	}
 
@@ -87,8 +108,17 @@ func (a *Action) View() string {
 	if !a.initialized {
 		return "Initializing..."
 	}
+	if a.invite.active && a.invite.preview != nil {
+		return a.invite.viewPreview()
+	}
 	l := a.list.View()
 
+	if a.prompting {
+		l += "\n" + a.prompt.View()
+	} else if a.invite.active {
+		l += "\n" + a.invite.viewPrompt()
+	}
+
 	// append error text, if an error had occurred
 	if a.selectionErr {
 		l += "\n An error has occurred, please try a different server."
@@ -97,20 +127,66 @@ func (a *Action) View() string {
 	return l
 }
 
-//#region helper functions
+// While the folder prompt or invite flow is open, the prompt's bindings replace the list's.
+func (a *Action) KeyScopes() []keys.Scope {
+	if a.prompting || a.invite.active {
+		return []keys.Scope{keys.Prompt}
+	}
+	return []keys.Scope{keys.ServerSelection}
+}
 
-func castServersToItems(servers []*revoltgo.Server) []list.Item {
-	var itms []list.Item = make([]list.Item, len(servers))
+//#region helper functions
 
-	for i, server := range servers {
-		itms[i] = serverItem{
-			title:       server.Name,
-			description: server.Description,
-			id:          server.ID,
+// Opens the selected server or toggles the selected folder.
+func (a *Action) selectItem() tea.Cmd {
+	switch itm := a.list.SelectedItem().(type) {
+	case folderItem:
+		serverlist.ToggleFolder(itm.name)
+		return a.refresh()
+	case serverItem:
+		// prefer the (live) store, falling back to the API
+		server := broker.Server(itm.id)
+		if server == nil {
+			var err error
+			if server, err = broker.Session().Server(itm.id); err != nil {
+				log.Writer.Error("failed to fetch server", "error", err, "id", itm.id)
+				a.selectionErr = true
+				return nil
+			}
 		}
+		// pass the server to the app data broker
+		broker.SetCurrentServer(server)
+		// allow the server mode to take over
+		a.newMode = modes.Server
+	default:
+		log.Writer.Warn("failed to cast item to server item", "item", a.list.SelectedItem())
+		a.selectionErr = true
+	}
+	return nil
+}
+
+// Moves the selected server or folder by delta positions, keeping it selected.
+func (a *Action) move(delta int) tea.Cmd {
+	switch itm := a.list.SelectedItem().(type) {
+	case folderItem:
+		serverlist.MoveFolder(itm.name, delta, a.topLevel())
+	case serverItem:
+		serverlist.Move(itm.id, delta, a.topLevel())
+	default:
+		return nil
 	}
+	return a.refresh()
+}
 
-	return itms
+// Returns the IDs of the listed servers that are not in a folder, in display order.
+func (a *Action) topLevel() []string {
+	var ids []string
+	for _, itm := range a.list.Items() {
+		if si, ok := itm.(serverItem); ok && si.folder == "" {
+			ids = append(ids, si.id)
+		}
+	}
+	return ids
 }
 
 func (a *Action) tryInitialize() bool {
@@ -121,30 +197,33 @@ func (a *Action) tryInitialize() bool {
 	log.Writer.Debug("initializing server selection...")
 
 	// if we have not been initialized, attempt to initialize
-	a.list = list.New(castServersToItems(broker.Servers()), list.NewDefaultDelegate(), w, h)
+	a.list = list.New(items(), list.NewDefaultDelegate(), w, h-promptHeight)
+	a.list.Title = "Servers"
 	a.initialized = true
 
 	return true
 }
 
-//#endregion
-
-//#region list item definition
+// Rebuilds the list items from the broker, preserving the cursor and filter.
+func (a *Action) refresh() tea.Cmd {
+	var selected string
+	if itm := a.list.SelectedItem(); itm != nil {
+		selected = key(itm)
+	}
 
-type serverItem struct {
-	title       string
-	description string
-	id          string // server item for lookup upon selection
-}
+	// SetItems re-applies any active filter
+	cmd := a.list.SetItems(items())
 
-func (li serverItem) Title() string {
-	return li.title
-}
-func (li serverItem) Description() string {
-	return li.description
-}
-func (li serverItem) FilterValue() string {
-	return li.title + li.description
+	// the cursor indexes the visible items, which are not re-filtered until cmd resolves
+	if a.list.FilterState() == list.Unfiltered {
+		for i, itm := range a.list.Items() {
+			if key(itm) == selected {
+				a.list.Select(i)
+				break
+			}
+		}
+	}
+	return cmd
 }
 
 //#endregion
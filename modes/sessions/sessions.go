@@ -0,0 +1,219 @@
+/*
+This package represents the sessions mode, which lists every active session of the current account
+(one per login, across all clients) and revokes those the user no longer recognizes.
+The session this client is logged in as cannot be revoked here; log out from account selection
+instead. If this client's session is unknown (ex: the token was adopted from an earlier version), any
+session may be it, so only every other session may be revoked (which Revolt knows to spare it).
+*/
+package sessions
+
+import (
+	"errors"
+	"revolt_tui/accounts"
+	"revolt_tui/api"
+	"revolt_tui/broker"
+	"revolt_tui/keys"
+	"revolt_tui/log"
+	"revolt_tui/modes"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sentinelb51/revoltgo"
+)
+
+type Action struct {
+	list    list.Model
+	self    string // ID of this client's session, if known
+	loading bool
+	err     error
+
+	// revocation awaiting confirmation; others revokes every other session
+	confirming bool
+	target     sessionItem
+	others     bool
+
+	newMode modes.Mode
+}
+
+var _ modes.Action = &Action{}
+
+func (a *Action) ChangeMode() (bool, modes.Mode) {
+	if a.newMode == modes.Sessions {
+		return false, modes.Sessions
+	}
+	return true, a.newMode
+}
+
+func (a *Action) Enter() (bool, tea.Cmd) {
+	a.newMode = modes.Sessions
+	a.confirming, a.err, a.loading = false, nil, true
+	a.self = ""
+	if acct, ok := accounts.Current(); ok {
+		a.self = acct.SessionID
+	}
+	a.list = list.New(nil, list.NewDefaultDelegate(), broker.Width(), broker.Height()-1)
+	a.list.Title = "Sessions"
+	a.list.DisableQuitKeybindings()
+	return true, fetchSessions()
+}
+
+func (a *Action) Update(msg tea.Msg) tea.Cmd {
+	switch m := msg.(type) {
+	case tea.WindowSizeMsg:
+		a.list.SetSize(m.Width, m.Height-1)
+		return nil
+	case sessionsMsg:
+		a.loading, a.err = false, m.err
+		if m.err != nil {
+			return nil
+		}
+		itms := make([]list.Item, 0, len(m.sessions))
+		for _, s := range m.sessions {
+			itms = append(itms, sessionItem{id: s.ID, name: s.Name, current: s.ID == a.self})
+		}
+		return a.list.SetItems(itms)
+	case revokedMsg:
+		if m.err != nil {
+			broker.PostError(m.err)
+			return nil
+		}
+		broker.PostNotice(m.summary)
+		a.loading = true
+		return fetchSessions()
+	case tea.KeyMsg:
+		if a.confirming {
+			a.confirming = false
+			if keys.Matches(m, keys.SessionsConfirm) {
+				return a.revoke()
+			}
+			return nil
+		}
+		if a.list.FilterState() == list.Filtering {
+			break
+		}
+		switch {
+		case keys.Matches(m, keys.SessionsBack):
+			a.newMode = modes.AccountSelection
+			return nil
+		case keys.Matches(m, keys.SessionsRevoke):
+			itm, ok := a.list.SelectedItem().(sessionItem)
+			if !ok {
+				return nil
+			}
+			if itm.current {
+				broker.PostError(errors.New("this is the session in use; log out from account selection instead"))
+				return nil
+			}
+			if a.self == "" {
+				broker.PostError(errors.New("the session in use is unknown, so it may be this one; " +
+					keys.Get(keys.SessionsRevokeOthers).Help().Key + " revokes every other session instead"))
+				return nil
+			}
+			a.confirming, a.target, a.others = true, itm, false
+			return nil
+		case keys.Matches(m, keys.SessionsRevokeOthers):
+			a.confirming, a.others = true, true
+			return nil
+		}
+	}
+
+	var cmd tea.Cmd
+	a.list, cmd = a.list.Update(msg)
+	return cmd
+}
+
+func (a *Action) View() string {
+	var status string
+	switch {
+	case a.confirming && a.others:
+		status = "Revoke every other session? " + keys.Get(keys.SessionsConfirm).Help().Key + " to confirm"
+	case a.confirming:
+		status = "Revoke " + a.target.Title() + "? " + keys.Get(keys.SessionsConfirm).Help().Key + " to confirm"
+	case a.err != nil:
+		status = "failed to fetch sessions: " + a.err.Error()
+	case a.loading:
+		status = "loading..."
+	case a.self == "":
+		status = "the session in use is unknown; " +
+			keys.Get(keys.SessionsRevokeOthers).Help().Key + " to revoke all others"
+	default:
+		status = keys.Get(keys.SessionsRevoke).Help().Key + " to revoke, " +
+			keys.Get(keys.SessionsRevokeOthers).Help().Key + " to revoke all others"
+	}
+	return status + "\n" + a.list.View()
+}
+
+func (a *Action) KeyScopes() []keys.Scope {
+	return []keys.Scope{keys.Sessions}
+}
+
+// Revokes the session(s) awaiting confirmation.
+func (a *Action) revoke() tea.Cmd {
+	s := broker.Session()
+	if a.others {
+		return func() tea.Msg {
+			if err := api.RevokeOtherSessions(s); err != nil {
+				log.Writer.Warn("failed to revoke other sessions", "error", err)
+				return revokedMsg{err: errors.New("failed to revoke sessions: " + err.Error())}
+			}
+			return revokedMsg{summary: "revoked all other sessions"}
+		}
+	}
+	target := a.target
+	return func() tea.Msg {
+		if err := api.RevokeSession(s, target.id); err != nil {
+			log.Writer.Warn("failed to revoke session", "session ID", target.id, "error", err)
+			return revokedMsg{err: errors.New("failed to revoke session: " + err.Error())}
+		}
+		return revokedMsg{summary: "revoked " + target.Title()}
+	}
+}
+
+// returned when the account's sessions have been fetched
+type sessionsMsg struct {
+	sessions []*revoltgo.Sessions
+	err      error
+}
+
+func fetchSessions() tea.Cmd {
+	s := broker.Session()
+	return func() tea.Msg {
+		sessions, err := api.Sessions(s)
+		if err != nil {
+			log.Writer.Warn("failed to fetch sessions", "error", err)
+		}
+		return sessionsMsg{sessions: sessions, err: err}
+	}
+}
+
+// returned when a revocation completes
+type revokedMsg struct {
+	summary string // reported on success
+	err     error
+}
+
+// session representation for the list.Model
+type sessionItem struct {
+	id, name string
+	current  bool // this client's session
+}
+
+var _ list.Item = sessionItem{} // check interface
+
+func (si sessionItem) Title() string {
+	if si.name == "" {
+		return "unnamed session"
+	}
+	return si.name
+}
+
+func (si sessionItem) Description() string {
+	if si.current {
+		return si.id + " (this session)"
+	}
+	return si.id
+}
+
+func (si sessionItem) FilterValue() string {
+	return si.name
+}
@@ -0,0 +1,173 @@
+/*
+The outbox package tracks messages that have been submitted but not yet accepted by Revolt.
+Each entry is identified by a nonce, which doubles as the idempotency key of its send request so
+retries cannot produce duplicates.
+The outbox is persisted to the current account's profile directory whenever it changes, so unsent
+messages survive a restart; it is loaded whenever an account is put to use.
+*/
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"revolt_tui/cfgdir"
+	"revolt_tui/log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+const (
+	FileName       string = "outbox.json" // in profile directory
+	filePermission        = 0600
+)
+
+type Status uint8
+
+const (
+	Pending Status = iota // waiting to be (re)sent
+	Failed                // gave up after repeated failures; awaiting retry or discard by the user
+)
+
+type Entry struct {
+	Nonce     string    `json:"nonce"`
+	ChannelID string    `json:"channel"`
+	Content   string    `json:"content"`
+	Created   time.Time `json:"created"`
+	Status    Status    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	LastErr   string    `json:"last_error,omitempty"`
+}
+
+var (
+	entries map[string]*Entry = make(map[string]*Entry) // nonce -> entry
+	mtx     sync.Mutex
+)
+
+// Loads the outbox persisted in the profile directory, replacing the one in memory.
+// A missing file is not an error; it leaves the outbox empty.
+func Load() error {
+	raw, err := os.ReadFile(path.Join(cfgdir.Profile(), FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		raw = []byte("[]")
+	} else if err != nil {
+		return err
+	}
+	var list []*Entry
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return err
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	entries = make(map[string]*Entry, len(list))
+	for _, e := range list {
+		entries[e.Nonce] = e
+	}
+	return nil
+}
+
+// Queues a new message for the given channel, returning a copy of its entry.
+func Add(channelID, content string) Entry {
+	e := &Entry{
+		Nonce:     ulid.Make().String(),
+		ChannelID: channelID,
+		Content:   content,
+		Created:   time.Now(),
+		Status:    Pending,
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	entries[e.Nonce] = e
+	save()
+	return *e
+}
+
+// Returns a copy of the entry with the given nonce.
+func Get(nonce string) (Entry, bool) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	e, ok := entries[nonce]
+	if !ok {
+		return Entry{}, false
+	}
+	return *e, true
+}
+
+// Returns copies of every entry for the given channel, oldest first.
+func Channel(channelID string) []Entry {
+	mtx.Lock()
+	defer mtx.Unlock()
+	var es []Entry
+	for _, e := range entries {
+		if e.ChannelID == channelID {
+			es = append(es, *e)
+		}
+	}
+	sort.Slice(es, func(i, j int) bool { return es[i].Created.Before(es[j].Created) })
+	return es
+}
+
+// Removes the entry with the given nonce, typically once it has been delivered or discarded.
+func Remove(nonce string) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	if _, ok := entries[nonce]; ok {
+		delete(entries, nonce)
+		save()
+	}
+}
+
+// Records a failed attempt to send the given entry.
+// Once maxAttempts is reached, the entry is marked Failed.
+// Returns the updated entry.
+func Fail(nonce string, err error, maxAttempts int) (Entry, bool) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	e, ok := entries[nonce]
+	if !ok {
+		return Entry{}, false
+	}
+	e.Attempts += 1
+	e.LastErr = err.Error()
+	if e.Attempts >= maxAttempts {
+		e.Status = Failed
+	}
+	save()
+	return *e, true
+}
+
+// Returns a Failed entry to Pending, resetting its attempts.
+func Reset(nonce string) (Entry, bool) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	e, ok := entries[nonce]
+	if !ok {
+		return Entry{}, false
+	}
+	e.Status = Pending
+	e.Attempts = 0
+	e.LastErr = ""
+	save()
+	return *e, true
+}
+
+// writes the outbox to disk. Expects the caller to hold the lock.
+// Failures are logged, but not fatal; the outbox remains usable in memory.
+func save() {
+	list := make([]*Entry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	raw, err := json.Marshal(list)
+	if err == nil {
+		err = os.WriteFile(path.Join(cfgdir.Profile(), FileName), raw, filePermission)
+	}
+	if err != nil {
+		log.Writer.Warn("failed to persist outbox", "error", err)
+	}
+}
@@ -0,0 +1,268 @@
+/*
+The serverlist package stores the user's arrangement of the server selection list: the order of
+servers and the folders they are grouped into.
+The arrangement is persisted to the current account's profile directory on every change; it is loaded
+whenever an account is put to use.
+Servers the arrangement does not know about (ex: newly joined) are appended in the order given.
+*/
+package serverlist
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"revolt_tui/cfgdir"
+	"revolt_tui/log"
+	"slices"
+	"sync"
+)
+
+const (
+	FileName       string = "serverlist.json" // in profile directory
+	filePermission        = 0600
+)
+
+// A named group of servers
+type Folder struct {
+	Name      string   `json:"name"`
+	Servers   []string `json:"servers"` // server IDs, in display order
+	Collapsed bool     `json:"collapsed"`
+}
+
+// A single top-level entry of the arranged list: either a server or a folder
+type Entry struct {
+	ServerID string  // set if this entry is a server outside of any folder
+	Folder   *Folder // set if this entry is a folder; a copy
+}
+
+// format of the arrangement file
+type file struct {
+	Order   []string  `json:"order"` // top-level entries: server IDs and "folder:<name>"
+	Folders []*Folder `json:"folders"`
+}
+
+const folderPrefix string = "folder:"
+
+var (
+	arrangement file
+	present     map[string]bool // servers given to the last Arrange; others are skipped over by moves
+	mtx         sync.Mutex
+)
+
+// Loads the arrangement persisted in the profile directory, replacing the one in memory.
+// A missing file is not an error; it leaves the servers unarranged.
+func Load() error {
+	raw, err := os.ReadFile(path.Join(cfgdir.Profile(), FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		raw = []byte("{}")
+	} else if err != nil {
+		return err
+	}
+	var f file
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return err
+	}
+	mtx.Lock()
+	arrangement = f
+	mtx.Unlock()
+	return nil
+}
+
+// Arranges the given server IDs according to the user's order and folders.
+// Unknown servers are appended; servers no longer present are omitted (but remembered).
+func Arrange(serverIDs []string) []Entry {
+	mtx.Lock()
+	defer mtx.Unlock()
+	present = make(map[string]bool, len(serverIDs))
+	for _, id := range serverIDs {
+		present[id] = true
+	}
+	placed := make(map[string]bool)
+
+	var entries []Entry
+	for _, o := range arrangement.Order {
+		if name, isFolder := cutFolder(o); isFolder {
+			f := folder(name)
+			if f == nil {
+				continue
+			}
+			cp := *f
+			cp.Servers = nil
+			for _, id := range f.Servers {
+				placed[id] = true
+				if present[id] {
+					cp.Servers = append(cp.Servers, id)
+				}
+			}
+			entries = append(entries, Entry{Folder: &cp})
+		} else if present[o] && !placed[o] {
+			placed[o] = true
+			entries = append(entries, Entry{ServerID: o})
+		}
+	}
+	for _, id := range serverIDs {
+		if !placed[id] {
+			entries = append(entries, Entry{ServerID: id})
+		}
+	}
+	return entries
+}
+
+// Moves the given server by delta positions within its containing list (its folder or the top level),
+// counting only the entries Arrange last listed.
+// visible is the current arrangement of top-level server IDs, used to seed the order on first move.
+func Move(serverID string, delta int, visible []string) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	seed(visible)
+
+	list := &arrangement.Order
+	if f := folderOf(serverID); f != nil {
+		list = &f.Servers
+	}
+	shift(*list, serverID, delta)
+	save()
+}
+
+// Moves the named folder by delta positions among the listed top-level entries.
+func MoveFolder(name string, delta int, visible []string) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	seed(visible)
+	shift(arrangement.Order, folderPrefix+name, delta)
+	save()
+}
+
+// Places the given server into the named folder, creating the folder if need be.
+// An empty name removes the server from its folder, returning it to the top level.
+// Emptied folders are deleted.
+func SetFolder(serverID, name string, visible []string) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	seed(visible)
+
+	// remove from the current folder
+	if f := folderOf(serverID); f != nil {
+		if f.Name == name {
+			return
+		}
+		f.Servers = slices.DeleteFunc(f.Servers, func(id string) bool { return id == serverID })
+		if len(f.Servers) == 0 {
+			deleteFolder(f.Name)
+		}
+	}
+	arrangement.Order = slices.DeleteFunc(arrangement.Order, func(o string) bool { return o == serverID })
+
+	if name == "" {
+		arrangement.Order = append(arrangement.Order, serverID)
+	} else if f := folder(name); f != nil {
+		f.Servers = append(f.Servers, serverID)
+	} else {
+		arrangement.Folders = append(arrangement.Folders, &Folder{Name: name, Servers: []string{serverID}})
+		arrangement.Order = append(arrangement.Order, folderPrefix+name)
+	}
+	save()
+}
+
+// Collapses or expands the named folder.
+func ToggleFolder(name string) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	if f := folder(name); f != nil {
+		f.Collapsed = !f.Collapsed
+		save()
+	}
+}
+
+//#region helper functions
+
+// ensures every visible server has a place in the top-level order, so moves have a stable base.
+// Caller must hold the lock.
+func seed(visible []string) {
+	for _, id := range visible {
+		if folderOf(id) == nil && !slices.Contains(arrangement.Order, id) {
+			arrangement.Order = append(arrangement.Order, id)
+		}
+	}
+}
+
+// swaps the element v with its neighbour delta listed positions away, if one exists; entries for
+// servers no longer present are remembered, but neither counted nor swapped with.
+// Caller must hold the lock.
+func shift(s []string, v string, delta int) {
+	i := slices.Index(s, v)
+	if i < 0 || delta == 0 {
+		return
+	}
+	step := 1
+	if delta < 0 {
+		step, delta = -1, -delta
+	}
+	j := i
+	for passed := 0; passed < delta; {
+		if j += step; j < 0 || j >= len(s) {
+			return
+		}
+		if listed(s[j]) {
+			passed++
+		}
+	}
+	s[i], s[j] = s[j], s[i]
+}
+
+// returns whether the given order entry (a server ID or folder) is shown by Arrange.
+// Caller must hold the lock.
+func listed(o string) bool {
+	if name, isFolder := cutFolder(o); isFolder {
+		return folder(name) != nil
+	}
+	return present[o]
+}
+
+func cutFolder(o string) (string, bool) {
+	if len(o) > len(folderPrefix) && o[:len(folderPrefix)] == folderPrefix {
+		return o[len(folderPrefix):], true
+	}
+	return "", false
+}
+
+// returns the folder with the given name, or nil
+func folder(name string) *Folder {
+	for _, f := range arrangement.Folders {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// returns the folder containing the given server, or nil
+func folderOf(serverID string) *Folder {
+	for _, f := range arrangement.Folders {
+		if slices.Contains(f.Servers, serverID) {
+			return f
+		}
+	}
+	return nil
+}
+
+func deleteFolder(name string) {
+	arrangement.Folders = slices.DeleteFunc(arrangement.Folders, func(f *Folder) bool { return f.Name == name })
+	arrangement.Order = slices.DeleteFunc(arrangement.Order, func(o string) bool { return o == folderPrefix+name })
+}
+
+// writes the arrangement to the profile directory, logging on failure.
+// Caller must hold the lock.
+func save() {
+	raw, err := json.Marshal(arrangement)
+	if err != nil {
+		log.Writer.Warn("failed to marshal server list arrangement", "error", err)
+		return
+	}
+	if err := os.WriteFile(path.Join(cfgdir.Profile(), FileName), raw, filePermission); err != nil {
+		log.Writer.Warn("failed to save server list arrangement", "error", err)
+	}
+}
+
+//#endregion helper functions
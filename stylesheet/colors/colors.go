@@ -1,10 +1,100 @@
+/*
+The colors package holds the theme: the colors every style is drawn in.
+Colors may be overridden by the theme table of the config file; as styles are built from them,
+packages with styles rebuild them on each change via OnChange.
+*/
 package colors
 
-import "github.com/charmbracelet/lipgloss"
+import (
+	"slices"
+	"sync"
 
-const (
-	TabBorderForeground lipgloss.Color = "#fd6671" // revolt red
-	MessageTimestamp    lipgloss.Color = "#88968d"
-	MessageAuthor       lipgloss.Color = "#48afc9"
-	LeftField           lipgloss.Color = "#48afc9" // color of "field" in aligned field/value pairs (ex: 'field: value')
+	"github.com/charmbracelet/lipgloss"
 )
+
+var (
+	TabBorderForeground lipgloss.Color // revolt red
+	MessageTimestamp    lipgloss.Color
+	MessageAuthor       lipgloss.Color
+	LeftField           lipgloss.Color // color of "field" in aligned field/value pairs (ex: 'field: value')
+	MessagePending      lipgloss.Color // messages in the outbox
+	Error               lipgloss.Color
+	Warning             lipgloss.Color
+	Connected           lipgloss.Color
+	PaneBorder          lipgloss.Color // border of unfocused panes
+	StatusBarBackground lipgloss.Color
+	StatusBarForeground lipgloss.Color
+)
+
+// each color, by the name it is given in the theme, and its default
+var named = map[string]struct {
+	color *lipgloss.Color
+	def   lipgloss.Color
+}{
+	"accent":                {&TabBorderForeground, "#fd6671"},
+	"message_timestamp":     {&MessageTimestamp, "#88968d"},
+	"message_author":        {&MessageAuthor, "#48afc9"},
+	"field":                 {&LeftField, "#48afc9"},
+	"message_pending":       {&MessagePending, "#5c5c5c"},
+	"error":                 {&Error, "#ff3b3b"},
+	"warning":               {&Warning, "#e5c07b"},
+	"connected":             {&Connected, "#98c379"},
+	"pane_border":           {&PaneBorder, "#5c5c5c"},
+	"status_bar_background": {&StatusBarBackground, "#2b2d31"},
+	"status_bar_foreground": {&StatusBarForeground, "#c8c8c8"},
+}
+
+var (
+	subscribers []func()
+	mtx         sync.Mutex
+)
+
+func init() {
+	for _, n := range named {
+		*n.color = n.def
+	}
+}
+
+// Returns whether the given name is a color of the theme.
+func Known(name string) bool {
+	_, ok := named[name]
+	return ok
+}
+
+// Returns the names of the theme's colors.
+func Names() []string {
+	names := make([]string, 0, len(named))
+	for name := range named {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Resets every color to its default, overlaid by the given overrides (keyed by name), then rebuilds
+// every style.
+// Expects the overrides to have been validated; unknown names are ignored.
+// Not safe to call while styles may be in use (ie: call from within the program's update cycle).
+func Apply(overrides map[string]string) {
+	for name, n := range named {
+		*n.color = n.def
+		if c, ok := overrides[name]; ok {
+			*n.color = lipgloss.Color(c)
+		}
+	}
+	mtx.Lock()
+	subs := subscribers
+	mtx.Unlock()
+	for _, fn := range subs {
+		fn()
+	}
+}
+
+// Registers a function that (re)builds styles from the colors, calling it immediately and again on
+// every change of theme.
+func OnChange(fn func()) {
+	mtx.Lock()
+	subscribers = append(subscribers, fn)
+	mtx.Unlock()
+	fn()
+}
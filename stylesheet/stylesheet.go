@@ -22,6 +22,12 @@ var TabBorders = struct {
 	Active:   TabBorderWithBottom("┘", " ", "└"),
 }
 
-var NewMessageComposeArea lipgloss.Style = lipgloss.NewStyle().
-	Border(lipgloss.RoundedBorder()).
-	BorderForeground(colors.TabBorderForeground)
+var NewMessageComposeArea lipgloss.Style
+
+func init() {
+	colors.OnChange(func() {
+		NewMessageComposeArea = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(colors.TabBorderForeground)
+	})
+}